@@ -6,11 +6,12 @@ replace github.com/ccrsxx/learn-go/src/getting-started/greetings => ./src/gettin
 
 require (
 	github.com/ccrsxx/learn-go/src/getting-started/greetings v0.0.0-00010101000000-000000000000
+	golang.org/x/net v0.47.0
 	golang.org/x/tour v0.1.0
 	rsc.io/quote v1.5.2
 )
 
 require (
-	golang.org/x/text v0.0.0-20170915032832-14c0d48ead0c // indirect
+	golang.org/x/text v0.31.0 // indirect
 	rsc.io/sampler v1.3.0 // indirect
 )
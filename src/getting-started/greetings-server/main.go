@@ -0,0 +1,90 @@
+// Command greetings-server serves the greetings package over HTTP.
+//
+//	GET  /hello?name=Rem         a greeting for Rem
+//	GET  /hello/random?name=Rem  a random greeting for Rem
+//	POST /hellos                 random greetings for {"names": [...]}
+//	GET  /openapi.json           the OpenAPI document of the endpoints
+//
+// Errors are application/problem+json responses.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:8080", "address to listen on")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 10*time.Second, "how long to wait for requests in flight when shutting down")
+	printOpenAPI := flag.Bool("openapi", false, "print the OpenAPI document and exit")
+
+	flag.Parse()
+
+	if *printOpenAPI {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+
+		if err := enc.Encode(openAPI()); err != nil {
+			log.Fatal(err)
+		}
+
+		return
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           newServer(logger),
+		ReadHeaderTimeout: 5 * time.Second,
+		ErrorLog:          slog.NewLogLogger(logger.Handler(), slog.LevelError),
+	}
+
+	if err := serve(ctx, srv, logger, *shutdownTimeout); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// serve runs srv until ctx is done, then shuts it down, giving the
+// requests in flight up to timeout to finish.
+func serve(ctx context.Context, srv *http.Server, logger *slog.Logger, timeout time.Duration) error {
+	errc := make(chan error, 1)
+
+	go func() {
+		logger.Info("listening", "addr", srv.Addr)
+		errc <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	logger.Info("shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+
+	if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
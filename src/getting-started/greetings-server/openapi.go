@@ -0,0 +1,168 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+)
+
+// openAPI generates the OpenAPI 3.1 document of the server from its routes.
+func openAPI() map[string]any {
+	paths := make(map[string]any)
+	schemas := map[string]any{
+		"Problem": schemaOf(reflect.TypeFor[Problem]()),
+	}
+
+	for _, r := range routes() {
+		op := map[string]any{
+			"summary":     r.summary,
+			"operationId": operationID(r),
+		}
+
+		if r.description != "" {
+			op["description"] = r.description
+		}
+
+		if len(r.params) > 0 {
+			var params []any
+
+			for _, p := range r.params {
+				params = append(params, map[string]any{
+					"name":        p.name,
+					"in":          "query",
+					"description": p.description,
+					"required":    p.required,
+					"schema":      map[string]any{"type": "string"},
+				})
+			}
+
+			op["parameters"] = params
+		}
+
+		if r.request != nil {
+			op["requestBody"] = map[string]any{
+				"required": true,
+				"content":  jsonContent("application/json", schemaRef(schemas, r.request)),
+			}
+		}
+
+		problem := map[string]any{"$ref": "#/components/schemas/Problem"}
+
+		responses := map[string]any{
+			"200": map[string]any{
+				"description": "OK",
+				"content":     jsonContent("application/json", schemaRef(schemas, r.response)),
+			},
+			"400": problemResponse(problem),
+			"500": problemResponse(problem),
+		}
+
+		if r.request != nil {
+			responses["413"] = problemResponse(problem)
+		}
+
+		op["responses"] = responses
+
+		item, _ := paths[r.path].(map[string]any)
+		if item == nil {
+			item = make(map[string]any)
+			paths[r.path] = item
+		}
+
+		item[strings.ToLower(r.method)] = op
+	}
+
+	return map[string]any{
+		"openapi": "3.1.0",
+		"info": map[string]any{
+			"title":   "Greetings",
+			"version": "1.0.0",
+		},
+		"paths":      paths,
+		"components": map[string]any{"schemas": schemas},
+	}
+}
+
+func operationID(r route) string {
+	var b strings.Builder
+
+	b.WriteString(strings.ToLower(r.method))
+
+	for part := range strings.SplitSeq(r.path, "/") {
+		if part != "" {
+			b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+		}
+	}
+
+	return b.String()
+}
+
+func jsonContent(mediaType string, schema any) map[string]any {
+	return map[string]any{mediaType: map[string]any{"schema": schema}}
+}
+
+func problemResponse(schema any) map[string]any {
+	return map[string]any{
+		"description": "Problem",
+		"content":     jsonContent("application/problem+json", schema),
+	}
+}
+
+// schemaRef adds the schema of v to schemas and returns a reference to it.
+func schemaRef(schemas map[string]any, v any) map[string]any {
+	t := reflect.TypeOf(v)
+	schemas[t.Name()] = schemaOf(t)
+
+	return map[string]any{"$ref": "#/components/schemas/" + t.Name()}
+}
+
+// schemaOf returns the JSON schema of t, following its json tags.
+func schemaOf(t reflect.Type) map[string]any {
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Pointer:
+		return schemaOf(t.Elem())
+	case reflect.Slice:
+		return map[string]any{"type": "array", "items": schemaOf(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": schemaOf(t.Elem())}
+	case reflect.Struct:
+		properties := make(map[string]any)
+		var required []string
+
+		for i := range t.NumField() {
+			f := t.Field(i)
+
+			name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if name == "-" || !f.IsExported() {
+				continue
+			}
+
+			if name == "" {
+				name = f.Name
+			}
+
+			properties[name] = schemaOf(f.Type)
+
+			if !strings.Contains(opts, "omitempty") {
+				required = append(required, name)
+			}
+		}
+
+		schema := map[string]any{"type": "object", "properties": properties}
+
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+
+		return schema
+	}
+
+	panic("openapi: unsupported type " + t.String())
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/ccrsxx/learn-go/src/getting-started/greetings"
+)
+
+// maxBodySize limits the size of request bodies.
+const maxBodySize = 1 << 20
+
+// HelloResponse is the greeting of one person.
+type HelloResponse struct {
+	Name    string `json:"name"`
+	Message string `json:"message"`
+}
+
+// HellosRequest lists the people to greet at once.
+type HellosRequest struct {
+	Names []string `json:"names"`
+}
+
+// HellosResponse maps each name to its greeting.
+type HellosResponse struct {
+	Messages map[string]string `json:"messages"`
+}
+
+// Problem is an RFC 9457 problem details object.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+
+	// Rule and Position tell which rule an invalid name breaks, and where.
+	// For a batch, they are those of the first invalid name.
+	Rule     string `json:"rule,omitempty"`
+	Position *int   `json:"position,omitempty"`
+
+	// Names lists every invalid name of a batch, in request order.
+	Names []NameProblem `json:"names,omitempty"`
+}
+
+// NameProblem is an invalid name of a batch.
+type NameProblem struct {
+	Index    int    `json:"index"`
+	Name     string `json:"name"`
+	Detail   string `json:"detail"`
+	Rule     string `json:"rule"`
+	Position int    `json:"position"`
+}
+
+// route is one endpoint of the server, with what the OpenAPI document
+// needs to describe it.
+type route struct {
+	method      string
+	path        string
+	summary     string
+	params      []param
+	request     any
+	response    any
+	handler     http.HandlerFunc
+	description string
+}
+
+type param struct {
+	name        string
+	description string
+	required    bool
+}
+
+func routes() []route {
+	nameParam := param{name: "name", description: "Name of the person to greet.", required: true}
+
+	return []route{
+		{
+			method:   http.MethodGet,
+			path:     "/hello",
+			summary:  "Greet one person",
+			params:   []param{nameParam},
+			response: HelloResponse{},
+			handler:  handleHello,
+		},
+		{
+			method:      http.MethodGet,
+			path:        "/hello/random",
+			summary:     "Greet one person with a random greeting",
+			params:      []param{nameParam},
+			response:    HelloResponse{},
+			handler:     handleHelloRandom,
+			description: "Picks one of several greetings at random.",
+		},
+		{
+			method:      http.MethodPost,
+			path:        "/hellos",
+			summary:     "Greet several people with random greetings",
+			request:     HellosRequest{},
+			response:    HellosResponse{},
+			handler:     handleHellos,
+			description: "Fails if any of the names is invalid, listing every invalid name in the names of the problem.",
+		},
+	}
+}
+
+// newServer returns the handler of every endpoint, logging requests to logger.
+func newServer(logger *slog.Logger) http.Handler {
+	mux := http.NewServeMux()
+
+	for _, r := range routes() {
+		mux.HandleFunc(r.method+" "+r.path, r.handler)
+	}
+
+	mux.HandleFunc("GET /openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, openAPI())
+	})
+
+	return logRequests(logger, mux)
+}
+
+func handleHello(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+
+	message, err := greetings.HelloError(name)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, HelloResponse{Name: name, Message: message})
+}
+
+func handleHelloRandom(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+
+	message, err := greetings.HelloRandomError(name)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, HelloResponse{Name: name, Message: message})
+}
+
+func handleHellos(w http.ResponseWriter, r *http.Request) {
+	var req HellosRequest
+
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(&req); err != nil {
+		writeError(w, r, &badRequestError{err})
+		return
+	}
+
+	// Every name is greeted, so the problem lists all the invalid ones.
+	results, err := greetings.HelloAll(r.Context(), req.Names, 0)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	messages := make(map[string]string, len(results))
+
+	for _, res := range results {
+		messages[res.Name] = res.Message
+	}
+
+	writeJSON(w, http.StatusOK, HellosResponse{Messages: messages})
+}
+
+// badRequestError marks a request the server could not make sense of.
+type badRequestError struct {
+	err error
+}
+
+func (e *badRequestError) Error() string {
+	return "invalid request body: " + e.err.Error()
+}
+
+func (e *badRequestError) Unwrap() error {
+	return e.err
+}
+
+// writeError writes err as a problem. Errors the client caused are
+// described; anything else is a 500 without details.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	var badRequest *badRequestError
+	var tooLarge *http.MaxBytesError
+	var invalid *greetings.ValidationError
+
+	problem := Problem{
+		Type:     "about:blank",
+		Status:   http.StatusInternalServerError,
+		Instance: r.URL.Path,
+	}
+
+	switch {
+	case errors.As(err, &tooLarge):
+		problem.Status = http.StatusRequestEntityTooLarge
+		problem.Detail = err.Error()
+	case errors.As(err, &invalid):
+		problem.Status = http.StatusBadRequest
+		problem.Detail = err.Error()
+		problem.Rule = invalid.Rule
+		problem.Position = &invalid.Pos
+		problem.Names = nameProblems(err)
+	case errors.As(err, &badRequest):
+		problem.Status = http.StatusBadRequest
+		problem.Detail = err.Error()
+	}
+
+	problem.Title = http.StatusText(problem.Status)
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(problem.Status)
+
+	_ = json.NewEncoder(w).Encode(problem)
+}
+
+// nameProblems returns the invalid names among the joined errors of a batch.
+func nameProblems(err error) []NameProblem {
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return nil
+	}
+
+	var problems []NameProblem
+
+	for _, err := range joined.Unwrap() {
+		var name *greetings.NameError
+		var invalid *greetings.ValidationError
+
+		if errors.As(err, &name) && errors.As(err, &invalid) {
+			problems = append(problems, NameProblem{
+				Index:    name.Index,
+				Name:     name.Name,
+				Detail:   invalid.Error(),
+				Rule:     invalid.Rule,
+				Position: invalid.Pos,
+			})
+		}
+	}
+
+	slices.SortFunc(problems, func(a, b NameProblem) int {
+		return cmp.Compare(a.Index, b.Index)
+	})
+
+	return problems
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// statusRecorder remembers the status code and size of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+
+	return n, err
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// logRequests logs every request handled by next.
+func logRequests(logger *slog.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(rec, r)
+
+		level := slog.LevelInfo
+		if rec.status >= 500 {
+			level = slog.LevelError
+		}
+
+		logger.LogAttrs(r.Context(), level, "request",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", rec.status),
+			slog.Int("bytes", rec.bytes),
+			slog.Duration("duration", time.Since(start)),
+			slog.String("remote", r.RemoteAddr),
+		)
+	})
+}
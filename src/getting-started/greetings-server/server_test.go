@@ -0,0 +1,332 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ccrsxx/learn-go/src/getting-started/greetings"
+)
+
+var update = flag.Bool("update", false, "rewrite openapi.json")
+
+func newTestServer(t *testing.T) (*httptest.Server, *bytes.Buffer) {
+	t.Helper()
+
+	var logs bytes.Buffer
+
+	srv := httptest.NewServer(newServer(slog.New(slog.NewTextHandler(&logs, nil))))
+	t.Cleanup(srv.Close)
+
+	return srv, &logs
+}
+
+func decode[T any](t *testing.T, res *http.Response) T {
+	t.Helper()
+
+	var v T
+
+	if err := json.NewDecoder(res.Body).Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+
+	return v
+}
+
+func TestHello(t *testing.T) {
+	srv, _ := newTestServer(t)
+
+	for _, path := range []string{"/hello", "/hello/random"} {
+		t.Run(path, func(t *testing.T) {
+			res, err := http.Get(srv.URL + path + "?name=Rem")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != "application/json" {
+				t.Fatalf("GET %s = %d %s, want 200 application/json", path, res.StatusCode, res.Header.Get("Content-Type"))
+			}
+
+			got := decode[HelloResponse](t, res)
+
+			if got.Name != "Rem" || !strings.Contains(got.Message, "Rem") {
+				t.Errorf("GET %s = %+v, want a greeting for Rem", path, got)
+			}
+		})
+	}
+}
+
+func TestHellos(t *testing.T) {
+	srv, _ := newTestServer(t)
+
+	res, err := http.Post(srv.URL+"/hellos", "application/json", strings.NewReader(`{"names": ["Rem", "Ram"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("POST /hellos = %d, want 200", res.StatusCode)
+	}
+
+	got := decode[HellosResponse](t, res)
+
+	if len(got.Messages) != 2 || !strings.Contains(got.Messages["Ram"], "Ram") {
+		t.Errorf("POST /hellos = %v, want greetings for Rem and Ram", got.Messages)
+	}
+}
+
+func TestProblems(t *testing.T) {
+	srv, _ := newTestServer(t)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+		detail string
+	}{
+		{"empty name", http.MethodGet, "/hello?name=", "", http.StatusBadRequest, "empty name"},
+		{"no name", http.MethodGet, "/hello/random", "", http.StatusBadRequest, "empty name"},
+		{"empty name in batch", http.MethodPost, "/hellos", `{"names": ["Rem", ""]}`, http.StatusBadRequest, "empty name"},
+		{"control character", http.MethodGet, "/hello?name=Re%07m", "", http.StatusBadRequest, "control character"},
+		{"too long", http.MethodPost, "/hellos", `{"names": ["` + strings.Repeat("a", 100) + `"]}`, http.StatusBadRequest, "name too long"},
+		{"bad json", http.MethodPost, "/hellos", `{"names": `, http.StatusBadRequest, "invalid request body"},
+		{"unknown field", http.MethodPost, "/hellos", `{"name": "Rem"}`, http.StatusBadRequest, "unknown field"},
+		{"too large", http.MethodPost, "/hellos", `{"names": ["` + strings.Repeat("a", maxBodySize) + `"]}`, http.StatusRequestEntityTooLarge, "too large"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, srv.URL+tt.path, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			if res.Header.Get("Content-Type") != "application/problem+json" {
+				t.Errorf("Content-Type = %q, want application/problem+json", res.Header.Get("Content-Type"))
+			}
+
+			got := decode[Problem](t, res)
+
+			if res.StatusCode != tt.status || got.Status != tt.status {
+				t.Errorf("status = %d, problem status = %d, want %d", res.StatusCode, got.Status, tt.status)
+			}
+
+			if !strings.Contains(got.Detail, tt.detail) || got.Title != http.StatusText(tt.status) {
+				t.Errorf("problem = %+v, want detail containing %q", got, tt.detail)
+			}
+
+			if want := strings.Split(tt.path, "?")[0]; got.Instance != want {
+				t.Errorf("problem instance = %q, want %q", got.Instance, want)
+			}
+		})
+	}
+}
+
+func TestProblemRule(t *testing.T) {
+	srv, _ := newTestServer(t)
+
+	res, err := http.Get(srv.URL + "/hello?name=Re%0Am")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	got := decode[Problem](t, res)
+
+	if got.Rule != greetings.RuleControl || got.Position == nil || *got.Position != 2 {
+		t.Errorf("problem = %+v, want the control rule at position 2", got)
+	}
+}
+
+func TestProblemNames(t *testing.T) {
+	srv, _ := newTestServer(t)
+
+	res, err := http.Post(srv.URL+"/hellos", "application/json", strings.NewReader(`{"names": ["Rem", "", "Ra\u0007m"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	got := decode[Problem](t, res)
+
+	want := []NameProblem{
+		{Index: 1, Name: "", Rule: greetings.RuleEmpty},
+		{Index: 2, Name: "Ra\u0007m", Rule: greetings.RuleControl, Position: 2},
+	}
+
+	if len(got.Names) != len(want) {
+		t.Fatalf("problem names = %+v, want %+v", got.Names, want)
+	}
+
+	for i, n := range got.Names {
+		if n.Index != want[i].Index || n.Name != want[i].Name || n.Rule != want[i].Rule || n.Position != want[i].Position || n.Detail == "" {
+			t.Errorf("problem names[%d] = %+v, want %+v with a detail", i, n, want[i])
+		}
+	}
+}
+
+func TestWriteErrorInternal(t *testing.T) {
+	rec := httptest.NewRecorder()
+
+	writeError(rec, httptest.NewRequest(http.MethodGet, "/hello", nil), io.ErrUnexpectedEOF)
+
+	got := decode[Problem](t, rec.Result())
+
+	if got.Status != http.StatusInternalServerError || got.Detail != "" {
+		t.Errorf("problem = %+v, want a 500 without details", got)
+	}
+}
+
+func TestRequestLogging(t *testing.T) {
+	srv, logs := newTestServer(t)
+
+	res, err := http.Get(srv.URL + "/hello?name=")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	for _, want := range []string{"msg=request", "method=GET", "path=/hello", "status=400", "duration="} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("log = %q, want %q in it", logs.String(), want)
+		}
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	srv, _ := newTestServer(t)
+
+	res, err := http.Post(srv.URL+"/hello?name=Rem", "text/plain", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST /hello = %d, want 405", res.StatusCode)
+	}
+}
+
+// TestOpenAPI checks the served document against the committed
+// openapi.json, which -update rewrites.
+func TestOpenAPI(t *testing.T) {
+	srv, _ := newTestServer(t)
+
+	res, err := http.Get(srv.URL + "/openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	doc := decode[map[string]any](t, res)
+
+	paths, _ := doc["paths"].(map[string]any)
+
+	for _, r := range routes() {
+		if item, _ := paths[r.path].(map[string]any); item[strings.ToLower(r.method)] == nil {
+			t.Errorf("document has no %s %s operation", r.method, r.path)
+		}
+	}
+
+	got, err := json.MarshalIndent(openAPI(), "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got = append(got, '\n')
+
+	if *update {
+		if err := os.WriteFile("openapi.json", got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want, err := os.ReadFile("openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got, want) {
+		t.Errorf("openapi.json is out of date, run go test -update:\n%s", got)
+	}
+}
+
+// TestServeShutdown checks that canceling the context lets a request in
+// flight finish before serve returns.
+func TestServeShutdown(t *testing.T) {
+	ln, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addr := ln.Addr().String()
+	ln.Close()
+
+	started := make(chan struct{})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(50 * time.Millisecond)
+		_, _ = io.WriteString(w, "done")
+	})
+
+	srv := &http.Server{Addr: addr, Handler: mux}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+
+	go func() {
+		errc <- serve(ctx, srv, logger, time.Second)
+	}()
+
+	bodyc := make(chan string, 1)
+
+	go func() {
+		for {
+			res, err := http.Get("http://" + addr + "/slow")
+			if err != nil {
+				time.Sleep(5 * time.Millisecond)
+				continue
+			}
+
+			b, _ := io.ReadAll(res.Body)
+			res.Body.Close()
+			bodyc <- string(b)
+
+			return
+		}
+	}()
+
+	<-started
+	cancel()
+
+	if err := <-errc; err != nil {
+		t.Errorf("serve() error = %v, want nil", err)
+	}
+
+	if body := <-bodyc; body != "done" {
+		t.Errorf("request in flight got %q, want done", body)
+	}
+}
@@ -0,0 +1,102 @@
+package greetings
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+// Result is the greeting of one name of a batch.
+type Result struct {
+	Index   int
+	Name    string
+	Message string
+
+	// Err is a *NameError when the name could not be greeted.
+	Err error
+}
+
+// NameError is the error of one name of a batch.
+type NameError struct {
+	Index int
+	Name  string
+	Err   error
+}
+
+func (e *NameError) Error() string {
+	return fmt.Sprintf("name %d %q: %v", e.Index, e.Name, e.Err)
+}
+
+func (e *NameError) Unwrap() error {
+	return e.Err
+}
+
+// GreetAll greets names concurrently with up to workers goroutines, or
+// GOMAXPROCS of them if workers is zero or less. It returns a Result for
+// every name, in the order of names, and the errors of the names that
+// could not be greeted joined together. Once ctx is done, the names not
+// greeted yet fail with the context's error.
+func (g *Greeter) GreetAll(ctx context.Context, names []string, workers int) ([]Result, error) {
+	return GreetAllFunc(ctx, names, workers, g.Greet)
+}
+
+// GreetAllFunc is like Greeter.GreetAll, but greets every name with greet,
+// which must be safe for concurrent use.
+func GreetAllFunc(ctx context.Context, names []string, workers int, greet func(name string) (string, error)) ([]Result, error) {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	results := make([]Result, len(names))
+	indexes := make(chan int)
+
+	var wg sync.WaitGroup
+
+	for range min(workers, len(names)) {
+		wg.Go(func() {
+			for i := range indexes {
+				results[i] = greetAt(ctx, i, names[i], greet)
+			}
+		})
+	}
+
+	for i := range names {
+		indexes <- i
+	}
+
+	close(indexes)
+	wg.Wait()
+
+	var errs []error
+
+	for _, r := range results {
+		if r.Err != nil {
+			errs = append(errs, r.Err)
+		}
+	}
+
+	return results, errors.Join(errs...)
+}
+
+func greetAt(ctx context.Context, i int, name string, greet func(string) (string, error)) Result {
+	r := Result{Index: i, Name: name}
+
+	err := ctx.Err()
+	if err == nil {
+		r.Message, err = greet(name)
+	}
+
+	if err != nil {
+		r.Err = &NameError{Index: i, Name: name, Err: err}
+	}
+
+	return r
+}
+
+// HelloAll greets names concurrently with the default Greeter. See
+// Greeter.GreetAll.
+func HelloAll(ctx context.Context, names []string, workers int) ([]Result, error) {
+	return Default().GreetAll(ctx, names, workers)
+}
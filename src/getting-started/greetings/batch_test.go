@@ -0,0 +1,171 @@
+package greetings
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"text/template"
+	"time"
+)
+
+// TestGreetAll greets a batch with empty names in it, checking that the
+// other names are still greeted and the errors say which names failed.
+func TestGreetAll(t *testing.T) {
+	g := newTestGreeter(t, WithTemplates(TemplateList{{Text: "Hi, {{.Name}}"}}))
+
+	names := []string{"Priscilla", "", "Rem", "", "Emilia"}
+
+	results, err := g.GreetAll(context.Background(), names, 2)
+
+	if len(results) != len(names) {
+		t.Fatalf("GreetAll() = %d results, want %d", len(results), len(names))
+	}
+
+	for i, r := range results {
+		if r.Index != i || r.Name != names[i] {
+			t.Errorf("results[%d] = %d %q, want %d %q", i, r.Index, r.Name, i, names[i])
+		}
+
+		if names[i] != "" && (r.Message != "Hi, "+names[i] || r.Err != nil) {
+			t.Errorf("results[%d] = %q, %v, want a greeting", i, r.Message, r.Err)
+		}
+	}
+
+	var nameErr *NameError
+
+	if !errors.As(results[3].Err, &nameErr) || nameErr.Index != 3 || !errors.Is(nameErr, ErrEmptyName) {
+		t.Errorf("results[3].Err = %v, want a NameError for index 3", results[3].Err)
+	}
+
+	joined, ok := err.(interface{ Unwrap() []error })
+
+	if !ok || len(joined.Unwrap()) != 2 || !errors.Is(err, ErrEmptyName) {
+		t.Errorf("GreetAll() error = %v, want both empty names joined", err)
+	}
+}
+
+// TestGreetAllWorkers checks that no more than the given number of names
+// are greeted at once.
+func TestGreetAllWorkers(t *testing.T) {
+	var running, peak atomic.Int32
+
+	slow := template.FuncMap{
+		"slow": func(name string) string {
+			n := running.Add(1)
+			defer running.Add(-1)
+
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+
+			time.Sleep(5 * time.Millisecond)
+
+			return name
+		},
+	}
+
+	g := newTestGreeter(t, WithTemplates(TemplateList{{Text: "{{slow .Name}}"}}), WithFuncs(slow))
+
+	names := make([]string, 20)
+
+	for i := range names {
+		names[i] = "Rem"
+	}
+
+	if _, err := g.GreetAll(context.Background(), names, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := peak.Load(); got != 3 {
+		t.Errorf("greeted %d names at once, want 3", got)
+	}
+}
+
+// TestGreetAllFunc checks that GreetAllFunc greets every name with the
+// given function and keeps the results in order.
+func TestGreetAllFunc(t *testing.T) {
+	errNope := errors.New("nope")
+
+	greet := func(name string) (string, error) {
+		if name == "Rem" {
+			return "", errNope
+		}
+
+		return "Hello, " + name, nil
+	}
+
+	names := []string{"Priscilla", "Rem", "Emilia"}
+
+	results, err := GreetAllFunc(context.Background(), names, 2, greet)
+	if !errors.Is(err, errNope) {
+		t.Errorf("GreetAllFunc() error = %v, want %v", err, errNope)
+	}
+
+	for i, r := range results {
+		want := "Hello, " + names[i]
+
+		if names[i] == "Rem" {
+			want = ""
+		}
+
+		if r.Name != names[i] || r.Message != want {
+			t.Errorf("results[%d] = %q %q, want %q %q", i, r.Name, r.Message, names[i], want)
+		}
+	}
+}
+
+// TestGreetAllCancel checks that the names left when the context is done
+// fail with its error.
+func TestGreetAllCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var once sync.Once
+
+	stop := template.FuncMap{
+		"stop": func(name string) string {
+			once.Do(cancel)
+			return name
+		},
+	}
+
+	g := newTestGreeter(t, WithTemplates(TemplateList{{Text: "{{stop .Name}}"}}), WithFuncs(stop))
+
+	results, err := g.GreetAll(ctx, []string{"Rem", "Ram", "Emilia", "Beatrice"}, 1)
+
+	if results[0].Message != "Rem" || results[0].Err != nil {
+		t.Errorf("results[0] = %q, %v, want the greeting before the cancel", results[0].Message, results[0].Err)
+	}
+
+	for _, r := range results[1:] {
+		if !errors.Is(r.Err, context.Canceled) {
+			t.Errorf("results[%d].Err = %v, want context.Canceled", r.Index, r.Err)
+		}
+	}
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("GreetAll() error = %v, want context.Canceled", err)
+	}
+}
+
+// TestHellosRandomError checks that HellosRandomError stops at the first
+// name it cannot greet, with the error of that name alone.
+func TestHellosRandomError(t *testing.T) {
+	messages, err := HellosRandomError([]string{"Priscilla", "Rem"})
+	if err != nil || len(messages) != 2 || messages["Rem"] == "" {
+		t.Errorf("HellosRandomError() = %v, %v, want two greetings", messages, err)
+	}
+
+	messages, err = HellosRandomError([]string{"Rem", "", "Ram1"})
+	if messages != nil || !errors.Is(err, ErrEmptyName) || err.Error() != "empty name" {
+		t.Errorf("HellosRandomError() = %v, %v, want nil, empty name", messages, err)
+	}
+
+	if _, err := HelloAll(context.Background(), nil, 0); err != nil {
+		t.Errorf("HelloAll(nil) error = %v, want nil", err)
+	}
+}
@@ -0,0 +1,300 @@
+package greetings
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+
+	"golang.org/x/text/feature/plural"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// locales holds the catalogs of the default Catalog, one file per language.
+//
+//go:embed locales/*.json
+var locales embed.FS
+
+var defaultCatalog = mustLoadDefaultCatalog()
+
+func mustLoadDefaultCatalog() *Catalog {
+	fsys, err := fs.Sub(locales, "locales")
+	if err != nil {
+		panic(err)
+	}
+
+	c, err := LoadCatalog(fsys)
+	if err != nil {
+		panic(err)
+	}
+
+	return c
+}
+
+// DefaultCatalog returns the catalog built into the package.
+func DefaultCatalog() *Catalog {
+	return defaultCatalog
+}
+
+// Gender picks between the forms of a greeting in languages where it
+// depends on the person greeted.
+type Gender int
+
+const (
+	// Unspecified picks the neutral form.
+	Unspecified Gender = iota
+	Female
+	Male
+)
+
+// String returns the catalog key of g: "other", "female" or "male".
+func (g Gender) String() string {
+	switch g {
+	case Female:
+		return "female"
+	case Male:
+		return "male"
+	default:
+		return "other"
+	}
+}
+
+// pluralForms names the CLDR plural categories as they appear in catalogs.
+var pluralForms = map[plural.Form]string{
+	plural.Zero:  "zero",
+	plural.One:   "one",
+	plural.Two:   "two",
+	plural.Few:   "few",
+	plural.Many:  "many",
+	plural.Other: "other",
+}
+
+// UnsupportedLocaleError is returned for a locale that no language of a
+// Catalog matches.
+type UnsupportedLocaleError struct {
+	Locale string
+
+	// Err is why the locale could not be parsed, if it is not valid BCP 47.
+	Err error
+}
+
+func (e *UnsupportedLocaleError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("unsupported locale %q: %v", e.Locale, e.Err)
+	}
+
+	return fmt.Sprintf("unsupported locale %q", e.Locale)
+}
+
+func (e *UnsupportedLocaleError) Unwrap() error {
+	return e.Err
+}
+
+// Messages are the greetings of one language.
+type Messages struct {
+	// Hello holds the formats of a greeting for one person by gender:
+	// "other", "female" or "male". Each format has a %v verb for the name.
+	// "other" is required, and is used for a gender that is missing.
+	Hello map[string][]string `json:"hello"`
+
+	// Group holds the format of a greeting for a group by CLDR plural
+	// category: "zero", "one", "two", "few", "many" or "other". Each format
+	// has a %d verb for the number of people. "other" is required, and is
+	// used for a category that is missing.
+	Group map[string]string `json:"group"`
+}
+
+func (m *Messages) validate() error {
+	if len(m.Hello["other"]) == 0 {
+		return errors.New(`no "other" hello formats`)
+	}
+
+	for key, formats := range m.Hello {
+		if key != Unspecified.String() && key != Female.String() && key != Male.String() {
+			return fmt.Errorf("unknown gender %q", key)
+		}
+
+		if slices.Contains(formats, "") {
+			return fmt.Errorf("empty %q hello format", key)
+		}
+	}
+
+	if m.Group["other"] == "" {
+		return errors.New(`no "other" group format`)
+	}
+
+	for key := range m.Group {
+		if !slices.Contains(slices.Collect(maps.Values(pluralForms)), key) {
+			return fmt.Errorf("unknown plural category %q", key)
+		}
+	}
+
+	return nil
+}
+
+// Catalog holds greetings in several languages, and picks the language
+// for a locale with BCP 47 matching, so that "en-AU" gets English and
+// "pt-BR" gets Portuguese if there is no Brazilian Portuguese.
+type Catalog struct {
+	tags     []language.Tag
+	messages []*Messages
+	matcher  language.Matcher
+}
+
+// LoadCatalog reads a catalog from the JSON files in the root of fsys. Each
+// file holds the Messages of the language its name is the BCP 47 tag of,
+// such as "pt-BR.json".
+func LoadCatalog(fsys fs.FS) (*Catalog, error) {
+	names, err := fs.Glob(fsys, "*.json")
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Catalog{}
+
+	for _, name := range names {
+		tag, err := language.Parse(strings.TrimSuffix(name, path.Ext(name)))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+
+		var m Messages
+
+		if err := dec.Decode(&m); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+
+		if err := m.validate(); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+
+		c.tags = append(c.tags, tag)
+		c.messages = append(c.messages, &m)
+	}
+
+	if len(c.tags) == 0 {
+		return nil, errors.New("no catalog files")
+	}
+
+	c.matcher = language.NewMatcher(c.tags)
+
+	return c, nil
+}
+
+// Languages returns the languages of the catalog.
+func (c *Catalog) Languages() []language.Tag {
+	return slices.Clone(c.tags)
+}
+
+// Match returns the language of the catalog that best matches locale. The
+// locale is a BCP 47 tag such as "pt-BR", or an Accept-Language list such
+// as "fr-CH, fr;q=0.9, en;q=0.8".
+func (c *Catalog) Match(locale string) (language.Tag, error) {
+	tag, _, err := c.match(locale)
+	return tag, err
+}
+
+func (c *Catalog) match(locale string) (language.Tag, *Messages, error) {
+	tags, _, err := language.ParseAcceptLanguage(locale)
+	if err != nil {
+		return language.Und, nil, &UnsupportedLocaleError{Locale: locale, Err: err}
+	}
+
+	if len(tags) == 0 {
+		return language.Und, nil, &UnsupportedLocaleError{Locale: locale}
+	}
+
+	_, i, confidence := c.matcher.Match(tags...)
+
+	if confidence == language.No {
+		return language.Und, nil, &UnsupportedLocaleError{Locale: locale}
+	}
+
+	return c.tags[i], c.messages[i], nil
+}
+
+// Hello returns a random greeting for the named person in the language
+// that best matches locale, picked and recorded by the default Greeter.
+func (c *Catalog) Hello(locale string, name string, gender Gender) (string, error) {
+	return Default().GreetIn(c, locale, name, gender)
+}
+
+// GreetIn returns a greeting for the named person in the language of c
+// that best matches locale, once the name passes the Validator of the
+// Greeter, and records it. The format is picked with the Selector and
+// randomness of the Greeter, so a seeded Greeter greets the same way every
+// time.
+func (g *Greeter) GreetIn(c *Catalog, locale string, name string, gender Gender) (string, error) {
+	name, err := g.validate(name)
+	if err != nil {
+		return "", err
+	}
+
+	tag, m, err := c.match(locale)
+	if err != nil {
+		return "", err
+	}
+
+	formats := m.hello(gender)
+	format := formats[g.pickOf(len(formats))]
+
+	record(g.recorder, Entry{Name: name, Format: format, Locale: tag.String()})
+
+	return message.NewPrinter(tag).Sprintf(format, name), nil
+}
+
+func (m *Messages) hello(gender Gender) []string {
+	if formats := m.Hello[gender.String()]; len(formats) > 0 {
+		return formats
+	}
+
+	return m.Hello[Unspecified.String()]
+}
+
+// HelloGroup returns a greeting for a group of count people, such as
+// "Hi, 3 people", following the plural rules of the language that best
+// matches locale.
+func (c *Catalog) HelloGroup(locale string, count int) (string, error) {
+	if count < 0 {
+		return "", fmt.Errorf("negative count %d", count)
+	}
+
+	tag, m, err := c.match(locale)
+	if err != nil {
+		return "", err
+	}
+
+	format, ok := m.Group[pluralForms[plural.Cardinal.MatchPlural(tag, count, 0, 0, 0, 0)]]
+	if !ok {
+		format = m.Group["other"]
+	}
+
+	return message.NewPrinter(tag).Sprintf(format, count), nil
+}
+
+// HelloIn returns a random greeting for the named person in the language
+// of the default catalog that best matches locale.
+func HelloIn(locale string, name string) (string, error) {
+	return defaultCatalog.Hello(locale, name, Unspecified)
+}
+
+// HelloGroupIn returns a greeting for a group of count people in the
+// language of the default catalog that best matches locale.
+func HelloGroupIn(locale string, count int) (string, error) {
+	return defaultCatalog.HelloGroup(locale, count)
+}
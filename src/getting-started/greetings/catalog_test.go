@@ -0,0 +1,223 @@
+package greetings
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"testing/fstest"
+)
+
+// TestHelloIn calls greetings.HelloIn with several locales, checking that
+// each one falls back to the closest language of the catalog.
+func TestHelloIn(t *testing.T) {
+	tests := []struct {
+		locale string
+		want   string
+	}{
+		{"en", "en"},
+		{"en-AU", "en"},
+		{"es-MX", "es"},
+		{"fr-CH, fr;q=0.9, en;q=0.8", "fr"},
+		{"it, de;q=0.5", "de"},
+		{"ja-JP", "ja"},
+		{"ru", "ru"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.locale, func(t *testing.T) {
+			msg, err := HelloIn(tt.locale, "Gladys")
+			if err != nil {
+				t.Fatalf("HelloIn(%q) error = %v", tt.locale, err)
+			}
+
+			_, m, _ := defaultCatalog.match(tt.want)
+
+			if !slices.Contains(formatAll(m.Hello["other"], "Gladys"), msg) {
+				t.Errorf("HelloIn(%q) = %q, want a %s greeting for Gladys", tt.locale, msg, tt.want)
+			}
+		})
+	}
+}
+
+// TestGreetInSeed checks that a seeded Greeter picks the same localized
+// greetings every time, and that HelloIn picks through the default Greeter.
+func TestGreetInSeed(t *testing.T) {
+	greetIn := func(g *Greeter) []string {
+		var messages []string
+
+		for range 20 {
+			msg, err := g.GreetIn(DefaultCatalog(), "fr", "Rem", Unspecified)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			messages = append(messages, msg)
+		}
+
+		return messages
+	}
+
+	a := greetIn(newTestGreeter(t, WithSeed(42)))
+	b := greetIn(newTestGreeter(t, WithSeed(42)))
+
+	if !slices.Equal(a, b) {
+		t.Errorf("seeded greetings differ:\n%q\n%q", a, b)
+	}
+
+	old := Default()
+	defer SetDefault(old)
+
+	SetDefault(newTestGreeter(t, WithSeed(42)))
+
+	for i, want := range a {
+		if msg, err := HelloIn("fr", "Rem"); err != nil || msg != want {
+			t.Fatalf("HelloIn() #%d = %q, %v, want %q", i, msg, err, want)
+		}
+	}
+}
+
+func formatAll(formats []string, name string) []string {
+	var messages []string
+
+	for _, format := range formats {
+		messages = append(messages, fmt.Sprintf(format, name))
+	}
+
+	return messages
+}
+
+// TestHelloGender calls Catalog.Hello with a gender, checking that it uses
+// the gendered forms where a language has them.
+func TestHelloGender(t *testing.T) {
+	c := DefaultCatalog()
+
+	msg, err := c.Hello("es", "Emilia", Female)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, m, _ := c.match("es")
+
+	if !slices.Contains(formatAll(m.Hello["female"], "Emilia"), msg) {
+		t.Errorf(`Hello("es", "Emilia", Female) = %q, want a female greeting`, msg)
+	}
+
+	// German has no gendered greetings, so it falls back to the neutral ones.
+	msg, err = c.Hello("de", "Rem", Male)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, m, _ = c.match("de")
+
+	if !slices.Contains(formatAll(m.Hello["other"], "Rem"), msg) {
+		t.Errorf(`Hello("de", "Rem", Male) = %q, want a neutral greeting`, msg)
+	}
+}
+
+// TestHelloGroupIn checks the plural rules and number formatting of each
+// language.
+func TestHelloGroupIn(t *testing.T) {
+	tests := []struct {
+		locale string
+		count  int
+		want   string
+	}{
+		{"en", 1, "Hi, 1 person"},
+		{"en", 3, "Hi, 3 people"},
+		{"en", 0, "Hi, 0 people"},
+		{"en-GB", 1000, "Hi, 1,000 people"},
+		{"de", 1000, "Hallo, 1.000 Personen"},
+		{"fr", 0, "Bonjour, 0 personne"},
+		{"fr", 2, "Bonjour, 2 personnes"},
+		{"ru", 1, "Привет, 1 человек"},
+		{"ru", 3, "Привет, 3 человека"},
+		{"ru", 5, "Привет, 5 человек"},
+		{"ru", 22, "Привет, 22 человека"},
+		{"ja", 1, "こんにちは、1人のみなさん"},
+	}
+
+	for _, tt := range tests {
+		got, err := HelloGroupIn(tt.locale, tt.count)
+		if got != tt.want || err != nil {
+			t.Errorf("HelloGroupIn(%q, %d) = %q, %v, want %q, nil", tt.locale, tt.count, got, err, tt.want)
+		}
+	}
+
+	if _, err := HelloGroupIn("en", -1); err == nil {
+		t.Errorf("HelloGroupIn(en, -1) error = nil, want an error")
+	}
+}
+
+// TestHelloInUnsupported calls greetings.HelloIn with locales the catalog
+// has no language for, checking for an UnsupportedLocaleError.
+func TestHelloInUnsupported(t *testing.T) {
+	tests := []struct {
+		locale    string
+		wantParse bool
+	}{
+		{"pt-BR", false},
+		{"", false},
+		{"not a locale", true},
+	}
+
+	for _, tt := range tests {
+		msg, err := HelloIn(tt.locale, "Gladys")
+
+		var localeErr *UnsupportedLocaleError
+
+		if msg != "" || !errors.As(err, &localeErr) || localeErr.Locale != tt.locale || (localeErr.Err != nil) != tt.wantParse {
+			t.Errorf("HelloIn(%q) = %q, %v, want an UnsupportedLocaleError", tt.locale, msg, err)
+		}
+	}
+
+	if _, err := HelloIn("en", ""); err == nil {
+		t.Errorf(`HelloIn("en", "") error = nil, want an error`)
+	}
+}
+
+// TestLoadCatalog loads catalogs from files, checking that broken ones are
+// rejected.
+func TestLoadCatalog(t *testing.T) {
+	valid := `{"hello": {"other": ["Ciao, %v!"]}, "group": {"one": "Ciao, %d persona", "other": "Ciao, %d persone"}}`
+
+	c, err := LoadCatalog(fstest.MapFS{"it.json": {Data: []byte(valid)}, "README": {}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tags := c.Languages(); len(tags) != 1 || tags[0].String() != "it" {
+		t.Errorf("Languages() = %v, want [it]", tags)
+	}
+
+	if msg, _ := c.HelloGroup("it-CH", 2); msg != "Ciao, 2 persone" {
+		t.Errorf(`HelloGroup("it-CH", 2) = %q, want "Ciao, 2 persone"`, msg)
+	}
+
+	tests := []struct {
+		name string
+		file string
+		data string
+	}{
+		{"bad tag", "1.json", valid},
+		{"bad json", "it.json", `{"hello": `},
+		{"unknown field", "it.json", `{"hello": {"other": ["Ciao, %v!"]}, "group": {"other": "Ciao"}, "bye": {}}`},
+		{"no hello", "it.json", `{"group": {"other": "Ciao, %d"}}`},
+		{"no group", "it.json", `{"hello": {"other": ["Ciao, %v!"]}}`},
+		{"unknown gender", "it.json", `{"hello": {"other": ["Ciao, %v!"], "robot": ["Bip"]}, "group": {"other": "Ciao, %d"}}`},
+		{"unknown plural", "it.json", `{"hello": {"other": ["Ciao, %v!"]}, "group": {"other": "Ciao, %d", "lots": "Ciao"}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := LoadCatalog(fstest.MapFS{tt.file: {Data: []byte(tt.data)}}); err == nil {
+				t.Errorf("LoadCatalog() error = nil, want an error")
+			}
+		})
+	}
+
+	if _, err := LoadCatalog(fstest.MapFS{}); err == nil {
+		t.Errorf("LoadCatalog(empty) error = nil, want an error")
+	}
+}
@@ -0,0 +1,258 @@
+package greetings
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"strings"
+	"text/template"
+	"time"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// PartOfDay is the part of the day it is for someone.
+type PartOfDay int
+
+const (
+	// Morning is from 5:00 to 12:00.
+	Morning PartOfDay = iota
+
+	// Afternoon is from 12:00 to 18:00.
+	Afternoon
+
+	// Evening is from 18:00 to 5:00.
+	Evening
+)
+
+// PartOfDayAt returns the part of the day of t, in the location of t.
+func PartOfDayAt(t time.Time) PartOfDay {
+	switch h := t.Hour(); {
+	case h >= 5 && h < 12:
+		return Morning
+	case h >= 12 && h < 18:
+		return Afternoon
+	}
+
+	return Evening
+}
+
+func (p PartOfDay) String() string {
+	switch p {
+	case Morning:
+		return "morning"
+	case Afternoon:
+		return "afternoon"
+	}
+
+	return "evening"
+}
+
+// Greeting returns how to greet someone in p, such as "Good morning".
+func (p PartOfDay) Greeting() string {
+	return "Good " + p.String()
+}
+
+// ContextData is what the templates of a ContextualGreeter are executed
+// with.
+type ContextData struct {
+	Name string
+
+	// Greeting is the greeting of the part of the day, such as
+	// "Good morning".
+	Greeting string
+
+	// Time is the time for the person greeted.
+	Time time.Time
+}
+
+// UnknownTimeZoneError is returned for a time zone that is not in the IANA
+// time zone database.
+type UnknownTimeZoneError struct {
+	Zone string
+	Err  error
+}
+
+func (e *UnknownTimeZoneError) Error() string {
+	return fmt.Sprintf("unknown time zone %q", e.Zone)
+}
+
+func (e *UnknownTimeZoneError) Unwrap() error {
+	return e.Err
+}
+
+// CalendarEntry overrides the greeting of a date, such as a holiday or the
+// birthday of someone.
+type CalendarEntry struct {
+	// Date is "MM-DD" for every year, or "YYYY-MM-DD" for one day.
+	Date string `json:"date"`
+
+	// Name, if set, limits the entry to the named person.
+	Name string `json:"name,omitempty"`
+
+	// Text is the template of the greeting, executed with a ContextData.
+	Text string `json:"text"`
+
+	tmpl *template.Template
+}
+
+// Calendar holds the greetings of special dates.
+type Calendar struct {
+	entries []*CalendarEntry
+}
+
+// NewCalendar returns a calendar of entries. It fails if a date or a
+// template is invalid.
+func NewCalendar(entries []CalendarEntry) (*Calendar, error) {
+	c := &Calendar{}
+
+	for _, e := range entries {
+		if _, err := time.Parse("2006-01-02", e.Date); err != nil {
+			if _, err := time.Parse("01-02", e.Date); err != nil {
+				return nil, fmt.Errorf("calendar date %q: want MM-DD or YYYY-MM-DD", e.Date)
+			}
+		}
+
+		tmpl, err := template.New(e.Date).Funcs(helperFuncs).Parse(e.Text)
+		if err != nil {
+			return nil, fmt.Errorf("calendar date %s: %w", e.Date, err)
+		}
+
+		e.Name = norm.NFC.String(strings.TrimSpace(e.Name))
+		e.tmpl = tmpl
+		c.entries = append(c.entries, &e)
+	}
+
+	return c, nil
+}
+
+// LoadCalendar reads a calendar from the file name in fsys, which holds a
+// JSON array of CalendarEntries.
+func LoadCalendar(fsys fs.FS, name string) (*Calendar, error) {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []CalendarEntry
+
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	c, err := NewCalendar(entries)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	return c, nil
+}
+
+// Lookup returns the entry for the named person on the day of t, in the
+// location of t. An entry for the person comes first, then one for that
+// day of that year, then one for that day of every year.
+func (c *Calendar) Lookup(t time.Time, name string) (*CalendarEntry, bool) {
+	day, yearly := t.Format("2006-01-02"), t.Format("01-02")
+
+	var best *CalendarEntry
+	bestRank := 0
+
+	for _, e := range c.entries {
+		if e.Name != "" && e.Name != name || e.Date != day && e.Date != yearly {
+			continue
+		}
+
+		rank := 1
+
+		if e.Date == day {
+			rank++
+		}
+
+		if e.Name != "" {
+			rank += 2
+		}
+
+		if rank > bestRank {
+			best, bestRank = e, rank
+		}
+	}
+
+	return best, best != nil
+}
+
+// defaultContextText is the template of a ContextualGreeter on a day
+// without a calendar entry.
+const defaultContextText = "{{.Greeting}}, {{.Name}}!"
+
+var defaultContextTemplate = template.Must(template.New("context").Funcs(helperFuncs).Parse(defaultContextText))
+
+// ContextualGreeter greets people for the time of day it is where they
+// are, and with the greeting of a Calendar on special dates. It is safe
+// for concurrent use as long as its fields are not changed.
+type ContextualGreeter struct {
+	// Now returns the current time, time.Now if nil.
+	Now func() time.Time
+
+	// Calendar, if set, overrides the greeting of special dates.
+	Calendar *Calendar
+
+	// Validator checks names instead of the default Validator, if set.
+	Validator *Validator
+
+	// Recorder records greetings instead of the default Recorder, if set.
+	Recorder Recorder
+}
+
+// NewContextualGreeter returns a ContextualGreeter on the system clock,
+// without a calendar.
+func NewContextualGreeter() *ContextualGreeter {
+	return &ContextualGreeter{Now: time.Now}
+}
+
+// Greet returns a greeting for the named person in the IANA time zone
+// zone, such as "Asia/Tokyo", or UTC if zone is "". It fails if the name
+// is invalid or the zone unknown.
+func (c *ContextualGreeter) Greet(name, zone string) (string, error) {
+	name, err := validate(c.Validator, name)
+	if err != nil {
+		return "", err
+	}
+
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		return "", &UnknownTimeZoneError{Zone: zone, Err: err}
+	}
+
+	clock := c.Now
+	if clock == nil {
+		clock = time.Now
+	}
+
+	now := clock().In(loc)
+
+	tmpl, text := defaultContextTemplate, defaultContextText
+
+	if c.Calendar != nil {
+		if e, ok := c.Calendar.Lookup(now, name); ok {
+			tmpl, text = e.tmpl, e.Text
+		}
+	}
+
+	var b strings.Builder
+
+	data := ContextData{Name: name, Greeting: PartOfDayAt(now).Greeting(), Time: now}
+
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+
+	record(c.Recorder, Entry{Time: now, Name: name, Format: text})
+
+	return b.String(), nil
+}
+
+// HelloAt returns a greeting for the named person for the time of day it
+// is in the IANA time zone zone. See ContextualGreeter.Greet.
+func HelloAt(name, zone string) (string, error) {
+	return NewContextualGreeter().Greet(name, zone)
+}
@@ -0,0 +1,174 @@
+package greetings
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// fakeClock returns a clock stopped at t.
+func fakeClock(t time.Time) func() time.Time {
+	return func() time.Time { return t }
+}
+
+// utc returns the time on 2026-03-14 at hour:minute UTC.
+func utc(hour, minute int) time.Time {
+	return time.Date(2026, 3, 14, hour, minute, 0, 0, time.UTC)
+}
+
+// TestContextualGreet greets people in several time zones at the same
+// instant, checking the part of the day it is for each of them.
+func TestContextualGreet(t *testing.T) {
+	tests := []struct {
+		now  time.Time
+		zone string
+		want string
+	}{
+		{utc(9, 0), "", "Good morning, Rem!"},
+		{utc(9, 0), "UTC", "Good morning, Rem!"},
+		{utc(9, 0), "Asia/Tokyo", "Good evening, Rem!"},
+		{utc(9, 0), "America/New_York", "Good morning, Rem!"},
+		{utc(9, 0), "America/Los_Angeles", "Good evening, Rem!"},
+		{utc(12, 0), "Europe/Paris", "Good afternoon, Rem!"},
+		{utc(4, 59), "UTC", "Good evening, Rem!"},
+		{utc(5, 0), "UTC", "Good morning, Rem!"},
+		{utc(11, 59), "UTC", "Good morning, Rem!"},
+		{utc(17, 59), "UTC", "Good afternoon, Rem!"},
+		{utc(18, 0), "UTC", "Good evening, Rem!"},
+		// Kathmandu is 5:45 ahead of UTC.
+		{utc(6, 14), "Asia/Kathmandu", "Good morning, Rem!"},
+		{utc(6, 15), "Asia/Kathmandu", "Good afternoon, Rem!"},
+	}
+
+	for _, tt := range tests {
+		g := NewContextualGreeter()
+		g.Now = fakeClock(tt.now)
+
+		if got, err := g.Greet("Rem", tt.zone); got != tt.want || err != nil {
+			t.Errorf("Greet(Rem, %q) at %v = %q, %v, want %q", tt.zone, tt.now, got, err, tt.want)
+		}
+	}
+
+	// Without a clock, it greets for the current time.
+	if _, err := (&ContextualGreeter{}).Greet("Rem", "UTC"); err != nil {
+		t.Errorf("Greet(Rem, UTC) without a clock error = %v", err)
+	}
+}
+
+// TestContextualDST checks that the part of the day follows daylight
+// saving time: 9:30 UTC is 4:30 in New York before the clocks go forward
+// on 2026-03-08, but 5:30 after.
+func TestContextualDST(t *testing.T) {
+	g := NewContextualGreeter()
+
+	for _, tt := range []struct {
+		now  time.Time
+		want string
+	}{
+		{time.Date(2026, 3, 7, 9, 30, 0, 0, time.UTC), "Good evening, Rem!"},
+		{time.Date(2026, 3, 9, 9, 30, 0, 0, time.UTC), "Good morning, Rem!"},
+	} {
+		g.Now = fakeClock(tt.now)
+
+		if got, _ := g.Greet("Rem", "America/New_York"); got != tt.want {
+			t.Errorf("Greet() at %v = %q, want %q", tt.now, got, tt.want)
+		}
+	}
+}
+
+const testCalendar = `[
+	{"date": "12-25", "text": "Merry Christmas, {{.Name}}!"},
+	{"date": "2026-12-25", "text": "{{.Greeting}} and merry Christmas, {{.Name}}!"},
+	{"date": "12-25", "name": "Emilia", "text": "Merry Christmas, Lady {{.Name}}!"},
+	{"date": "02-02", "name": "Emilia", "text": "Happy birthday, {{first .Name}}!"},
+	{"date": "01-01", "text": "Happy new year, {{upper .Name}}!"}
+]`
+
+// TestContextualCalendar checks the overrides of a calendar, and that they
+// follow the date where the person greeted is.
+func TestContextualCalendar(t *testing.T) {
+	cal, err := LoadCalendar(fstest.MapFS{"calendar.json": {Data: []byte(testCalendar)}}, "calendar.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		now  time.Time
+		zone string
+		name string
+		want string
+	}{
+		{time.Date(2025, 12, 25, 10, 0, 0, 0, time.UTC), "UTC", "Rem", "Merry Christmas, Rem!"},
+		{time.Date(2026, 12, 25, 10, 0, 0, 0, time.UTC), "UTC", "Rem", "Good morning and merry Christmas, Rem!"},
+		{time.Date(2026, 12, 25, 10, 0, 0, 0, time.UTC), "UTC", "Emilia", "Merry Christmas, Lady Emilia!"},
+		{time.Date(2026, 2, 2, 10, 0, 0, 0, time.UTC), "UTC", "Emilia Tan", "Good morning, Emilia Tan!"},
+		{time.Date(2026, 2, 2, 10, 0, 0, 0, time.UTC), "UTC", "Emilia", "Happy birthday, Emilia!"},
+		{time.Date(2026, 2, 2, 10, 0, 0, 0, time.UTC), "UTC", "Rem", "Good morning, Rem!"},
+		// It is already new year in Tokyo, but not in London.
+		{time.Date(2026, 12, 31, 16, 0, 0, 0, time.UTC), "Asia/Tokyo", "Rem", "Happy new year, REM!"},
+		{time.Date(2026, 12, 31, 16, 0, 0, 0, time.UTC), "Europe/London", "Rem", "Good afternoon, Rem!"},
+	}
+
+	for _, tt := range tests {
+		g := &ContextualGreeter{Now: fakeClock(tt.now), Calendar: cal}
+
+		if got, err := g.Greet(tt.name, tt.zone); got != tt.want || err != nil {
+			t.Errorf("Greet(%q, %q) at %v = %q, %v, want %q", tt.name, tt.zone, tt.now, got, err, tt.want)
+		}
+	}
+}
+
+// TestContextualErrors checks invalid names, zones and calendars.
+func TestContextualErrors(t *testing.T) {
+	g := &ContextualGreeter{Now: fakeClock(utc(9, 0))}
+
+	var zoneErr *UnknownTimeZoneError
+
+	if _, err := g.Greet("Rem", "Mars/Olympus_Mons"); !errors.As(err, &zoneErr) || zoneErr.Zone != "Mars/Olympus_Mons" {
+		t.Errorf("Greet() with an unknown zone error = %v, want an UnknownTimeZoneError", err)
+	}
+
+	if _, err := g.Greet(" ", "UTC"); !errors.Is(err, ErrEmptyName) {
+		t.Errorf("Greet() with an empty name error = %v, want ErrEmptyName", err)
+	}
+
+	for _, entries := range [][]CalendarEntry{
+		{{Date: "2026-02-30", Text: "Hi"}},
+		{{Date: "12/25", Text: "Hi"}},
+		{{Date: "12-25", Text: "{{.Name"}},
+	} {
+		if _, err := NewCalendar(entries); err == nil {
+			t.Errorf("NewCalendar(%v) error = nil, want an error", entries)
+		}
+	}
+
+	if _, err := LoadCalendar(fstest.MapFS{"calendar.json": {Data: []byte(`{}`)}}, "calendar.json"); err == nil {
+		t.Errorf("LoadCalendar() of an object error = nil, want an error")
+	}
+
+	if _, err := NewCalendar([]CalendarEntry{{Date: "02-29", Text: "Leap day!"}}); err != nil {
+		t.Errorf("NewCalendar() with 02-29 error = %v, want nil", err)
+	}
+}
+
+// TestContextualRecord checks that greetings are recorded at the time of
+// the clock.
+func TestContextualRecord(t *testing.T) {
+	h, _ := openTestHistory(t)
+
+	g := &ContextualGreeter{Now: fakeClock(utc(9, 0)), Recorder: h}
+
+	if _, err := g.Greet("Rem", "Asia/Tokyo"); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := h.Entries(Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 1 || !entries[0].Time.Equal(utc(9, 0)) || entries[0].Format != defaultContextText {
+		t.Errorf("entries = %v, want Rem at 9:00 UTC", entries)
+	}
+}
@@ -0,0 +1,481 @@
+package greetings
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// Variant is one greeting of an experiment, and its share of the names
+// relative to the other variants. A nil Weight counts as 1, and a variant
+// with a zero Weight is never assigned.
+type Variant struct {
+	Name     string   `json:"name"`
+	Template string   `json:"template"`
+	Weight   *float64 `json:"weight,omitempty"`
+}
+
+// Exposure is a name greeted with a variant of an experiment.
+type Exposure struct {
+	Time       time.Time `json:"time"`
+	Experiment string    `json:"experiment"`
+	Variant    string    `json:"variant"`
+	Name       string    `json:"name"`
+}
+
+// ExposureLogger logs the exposures of experiments.
+type ExposureLogger interface {
+	LogExposure(x Exposure) error
+}
+
+// Experiment greets every name with one of its variants, always the same
+// one for the same name. Names are bucketed by hashing them with the name
+// of the experiment, so a name gets unrelated variants in different
+// experiments. It is safe for concurrent use as long as its fields are not
+// changed.
+type Experiment struct {
+	// Log, if set, logs every greeting. Greeting does not fail when
+	// logging does; an ExposureLogger keeps its own errors, as ExposureLog
+	// does.
+	Log ExposureLogger
+
+	// Validator checks names instead of the default Validator, if set.
+	Validator *Validator
+
+	// Recorder records greetings instead of the default Recorder, if set.
+	Recorder Recorder
+
+	// Now returns the time of exposures, time.Now if nil.
+	Now func() time.Time
+
+	name      string
+	variants  []Variant
+	templates []*template.Template
+
+	// bounds are the cumulative shares of the variants, the last one 1.
+	bounds []float64
+}
+
+// NewExperiment returns the experiment name with variants. It fails if
+// there are no variants, two have the same name, a weight is negative or
+// not finite, no weight is positive or a template does not parse.
+func NewExperiment(name string, variants []Variant) (*Experiment, error) {
+	if name == "" {
+		return nil, errors.New("experiment has no name")
+	}
+
+	if len(variants) == 0 {
+		return nil, fmt.Errorf("experiment %s: no variants", name)
+	}
+
+	e := &Experiment{Now: time.Now, name: name}
+
+	seen := make(map[string]bool)
+
+	var total float64
+
+	for _, v := range variants {
+		if v.Name == "" || seen[v.Name] {
+			return nil, fmt.Errorf("experiment %s: variant name %q is empty or used twice", name, v.Name)
+		}
+
+		seen[v.Name] = true
+
+		weight := 1.0
+
+		if v.Weight != nil {
+			weight = *v.Weight
+		}
+
+		if weight < 0 || math.IsNaN(weight) || math.IsInf(weight, 0) {
+			return nil, fmt.Errorf("experiment %s: variant %s: weight %v is negative or not finite", name, v.Name, weight)
+		}
+
+		tmpl, err := template.New(v.Name).Funcs(helperFuncs).Parse(v.Template)
+		if err != nil {
+			return nil, fmt.Errorf("experiment %s: %w", name, err)
+		}
+
+		v.Weight = &weight
+		total += weight
+
+		e.variants = append(e.variants, v)
+		e.templates = append(e.templates, tmpl)
+		e.bounds = append(e.bounds, total)
+	}
+
+	if total == 0 {
+		return nil, fmt.Errorf("experiment %s: no variant has a positive weight", name)
+	}
+
+	if math.IsInf(total, 0) {
+		return nil, fmt.Errorf("experiment %s: weights add up to more than a float64 holds", name)
+	}
+
+	// Every bound from the last weighted variant on is exactly 1, so
+	// rounding cannot hand names to zero weight variants after it.
+	for i := range e.bounds {
+		if e.bounds[i] == total {
+			e.bounds[i] = 1
+		} else {
+			e.bounds[i] /= total
+		}
+	}
+
+	return e, nil
+}
+
+// Name returns the name of the experiment.
+func (e *Experiment) Name() string {
+	return e.name
+}
+
+// Variants returns the variants of the experiment, with their weights
+// filled in.
+func (e *Experiment) Variants() []Variant {
+	return append([]Variant(nil), e.variants...)
+}
+
+// Assign returns the variant of the named person, which is the same every
+// time for the same experiment and name. The name is expected to be
+// validated already.
+func (e *Experiment) Assign(name string) Variant {
+	return e.variants[e.bucket(name)]
+}
+
+func (e *Experiment) bucket(name string) int {
+	sum := sha256.Sum256([]byte(e.name + "\x00" + name))
+
+	// The top 53 bits of the hash make a float64 in [0, 1).
+	x := float64(binary.BigEndian.Uint64(sum[:8])>>11) / (1 << 53)
+
+	for i, bound := range e.bounds {
+		if x < bound {
+			return i
+		}
+	}
+
+	return len(e.bounds) - 1
+}
+
+// Greet greets the named person with their variant, once the name is
+// validated, logs the exposure and records the greeting.
+func (e *Experiment) Greet(name string) (string, error) {
+	name, err := validate(e.Validator, name)
+	if err != nil {
+		return "", err
+	}
+
+	i := e.bucket(name)
+
+	var b strings.Builder
+
+	if err := e.templates[i].Execute(&b, TemplateData{Name: name}); err != nil {
+		return "", err
+	}
+
+	if e.Log != nil {
+		now := e.Now
+		if now == nil {
+			now = time.Now
+		}
+
+		_ = e.Log.LogExposure(Exposure{Time: now(), Experiment: e.name, Variant: e.variants[i].Name, Name: name})
+	}
+
+	record(e.Recorder, Entry{Name: name, Format: e.variants[i].Template})
+
+	return b.String(), nil
+}
+
+// ExposureLog is an ExposureLogger that writes exposures as JSON Lines. It
+// is safe for concurrent use.
+type ExposureLog struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	err error
+}
+
+// NewExposureLog returns an ExposureLog that writes to w.
+func NewExposureLog(w io.Writer) *ExposureLog {
+	return &ExposureLog{enc: json.NewEncoder(w)}
+}
+
+// LogExposure writes x. The first error is kept, and returned by Err.
+func (l *ExposureLog) LogExposure(x Exposure) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.err == nil {
+		l.err = l.enc.Encode(x)
+	}
+
+	return l.err
+}
+
+// Err returns the first error of LogExposure.
+func (l *ExposureLog) Err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.err
+}
+
+// ReadExposures reads exposures written by an ExposureLog, and counts the
+// exposures of each experiment.
+func ReadExposures(r io.Reader) (*ExposureCounter, error) {
+	c := NewExposureCounter()
+
+	scanner := bufio.NewScanner(r)
+
+	for n := 1; scanner.Scan(); n++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+
+		var x Exposure
+
+		if err := json.Unmarshal(scanner.Bytes(), &x); err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+
+		_ = c.LogExposure(x)
+	}
+
+	return c, scanner.Err()
+}
+
+// ExposureCounter is an ExposureLogger that counts exposures, and the
+// distinct names exposed, by experiment and variant. It is safe for
+// concurrent use.
+type ExposureCounter struct {
+	mu        sync.Mutex
+	exposures map[string]map[string]int
+	names     map[string]map[string]map[string]bool
+}
+
+// NewExposureCounter returns an ExposureCounter with no exposures.
+func NewExposureCounter() *ExposureCounter {
+	return &ExposureCounter{
+		exposures: make(map[string]map[string]int),
+		names:     make(map[string]map[string]map[string]bool),
+	}
+}
+
+// LogExposure counts x.
+func (c *ExposureCounter) LogExposure(x Exposure) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.exposures[x.Experiment] == nil {
+		c.exposures[x.Experiment] = make(map[string]int)
+		c.names[x.Experiment] = make(map[string]map[string]bool)
+	}
+
+	c.exposures[x.Experiment][x.Variant]++
+
+	if c.names[x.Experiment][x.Variant] == nil {
+		c.names[x.Experiment][x.Variant] = make(map[string]bool)
+	}
+
+	c.names[x.Experiment][x.Variant][x.Name] = true
+
+	return nil
+}
+
+// Exposures returns the number of exposures of each variant of experiment.
+func (c *ExposureCounter) Exposures(experiment string) map[string]int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	counts := make(map[string]int)
+
+	for v, n := range c.exposures[experiment] {
+		counts[v] = n
+	}
+
+	return counts
+}
+
+// Names returns the number of distinct names exposed to each variant of
+// experiment.
+func (c *ExposureCounter) Names(experiment string) map[string]int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	counts := make(map[string]int)
+
+	for v, names := range c.names[experiment] {
+		counts[v] = len(names)
+	}
+
+	return counts
+}
+
+// SampleRatioAlpha is the significance level under which a Report finds
+// the variants unbalanced.
+const SampleRatioAlpha = 0.001
+
+// VariantReport is how many names a variant got, against how many it
+// should have.
+type VariantReport struct {
+	Name     string
+	Count    int
+	Expected float64
+
+	// Share is the part of all the names the variant got, and Weight the
+	// part it should have.
+	Share  float64
+	Weight float64
+}
+
+// Report checks that the variants of an experiment got names in
+// proportion to their weights, with a chi-square goodness of fit test. A
+// mismatch, known as a sample ratio mismatch, means the assignment or the
+// logging of exposures is broken, and the results of the experiment cannot
+// be trusted.
+type Report struct {
+	Experiment string
+	Total      int
+	Variants   []VariantReport
+
+	// Unknown counts the names of variants the experiment does not have.
+	Unknown int
+
+	ChiSquare float64
+	DF        int
+	PValue    float64
+
+	// Balanced is whether PValue is at least SampleRatioAlpha.
+	Balanced bool
+}
+
+// Report checks counts, the number of names each variant got, as returned
+// by ExposureCounter.Names. Counting distinct names rather than exposures
+// keeps names greeted more often from skewing the test.
+func (e *Experiment) Report(counts map[string]int) *Report {
+	r := &Report{Experiment: e.name, DF: -1}
+
+	known := make(map[string]bool)
+
+	for _, v := range e.variants {
+		known[v.Name] = true
+		r.Total += counts[v.Name]
+	}
+
+	for v, n := range counts {
+		if !known[v] {
+			r.Unknown += n
+		}
+	}
+
+	prev := 0.0
+
+	for i, v := range e.variants {
+		weight := e.bounds[i] - prev
+		prev = e.bounds[i]
+
+		vr := VariantReport{
+			Name:     v.Name,
+			Count:    counts[v.Name],
+			Expected: weight * float64(r.Total),
+			Weight:   weight,
+		}
+
+		if weight > 0 {
+			r.DF++
+		}
+
+		if r.Total > 0 {
+			vr.Share = float64(vr.Count) / float64(r.Total)
+		}
+
+		switch {
+		case vr.Expected > 0:
+			r.ChiSquare += math.Pow(float64(vr.Count)-vr.Expected, 2) / vr.Expected
+		case vr.Count > 0:
+			// A variant that is never assigned got names anyway.
+			r.ChiSquare = math.Inf(1)
+		}
+
+		r.Variants = append(r.Variants, vr)
+	}
+
+	r.PValue = chiSquareSF(r.ChiSquare, r.DF)
+	r.Balanced = r.PValue >= SampleRatioAlpha
+
+	return r
+}
+
+// chiSquareSF returns the probability that a chi-square distribution with
+// df degrees of freedom is above x, which is the regularized upper
+// incomplete gamma function Q(df/2, x/2).
+func chiSquareSF(x float64, df int) float64 {
+	if math.IsInf(x, 1) {
+		return 0
+	}
+
+	if df <= 0 || x <= 0 {
+		return 1
+	}
+
+	a, x := float64(df)/2, x/2
+
+	lgamma, _ := math.Lgamma(a)
+	prefix := math.Exp(-x + a*math.Log(x) - lgamma)
+
+	// The series of P(a, x) converges fast below a+1, and the continued
+	// fraction of Q(a, x) above it.
+	if x < a+1 {
+		sum, term := 1/a, 1/a
+
+		for n := 1; n < 1000 && term > sum*1e-15; n++ {
+			term *= x / (a + float64(n))
+			sum += term
+		}
+
+		return max(0, 1-sum*prefix)
+	}
+
+	// Modified Lentz's method.
+	const tiny = 1e-300
+
+	b := x + 1 - a
+	c := 1 / tiny
+	d := 1 / b
+	h := d
+
+	for n := 1; n < 1000; n++ {
+		an := -float64(n) * (float64(n) - a)
+		b += 2
+
+		d = an*d + b
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+
+		c = b + an/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+
+		d = 1 / d
+		delta := d * c
+		h *= delta
+
+		if math.Abs(delta-1) < 1e-15 {
+			break
+		}
+	}
+
+	return prefix * h
+}
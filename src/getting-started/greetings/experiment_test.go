@@ -0,0 +1,237 @@
+package greetings
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+var testVariants = []Variant{
+	{Name: "control", Template: "Hi, {{.Name}}", Weight: weight(2)},
+	{Name: "warm", Template: "Great to see you, {{.Name}}!"},
+	{Name: "loud", Template: "HEY {{upper .Name}}!"},
+}
+
+func newTestExperiment(t *testing.T, name string, variants []Variant) *Experiment {
+	t.Helper()
+
+	e, err := NewExperiment(name, variants)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return e
+}
+
+// TestExperimentAssign checks that names keep their variant, and that
+// variants get names in proportion to their weights.
+func TestExperimentAssign(t *testing.T) {
+	e := newTestExperiment(t, "copy-test", testVariants)
+	other := newTestExperiment(t, "other-test", testVariants)
+
+	counts := make(map[string]int)
+	differ := 0
+
+	for i := range 8000 {
+		name := fmt.Sprintf("user-%d", i)
+
+		v := e.Assign(name)
+		counts[v.Name]++
+
+		if e.Assign(name).Name != v.Name {
+			t.Fatalf("Assign(%q) changed", name)
+		}
+
+		if other.Assign(name).Name != v.Name {
+			differ++
+		}
+	}
+
+	// With weights 2, 1 and 1.
+	if counts["control"] < 3800 || counts["control"] > 4200 || counts["warm"] < 1800 || counts["loud"] < 1800 {
+		t.Errorf("counts = %v, want about 4000, 2000 and 2000", counts)
+	}
+
+	// Names get unrelated variants in another experiment, so they differ
+	// for about 5/8 of them.
+	if differ < 4600 || differ > 5400 {
+		t.Errorf("%d of 8000 names got another variant in another experiment, want about 5000", differ)
+	}
+}
+
+// TestExperimentGreet greets names through an experiment, checking the
+// greetings and the logged exposures.
+func TestExperimentGreet(t *testing.T) {
+	e := newTestExperiment(t, "copy-test", testVariants)
+
+	var buf bytes.Buffer
+
+	log := NewExposureLog(&buf)
+	e.Log = log
+	e.Now = func() time.Time { return historyStart }
+
+	names := []string{"Rem", "Ram", "Emilia", "Rem", " Rem "}
+
+	for _, name := range names {
+		msg, err := e.Greet(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		v := e.Assign("Rem")
+		if name == "Rem" && msg != map[string]string{"control": "Hi, Rem", "warm": "Great to see you, Rem!", "loud": "HEY REM!"}[v.Name] {
+			t.Errorf("Greet(Rem) = %q, want the %s variant", msg, v.Name)
+		}
+	}
+
+	if _, err := e.Greet(""); err == nil {
+		t.Errorf(`Greet("") error = nil, want an error`)
+	}
+
+	if log.Err() != nil {
+		t.Fatal(log.Err())
+	}
+
+	c, err := ReadExposures(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	total, distinct := 0, 0
+
+	for _, n := range c.Exposures("copy-test") {
+		total += n
+	}
+
+	for _, n := range c.Names("copy-test") {
+		distinct += n
+	}
+
+	if total != len(names) || distinct != 3 {
+		t.Errorf("read %d exposures of %d names, want %d of 3", total, distinct, len(names))
+	}
+
+	if got := c.Exposures("copy-test")[e.Assign("Rem").Name]; got < 3 {
+		t.Errorf("exposures of Rem's variant = %d, want at least 3", got)
+	}
+
+	// Without a clock, exposures are logged at the current time.
+	e.Log = c
+	e.Now = nil
+
+	if _, err := e.Greet("Rem"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestExperimentReport checks the chi-square test of balanced and
+// unbalanced counts.
+func TestExperimentReport(t *testing.T) {
+	e := newTestExperiment(t, "copy-test", testVariants)
+
+	tests := []struct {
+		name     string
+		counts   map[string]int
+		chi      float64
+		balanced bool
+	}{
+		{"exact", map[string]int{"control": 500, "warm": 250, "loud": 250}, 0, true},
+		{"noise", map[string]int{"control": 510, "warm": 240, "loud": 250}, 0.6, true},
+		{"mismatch", map[string]int{"control": 400, "warm": 300, "loud": 300}, 40, false},
+		{"none", nil, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := e.Report(tt.counts)
+
+			if math.Abs(r.ChiSquare-tt.chi) > 1e-9 || r.DF != 2 || r.Balanced != tt.balanced {
+				t.Errorf("Report() = chi-square %v, df %d, balanced %v, want %v, 2, %v", r.ChiSquare, r.DF, r.Balanced, tt.chi, tt.balanced)
+			}
+		})
+	}
+
+	r := e.Report(map[string]int{"control": 10, "warm": 5, "loud": 5, "retired": 3})
+
+	if r.Total != 20 || r.Unknown != 3 || r.Variants[0].Weight != 0.5 || r.Variants[0].Share != 0.5 || r.Variants[1].Expected != 5 {
+		t.Errorf("Report() = %+v, want 20 names, 3 unknown", r)
+	}
+}
+
+// TestChiSquareSF checks p-values against tables of the chi-square
+// distribution.
+func TestChiSquareSF(t *testing.T) {
+	tests := []struct {
+		x    float64
+		df   int
+		want float64
+	}{
+		{3.841, 1, 0.05},
+		{6.635, 1, 0.01},
+		{5.991, 2, 0.05},
+		{13.816, 2, 0.001},
+		{1.386, 2, 0.5},
+		{18.307, 10, 0.05},
+		{0.0158, 1, 0.9},
+		{0, 3, 1},
+	}
+
+	for _, tt := range tests {
+		if got := chiSquareSF(tt.x, tt.df); math.Abs(got-tt.want) > 1e-3 {
+			t.Errorf("chiSquareSF(%v, %d) = %v, want %v", tt.x, tt.df, got, tt.want)
+		}
+	}
+}
+
+// TestExperimentZeroWeight checks that a variant with a zero weight is
+// never assigned, and that a report flags one that got names anyway.
+func TestExperimentZeroWeight(t *testing.T) {
+	e := newTestExperiment(t, "copy-test", []Variant{
+		{Name: "control", Template: "Hi, {{.Name}}"},
+		{Name: "off", Template: "Off, {{.Name}}", Weight: weight(0)},
+	})
+
+	for i := range 2000 {
+		if v := e.Assign(fmt.Sprintf("user-%d", i)); v.Name != "control" {
+			t.Fatalf("Assign() = %s, want control only", v.Name)
+		}
+	}
+
+	if r := e.Report(map[string]int{"control": 100}); !r.Balanced || r.DF != 0 {
+		t.Errorf("Report() = %+v, want balanced with 0 degrees of freedom", r)
+	}
+
+	if r := e.Report(map[string]int{"control": 100, "off": 1}); r.Balanced {
+		t.Errorf("Report() = %+v, want unbalanced when the off variant got a name", r)
+	}
+}
+
+// TestNewExperimentErrors checks the experiments that cannot be made.
+func TestNewExperimentErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		experiment string
+		variants   []Variant
+	}{
+		{"no name", "", testVariants},
+		{"no variants", "copy-test", nil},
+		{"duplicate", "copy-test", []Variant{{Name: "a", Template: "a"}, {Name: "a", Template: "b"}}},
+		{"unnamed", "copy-test", []Variant{{Template: "a"}}},
+		{"negative weight", "copy-test", []Variant{{Name: "a", Template: "a", Weight: weight(-1)}}},
+		{"NaN weight", "copy-test", []Variant{{Name: "a", Template: "a", Weight: weight(math.NaN())}}},
+		{"infinite weight", "copy-test", []Variant{{Name: "a", Template: "a", Weight: weight(math.Inf(1))}}},
+		{"weights overflow", "copy-test", []Variant{{Name: "a", Template: "a", Weight: weight(math.MaxFloat64)}, {Name: "b", Template: "b", Weight: weight(math.MaxFloat64)}}},
+		{"all zero weights", "copy-test", []Variant{{Name: "a", Template: "a", Weight: weight(0)}, {Name: "b", Template: "b", Weight: weight(0)}}},
+		{"parse", "copy-test", []Variant{{Name: "a", Template: "{{.Name"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewExperiment(tt.experiment, tt.variants); err == nil {
+				t.Errorf("NewExperiment() error = nil, want an error")
+			}
+		})
+	}
+}
@@ -1,3 +1,5 @@
 module github.com/ccrsxx/learn-go/modules/greetings
 
 go 1.25.4
+
+require golang.org/x/text v0.31.0
@@ -0,0 +1,452 @@
+package greetings
+
+import (
+	"container/list"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Template is the text/template of a greeting, and its weight when a
+// Greeter picks one at random. A nil Weight counts as 1, and a template
+// with a zero Weight is never picked.
+//
+// Templates are executed with a TemplateData, and can call the helper
+// functions upper, lower, title, first and initials, along with any added
+// with WithFuncs.
+type Template struct {
+	Text   string   `json:"text"`
+	Weight *float64 `json:"weight,omitempty"`
+}
+
+// TemplateData is what a greeting template is executed with.
+type TemplateData struct {
+	Name string
+}
+
+// TemplateSource provides the templates of a Greeter.
+type TemplateSource interface {
+	Templates() ([]Template, error)
+}
+
+// TemplateList is a TemplateSource with a fixed list of templates.
+type TemplateList []Template
+
+func (l TemplateList) Templates() ([]Template, error) {
+	return l, nil
+}
+
+// TemplateFile returns a TemplateSource that reads a JSON array of
+// Templates from the file name in fsys.
+func TemplateFile(fsys fs.FS, name string) TemplateSource {
+	return templateFile{fsys: fsys, name: name}
+}
+
+type templateFile struct {
+	fsys fs.FS
+	name string
+}
+
+func (f templateFile) Templates() ([]Template, error) {
+	data, err := fs.ReadFile(f.fsys, f.name)
+	if err != nil {
+		return nil, err
+	}
+
+	var templates []Template
+
+	if err := json.Unmarshal(data, &templates); err != nil {
+		return nil, fmt.Errorf("%s: %w", f.name, err)
+	}
+
+	return templates, nil
+}
+
+var defaultTemplates = TemplateList{
+	{Text: "Hi, {{.Name}}. Welcome!"},
+	{Text: "Great to see you, {{.Name}}!"},
+	{Text: "Hail, {{.Name}}! Well met!"},
+}
+
+var helperFuncs = template.FuncMap{
+	"upper":    strings.ToUpper,
+	"lower":    strings.ToLower,
+	"title":    title,
+	"first":    firstName,
+	"initials": initials,
+}
+
+// title upper cases the first letter of every word of s.
+func title(s string) string {
+	words := strings.Fields(s)
+
+	for i, w := range words {
+		r, size := utf8.DecodeRuneInString(w)
+		words[i] = string(unicode.ToUpper(r)) + w[size:]
+	}
+
+	return strings.Join(words, " ")
+}
+
+// firstName returns the first word of name.
+func firstName(name string) string {
+	if words := strings.Fields(name); len(words) > 0 {
+		return words[0]
+	}
+
+	return ""
+}
+
+// initials returns the upper cased first letter of every word of name.
+func initials(name string) string {
+	var b strings.Builder
+
+	for _, w := range strings.Fields(name) {
+		r, _ := utf8.DecodeRuneInString(w)
+		b.WriteRune(unicode.ToUpper(r))
+	}
+
+	return b.String()
+}
+
+// Selector picks one of several templates, given their weights. At least
+// one of the weights is positive, and a template with a zero weight must
+// not be picked.
+type Selector interface {
+	Select(r *rand.Rand, weights []float64) int
+}
+
+// WeightedSelector picks a template with a probability proportional to its
+// weight.
+type WeightedSelector struct{}
+
+func (WeightedSelector) Select(r *rand.Rand, weights []float64) int {
+	var total float64
+
+	for _, w := range weights {
+		total += w
+	}
+
+	x := r.Float64() * total
+	last := 0
+
+	for i, w := range weights {
+		if w <= 0 {
+			continue
+		}
+
+		if x < w {
+			return i
+		}
+
+		x -= w
+		last = i
+	}
+
+	// Rounding can leave x just past the last weight.
+	return last
+}
+
+// UniformSelector ignores the weights and picks any template that can be
+// picked with the same probability.
+type UniformSelector struct{}
+
+func (UniformSelector) Select(r *rand.Rand, weights []float64) int {
+	var allowed []int
+
+	for i, w := range weights {
+		if w > 0 {
+			allowed = append(allowed, i)
+		}
+	}
+
+	return allowed[r.IntN(len(allowed))]
+}
+
+// Greeter greets people with greetings picked from a set of templates.
+// It is safe for concurrent use.
+type Greeter struct {
+	source    TemplateSource
+	funcs     template.FuncMap
+	selector  Selector
+	validator *Validator
+	recorder  Recorder
+	noRepeat  bool
+
+	templates []*template.Template
+	formats   []string
+	weights   []float64
+
+	mu   sync.Mutex
+	rand *rand.Rand
+
+	// last maps a name to its element in recent, which holds the last
+	// template of the names greeted most recently, up to lastCap of them.
+	last    map[string]*list.Element
+	recent  *list.List
+	lastCap int
+}
+
+// lastTemplate is an element of Greeter.recent.
+type lastTemplate struct {
+	name     string
+	template int
+}
+
+// noRepeatNames is how many names a Greeter made WithNoRepeat remembers.
+const noRepeatNames = 10000
+
+// Option configures a Greeter.
+type Option func(*Greeter)
+
+// WithTemplates makes the Greeter use the templates of src instead of the
+// default English ones.
+func WithTemplates(src TemplateSource) Option {
+	return func(g *Greeter) {
+		g.source = src
+	}
+}
+
+// WithFuncs adds helper functions for the templates to call.
+func WithFuncs(funcs template.FuncMap) Option {
+	return func(g *Greeter) {
+		maps.Copy(g.funcs, funcs)
+	}
+}
+
+// WithSelector sets how the Greeter picks a template. The default is a
+// WeightedSelector.
+func WithSelector(s Selector) Option {
+	return func(g *Greeter) {
+		g.selector = s
+	}
+}
+
+// WithRand sets the source of randomness of the Greeter.
+func WithRand(src rand.Source) Option {
+	return func(g *Greeter) {
+		g.rand = rand.New(src)
+	}
+}
+
+// WithSeed seeds the randomness of the Greeter, so it greets the same way
+// every time.
+func WithSeed(seed uint64) Option {
+	return WithRand(rand.NewPCG(seed, seed))
+}
+
+// WithValidator makes the Greeter check names with v instead of the
+// default Validator.
+func WithValidator(v *Validator) Option {
+	return func(g *Greeter) {
+		g.validator = v
+	}
+}
+
+// WithRecorder makes the Greeter record its greetings with r instead of
+// the default Recorder.
+func WithRecorder(r Recorder) Option {
+	return func(g *Greeter) {
+		g.recorder = r
+	}
+}
+
+// WithNoRepeat stops the Greeter from greeting anyone with the same
+// template twice in a row, when it has more than one that can be picked.
+// It remembers the last template of the 10000 names it greeted most
+// recently, so someone it has not greeted in a long while may repeat.
+func WithNoRepeat() Option {
+	return func(g *Greeter) {
+		g.noRepeat = true
+		g.lastCap = noRepeatNames
+	}
+}
+
+// NewGreeter returns a Greeter configured by opts. It fails if the
+// templates cannot be loaded or parsed.
+func NewGreeter(opts ...Option) (*Greeter, error) {
+	g := &Greeter{
+		source:   defaultTemplates,
+		funcs:    maps.Clone(helperFuncs),
+		selector: WeightedSelector{},
+		last:     make(map[string]*list.Element),
+		recent:   list.New(),
+	}
+
+	for _, opt := range opts {
+		opt(g)
+	}
+
+	if g.rand == nil {
+		g.rand = rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+	}
+
+	templates, err := g.source.Templates()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(templates) == 0 {
+		return nil, errors.New("no greeting templates")
+	}
+
+	var total float64
+
+	for i, t := range templates {
+		weight := 1.0
+
+		if t.Weight != nil {
+			weight = *t.Weight
+		}
+
+		if math.IsNaN(weight) || math.IsInf(weight, 0) {
+			return nil, fmt.Errorf("template %d: weight %v is not a finite number", i, weight)
+		}
+
+		if weight < 0 {
+			return nil, fmt.Errorf("template %d: negative weight %v", i, weight)
+		}
+
+		tmpl, err := template.New(fmt.Sprint(i)).Funcs(g.funcs).Parse(t.Text)
+		if err != nil {
+			return nil, err
+		}
+
+		g.templates = append(g.templates, tmpl)
+		g.formats = append(g.formats, t.Text)
+		g.weights = append(g.weights, weight)
+		total += weight
+	}
+
+	if total == 0 {
+		return nil, errors.New("no greeting template has a positive weight")
+	}
+
+	return g, nil
+}
+
+// Greet returns a greeting for the named person, once the name passes the
+// Validator of the Greeter, and records it.
+func (g *Greeter) Greet(name string) (string, error) {
+	name, err := g.validate(name)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+
+	i := g.pick(name)
+
+	if err := g.templates[i].Execute(&b, TemplateData{Name: name}); err != nil {
+		return "", err
+	}
+
+	record(g.recorder, Entry{Name: name, Format: g.formats[i]})
+
+	return b.String(), nil
+}
+
+// validate checks name with the Validator of the Greeter.
+func (g *Greeter) validate(name string) (string, error) {
+	return validate(g.validator, name)
+}
+
+// pickOf picks one of n equally weighted choices with the Selector and
+// randomness of the Greeter.
+func (g *Greeter) pickOf(n int) int {
+	weights := make([]float64, n)
+
+	for i := range weights {
+		weights[i] = 1
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.selector.Select(g.rand, weights)
+}
+
+func (g *Greeter) pick(name string) int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	weights := g.weights
+
+	if e, ok := g.last[name]; ok && positives(weights) > 1 {
+		weights = slices.Clone(weights)
+		weights[e.Value.(*lastTemplate).template] = 0
+	}
+
+	i := g.selector.Select(g.rand, weights)
+
+	if g.noRepeat {
+		g.remember(name, i)
+	}
+
+	return i
+}
+
+// remember records that name was last greeted with template i, forgetting
+// the name greeted longest ago once lastCap names are remembered. The
+// caller holds the lock.
+func (g *Greeter) remember(name string, i int) {
+	if e, ok := g.last[name]; ok {
+		e.Value.(*lastTemplate).template = i
+		g.recent.MoveToFront(e)
+
+		return
+	}
+
+	g.last[name] = g.recent.PushFront(&lastTemplate{name: name, template: i})
+
+	if g.recent.Len() > g.lastCap {
+		oldest := g.recent.Back()
+		g.recent.Remove(oldest)
+		delete(g.last, oldest.Value.(*lastTemplate).name)
+	}
+}
+
+// positives counts the weights that can be picked.
+func positives(weights []float64) int {
+	n := 0
+
+	for _, w := range weights {
+		if w > 0 {
+			n++
+		}
+	}
+
+	return n
+}
+
+var defaultGreeter atomic.Pointer[Greeter]
+
+func init() {
+	g, err := NewGreeter()
+	if err != nil {
+		panic(err)
+	}
+
+	defaultGreeter.Store(g)
+}
+
+// Default returns the Greeter used by the package-level functions.
+func Default() *Greeter {
+	return defaultGreeter.Load()
+}
+
+// SetDefault makes g the Greeter used by the package-level functions.
+func SetDefault(g *Greeter) {
+	defaultGreeter.Store(g)
+}
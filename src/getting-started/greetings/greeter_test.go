@@ -0,0 +1,256 @@
+package greetings
+
+import (
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"text/template"
+)
+
+func newTestGreeter(t *testing.T, opts ...Option) *Greeter {
+	t.Helper()
+
+	g, err := NewGreeter(opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return g
+}
+
+// weight returns a pointer to w, for the Weight of a Template.
+func weight(w float64) *float64 {
+	return &w
+}
+
+func greetN(t *testing.T, g *Greeter, name string, n int) []string {
+	t.Helper()
+
+	var messages []string
+
+	for range n {
+		msg, err := g.Greet(name)
+		if err != nil {
+			t.Fatalf("Greet(%q) error = %v", name, err)
+		}
+
+		messages = append(messages, msg)
+	}
+
+	return messages
+}
+
+// TestGreeterSeed checks that two Greeters with the same seed greet the
+// same way.
+func TestGreeterSeed(t *testing.T) {
+	a := greetN(t, newTestGreeter(t, WithSeed(42)), "Rem", 20)
+	b := greetN(t, newTestGreeter(t, WithSeed(42)), "Rem", 20)
+
+	if !slices.Equal(a, b) {
+		t.Errorf("seeded greetings differ:\n%q\n%q", a, b)
+	}
+
+	for _, msg := range a {
+		if !strings.Contains(msg, "Rem") {
+			t.Errorf("Greet(Rem) = %q, want the name in it", msg)
+		}
+	}
+}
+
+// TestGreeterWeights checks that templates are picked in proportion to
+// their weights.
+func TestGreeterWeights(t *testing.T) {
+	templates := TemplateList{
+		{Text: "common", Weight: weight(3)},
+		{Text: "rare"},
+		{Text: "never", Weight: weight(0)},
+	}
+
+	g := newTestGreeter(t, WithTemplates(templates), WithSeed(1))
+
+	counts := make(map[string]int)
+
+	for _, msg := range greetN(t, g, "Rem", 4000) {
+		counts[msg]++
+	}
+
+	// A missing weight counts as 1, and a zero weight is never picked.
+	if common := counts["common"]; common < 2850 || common > 3150 {
+		t.Errorf("picked common %d times out of 4000, want about 3000", common)
+	}
+
+	if counts["rare"] < 850 || counts["never"] != 0 {
+		t.Errorf("counts = %v, want rare about 1000 times and never not at all", counts)
+	}
+}
+
+// TestGreeterNoRepeat checks that no one gets the same greeting twice in a
+// row.
+func TestGreeterNoRepeat(t *testing.T) {
+	g := newTestGreeter(t, WithNoRepeat(), WithSeed(7))
+
+	for _, name := range []string{"Rem", "Ram"} {
+		messages := greetN(t, g, name, 50)
+
+		for i := 1; i < len(messages); i++ {
+			if messages[i] == messages[i-1] {
+				t.Fatalf("greeted %s with %q twice in a row", name, messages[i])
+			}
+		}
+	}
+
+	// A single template has to repeat, even next to one that is never picked.
+	single := newTestGreeter(t, WithNoRepeat(), WithTemplates(TemplateList{{Text: "Hi, {{.Name}}"}, {Text: "Never", Weight: weight(0)}}))
+
+	if messages := greetN(t, single, "Rem", 3); messages[2] != "Hi, Rem" {
+		t.Errorf("single template greetings = %q", messages)
+	}
+}
+
+// TestGreeterNoRepeatForgets checks that a Greeter made WithNoRepeat only
+// remembers the names it greeted most recently.
+func TestGreeterNoRepeatForgets(t *testing.T) {
+	g := newTestGreeter(t, WithTemplates(TemplateList{{Text: "a"}, {Text: "b"}}), WithSelector(lastSelector{}), WithNoRepeat())
+	g.lastCap = 2
+
+	for _, name := range []string{"Rem", "Ram", "Rem", "Emilia"} {
+		if _, err := g.Greet(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(g.last) != 2 || g.recent.Len() != 2 {
+		t.Fatalf("remembers %d names, want 2", len(g.last))
+	}
+
+	if _, ok := g.last["Ram"]; ok {
+		t.Error("still remembers Ram, the name greeted longest ago")
+	}
+
+	if got := greetN(t, g, "Rem", 1); got[0] != "b" {
+		t.Errorf("Greet(Rem) = %q, want b after a", got[0])
+	}
+}
+
+// lastSelector always picks the last template that can be picked.
+type lastSelector struct{}
+
+func (lastSelector) Select(r *rand.Rand, weights []float64) int {
+	for i := len(weights) - 1; i >= 0; i-- {
+		if weights[i] > 0 {
+			return i
+		}
+	}
+
+	return 0
+}
+
+// TestGreeterSelector checks custom and uniform selectors.
+func TestGreeterSelector(t *testing.T) {
+	templates := TemplateList{{Text: "a"}, {Text: "b"}, {Text: "c"}}
+
+	g := newTestGreeter(t, WithTemplates(templates), WithSelector(lastSelector{}), WithNoRepeat())
+
+	if got, want := greetN(t, g, "Rem", 4), []string{"c", "b", "c", "b"}; !slices.Equal(got, want) {
+		t.Errorf("greetings = %q, want %q", got, want)
+	}
+
+	uniform := newTestGreeter(t, WithTemplates(TemplateList{{Text: "a", Weight: weight(100)}, {Text: "b"}}), WithSelector(UniformSelector{}), WithSeed(3))
+
+	counts := make(map[string]int)
+
+	for _, msg := range greetN(t, uniform, "Rem", 2000) {
+		counts[msg]++
+	}
+
+	if counts["b"] < 800 {
+		t.Errorf("counts = %v, want the weights ignored", counts)
+	}
+}
+
+// TestGreeterFuncs checks the helper functions of templates.
+func TestGreeterFuncs(t *testing.T) {
+	templates := TemplateList{{Text: `{{upper .Name}}|{{lower .Name}}|{{title .Name}}|{{first .Name}}|{{initials .Name}}|{{shout .Name}}`}}
+
+	g := newTestGreeter(t, WithTemplates(templates), WithFuncs(template.FuncMap{
+		"shout": func(s string) string { return s + "!" },
+	}))
+
+	msg, err := g.Greet("émilia de la rosa")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "ÉMILIA DE LA ROSA|émilia de la rosa|Émilia De La Rosa|émilia|ÉDLR|émilia de la rosa!"; msg != want {
+		t.Errorf("Greet() = %q, want %q", msg, want)
+	}
+}
+
+// TestGreeterErrors checks that broken templates and empty names fail.
+func TestGreeterErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		source TemplateSource
+	}{
+		{"no templates", TemplateList{}},
+		{"parse", TemplateList{{Text: "Hi, {{.Name"}}},
+		{"unknown func", TemplateList{{Text: "{{nope .Name}}"}}},
+		{"negative weight", TemplateList{{Text: "Hi", Weight: weight(-1)}}},
+		{"NaN weight", TemplateList{{Text: "Hi", Weight: weight(math.NaN())}}},
+		{"infinite weight", TemplateList{{Text: "Hi", Weight: weight(math.Inf(1))}, {Text: "Yo"}}},
+		{"all zero weights", TemplateList{{Text: "Hi", Weight: weight(0)}, {Text: "Yo", Weight: weight(0)}}},
+		{"missing file", TemplateFile(fstest.MapFS{}, "greetings.json")},
+		{"bad file", TemplateFile(fstest.MapFS{"greetings.json": {Data: []byte(`{"text": "Hi"}`)}}, "greetings.json")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewGreeter(WithTemplates(tt.source)); err == nil {
+				t.Errorf("NewGreeter() error = nil, want an error")
+			}
+		})
+	}
+
+	g := newTestGreeter(t, WithTemplates(TemplateList{{Text: "{{.Missing}}"}}))
+
+	if _, err := g.Greet("Rem"); err == nil {
+		t.Errorf("Greet() with a missing field error = nil, want an error")
+	}
+
+	if msg, err := g.Greet(""); msg != "" || err == nil {
+		t.Errorf(`Greet("") = %q, %v, want "", error`, msg, err)
+	}
+}
+
+// TestTemplateFile loads templates from a JSON file.
+func TestTemplateFile(t *testing.T) {
+	fsys := fstest.MapFS{
+		"greetings.json": {Data: []byte(`[{"text": "Yo, {{first .Name}}!", "weight": 2}]`)},
+	}
+
+	g := newTestGreeter(t, WithTemplates(TemplateFile(fsys, "greetings.json")))
+
+	if msg, err := g.Greet("Rem Rin"); msg != "Yo, Rem!" || err != nil {
+		t.Errorf(`Greet("Rem Rin") = %q, %v, want "Yo, Rem!", nil`, msg, err)
+	}
+}
+
+// TestSetDefault checks that the package-level functions use the default
+// Greeter.
+func TestSetDefault(t *testing.T) {
+	old := Default()
+	defer SetDefault(old)
+
+	SetDefault(newTestGreeter(t, WithTemplates(TemplateList{{Text: "Howdy, {{.Name}}"}})))
+
+	if msg := HelloRandom("Rem"); msg != "Howdy, Rem" {
+		t.Errorf(`HelloRandom("Rem") = %q, want "Howdy, Rem"`, msg)
+	}
+
+	if msg := HelloRandom(""); msg != "" {
+		t.Errorf(`HelloRandom("") = %q, want ""`, msg)
+	}
+}
@@ -3,12 +3,13 @@ package greetings
 import (
 	"errors"
 	"fmt"
-	"log/slog"
-	"math/rand"
 )
 
 var Emilia = 100
 
+// ErrEmptyName is returned when asked to greet someone without a name.
+var ErrEmptyName = errors.New("empty name")
+
 // Hello returns a greeting for the named person.
 func Hello(name string) string {
 	// Return a greeting that embeds the name in a message.
@@ -17,48 +18,48 @@ func Hello(name string) string {
 
 	// in go you can declare and assign in one line with :=, it also infers the type
 
-	message := fmt.Sprintf("Hi, %v. Welcome tan!", name)
+	message := fmt.Sprintf(helloFormat, name)
 	return message
 }
 
+const helloFormat = "Hi, %v. Welcome tan!"
+
+// HelloError returns a greeting for the named person, once the name passes
+// the default Validator, and records it with the default Recorder.
 func HelloError(name string) (string, error) {
-	if name == "" {
-		return "", errors.New("empty name")
+	name, err := DefaultValidator().Validate(name)
+	if err != nil {
+		return "", err
 	}
 
 	message := Hello(name)
 
+	record(nil, Entry{Name: name, Format: helloFormat})
+
 	return message, nil
 }
 
+// HelloRandomError returns a random greeting for the named person from the
+// default Greeter.
 func HelloRandomError(name string) (string, error) {
-	if name == "" {
-		return "", errors.New("empty name")
-	}
-
-	message := fmt.Sprintf(randomFormat(), emilia)
-
-	return message, nil
+	return Default().Greet(name)
 }
 
 // HellosRandomError returns a map that associates each of the named people
-// with a greeting message.
+// with a greeting message. It stops at the first name that cannot be greeted
+// and returns its error; use HelloAll to greet the others anyway.
 func HellosRandomError(names []string) (map[string]string, error) {
 	// A map to associate names with messages.
 	messages := make(map[string]string)
 
-	slog.Info("log", "names", names)
-
 	// Loop through the received slice of names, calling
-	// the Hello function to get a message for each name.
-	for i, name := range names {
-
-		fmt.Println("index:", i, "name:", name)
-
+	// the HelloRandomError function to get a message for each name.
+	for _, name := range names {
 		message, err := HelloRandomError(name)
 		if err != nil {
 			return nil, err
 		}
+
 		// In the map, associate the retrieved message with
 		// the name.
 		messages[name] = message
@@ -67,23 +68,10 @@ func HellosRandomError(names []string) (map[string]string, error) {
 	return messages, nil
 }
 
+// HelloRandom returns a random greeting for the named person from the
+// default Greeter, or "" if name is empty.
 func HelloRandom(name string) string {
-	message := randomFormat()
+	message, _ := Default().Greet(name)
 
 	return message
 }
-
-func randomFormat() string {
-	formats := []string{
-		"Hi, %v. Welcome!",
-		"Great to see you, %v!",
-		"Hail, %v! Well met!",
-	}
-
-	formatsIndex := len(formats)
-	formatsIntIndex := rand.Intn(formatsIndex)
-
-	// slog.Info("log", "formatsIndex", formatsIndex, "formatsIntIndex", formatsIntIndex)
-
-	return formats[formatsIntIndex]
-}
@@ -0,0 +1,418 @@
+package greetings
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Entry is one greeting in a history.
+type Entry struct {
+	Time time.Time `json:"time"`
+	Name string    `json:"name"`
+
+	// Format is the template or message format the greeting was made
+	// from.
+	Format string `json:"format"`
+
+	// Locale is the BCP 47 tag of the language of the greeting, or "" if
+	// it was not made from a Catalog.
+	Locale string `json:"locale,omitempty"`
+}
+
+// Recorder records the greetings made by the package.
+type Recorder interface {
+	Record(e Entry) error
+}
+
+var defaultRecorder struct {
+	mu sync.RWMutex
+	r  Recorder
+}
+
+// DefaultRecorder returns the Recorder of the package-level functions, the
+// Catalogs and the Greeters without one of their own, or nil if greetings
+// are not recorded.
+func DefaultRecorder() Recorder {
+	defaultRecorder.mu.RLock()
+	defer defaultRecorder.mu.RUnlock()
+
+	return defaultRecorder.r
+}
+
+// SetDefaultRecorder makes r the Recorder returned by DefaultRecorder. A nil
+// r stops recording.
+func SetDefaultRecorder(r Recorder) {
+	defaultRecorder.mu.Lock()
+	defer defaultRecorder.mu.Unlock()
+
+	defaultRecorder.r = r
+}
+
+// record records e with r, or with the default Recorder if r is nil.
+// Greeting does not fail when recording does; a Recorder keeps its own
+// errors, as History does.
+func record(r Recorder, e Entry) {
+	if r == nil {
+		r = DefaultRecorder()
+	}
+
+	if r != nil {
+		_ = r.Record(e)
+	}
+}
+
+// History is a Recorder that appends entries to a JSON Lines file, and
+// answers queries about them. It is safe for concurrent use.
+type History struct {
+	// Now returns the time of entries recorded without one.
+	Now func() time.Time
+
+	path string
+
+	mu   sync.Mutex
+	file *os.File
+	err  error
+}
+
+// OpenHistory opens the history in the file path, creating it if needed.
+// A partial last line, left by a crash in the middle of a write, is
+// dropped so that new entries start on a line of their own.
+func OpenHistory(path string) (*History, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := trimPartialLine(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return &History{Now: time.Now, path: path, file: f}, nil
+}
+
+// trimPartialLine truncates f after its last newline.
+func trimPartialLine(f *os.File) error {
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, 4096)
+
+	for end := info.Size(); end > 0; {
+		start := max(end-int64(len(buf)), 0)
+		chunk := buf[:end-start]
+
+		if _, err := f.ReadAt(chunk, start); err != nil {
+			return err
+		}
+
+		if i := bytes.LastIndexByte(chunk, '\n'); i >= 0 {
+			end = start + int64(i) + 1
+
+			if end == info.Size() {
+				return nil
+			}
+
+			return f.Truncate(end)
+		}
+
+		end = start
+	}
+
+	return f.Truncate(0)
+}
+
+// Record appends e to the history, with the current time if it has none.
+// The first error is kept, and returned by Err.
+func (h *History) Record(e Entry) error {
+	if e.Time.IsZero() {
+		e.Time = h.Now()
+	}
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.err != nil {
+		return h.err
+	}
+
+	// One write per entry, so that a crash leaves at most a partial last
+	// line, which reading skips and OpenHistory drops.
+	if _, err := h.file.Write(append(line, '\n')); err != nil {
+		h.err = err
+	}
+
+	return h.err
+}
+
+// Err returns the first error of Record, or the error of Compact failing
+// to reopen the compacted file.
+func (h *History) Err() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.err
+}
+
+// Close closes the history file.
+func (h *History) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.file.Close()
+}
+
+// Query selects the entries of a history. Zero fields select everything.
+type Query struct {
+	Name   string
+	Locale string
+	Format string
+
+	// Since and Until select entries from Since, inclusive, to Until,
+	// exclusive.
+	Since time.Time
+	Until time.Time
+}
+
+func (q Query) match(e Entry) bool {
+	switch {
+	case q.Name != "" && e.Name != norm.NFC.String(q.Name):
+		return false
+	case q.Locale != "" && e.Locale != q.Locale:
+		return false
+	case q.Format != "" && e.Format != q.Format:
+		return false
+	case !q.Since.IsZero() && e.Time.Before(q.Since):
+		return false
+	case !q.Until.IsZero() && !e.Time.Before(q.Until):
+		return false
+	}
+
+	return true
+}
+
+// Entries returns the entries q selects, in the order they were recorded.
+func (h *History) Entries(q Query) ([]Entry, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var entries []Entry
+
+	err := h.read(func(e Entry) {
+		if q.match(e) {
+			entries = append(entries, e)
+		}
+	})
+
+	return entries, err
+}
+
+// Count is how many of the entries of a Stats have a name, format or
+// locale.
+type Count struct {
+	Value string
+	Count int
+}
+
+// Stats sums up the entries of a history. Its counts are sorted from the
+// most to the least common.
+type Stats struct {
+	Total   int
+	Names   []Count
+	Formats []Count
+	Locales []Count
+
+	First, Last time.Time
+}
+
+// Stats sums up the entries q selects, such as the formats used for
+// Emilia last week, or the most greeted names.
+func (h *History) Stats(q Query) (*Stats, error) {
+	entries, err := h.Entries(q)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]int)
+	formats := make(map[string]int)
+	locales := make(map[string]int)
+
+	s := &Stats{Total: len(entries)}
+
+	for _, e := range entries {
+		names[e.Name]++
+		formats[e.Format]++
+		locales[e.Locale]++
+
+		if s.First.IsZero() || e.Time.Before(s.First) {
+			s.First = e.Time
+		}
+
+		if e.Time.After(s.Last) {
+			s.Last = e.Time
+		}
+	}
+
+	s.Names = sortCounts(names)
+	s.Formats = sortCounts(formats)
+	s.Locales = sortCounts(locales)
+
+	return s, nil
+}
+
+func sortCounts(m map[string]int) []Count {
+	counts := make([]Count, 0, len(m))
+
+	for v, n := range m {
+		counts = append(counts, Count{Value: v, Count: n})
+	}
+
+	slices.SortFunc(counts, func(a, b Count) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Value, b.Value))
+	})
+
+	return counts
+}
+
+// Retention says which entries a history keeps when compacted. Zero
+// fields keep everything.
+type Retention struct {
+	// MaxAge drops the entries older than it.
+	MaxAge time.Duration
+
+	// MaxEntries drops the oldest entries beyond it.
+	MaxEntries int
+}
+
+// Compact rewrites the history with only the entries p keeps, and the
+// partial lines a crash left dropped. It returns the number of entries
+// dropped. The file is replaced atomically, so a crash while compacting
+// leaves the old history.
+func (h *History) Compact(p Retention) (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.err != nil {
+		return 0, h.err
+	}
+
+	var entries []Entry
+
+	if err := h.read(func(e Entry) { entries = append(entries, e) }); err != nil {
+		return 0, err
+	}
+
+	total := len(entries)
+
+	if p.MaxAge > 0 {
+		cutoff := h.Now().Add(-p.MaxAge)
+
+		entries = slices.DeleteFunc(entries, func(e Entry) bool {
+			return e.Time.Before(cutoff)
+		})
+	}
+
+	if p.MaxEntries > 0 && len(entries) > p.MaxEntries {
+		slices.SortStableFunc(entries, func(a, b Entry) int {
+			return a.Time.Compare(b.Time)
+		})
+
+		entries = entries[len(entries)-p.MaxEntries:]
+	}
+
+	if err := h.rewrite(entries); err != nil {
+		return 0, err
+	}
+
+	return total - len(entries), nil
+}
+
+// rewrite replaces the history file with entries, and reopens it for
+// appending.
+func (h *History) rewrite(entries []Entry) error {
+	tmp, err := os.CreateTemp(filepath.Dir(h.path), filepath.Base(h.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+
+	if err := errors.Join(w.Flush(), tmp.Sync(), tmp.Close()); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), h.path); err != nil {
+		return err
+	}
+
+	_ = h.file.Close()
+
+	// The old file is gone, so Record cannot go on without the new one.
+	h.file, h.err = os.OpenFile(h.path, os.O_WRONLY|os.O_APPEND, 0o644)
+
+	return h.err
+}
+
+// read calls fn with every entry of the history file, skipping a partial
+// last line and any line that does not parse, such as one a partial line
+// was written over. It must be called with h.mu held.
+func (h *History) read(fn func(Entry)) error {
+	f, err := os.Open(h.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+
+	for {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		var e Entry
+
+		if err := json.Unmarshal(line, &e); err != nil {
+			continue
+		}
+
+		fn(e)
+	}
+}
@@ -0,0 +1,293 @@
+package greetings
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+var historyStart = time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+
+func openTestHistory(t *testing.T) (*History, string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+
+	h, err := OpenHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { h.Close() })
+
+	now := historyStart
+	h.Now = func() time.Time { return now }
+
+	return h, path
+}
+
+func recordAll(t *testing.T, h *History, entries []Entry) {
+	t.Helper()
+
+	for _, e := range entries {
+		if err := h.Record(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// day returns the time of the start of the history plus days.
+func day(days int) time.Time {
+	return historyStart.AddDate(0, 0, days)
+}
+
+var testEntries = []Entry{
+	{Time: day(-10), Name: "Emilia", Format: "a"},
+	{Time: day(-5), Name: "Emilia", Format: "b"},
+	{Time: day(-4), Name: "Rem", Format: "a"},
+	{Time: day(-3), Name: "Emilia", Format: "b", Locale: "ja"},
+	{Time: day(-2), Name: "Rem", Format: "c"},
+	{Time: day(-1), Name: "Emilia", Format: "a"},
+}
+
+// TestHistoryQuery asks a history which formats were used for Emilia last
+// week, and who was greeted most.
+func TestHistoryQuery(t *testing.T) {
+	h, _ := openTestHistory(t)
+
+	recordAll(t, h, testEntries)
+
+	week, err := h.Stats(Query{Name: "Emilia", Since: day(-7)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []Count{{"b", 2}, {"a", 1}}; week.Total != 3 || !slices.Equal(week.Formats, want) {
+		t.Errorf("formats for Emilia last week = %v, want %v", week.Formats, want)
+	}
+
+	if !week.First.Equal(day(-5)) || !week.Last.Equal(day(-1)) {
+		t.Errorf("first and last = %v %v, want %v %v", week.First, week.Last, day(-5), day(-1))
+	}
+
+	all, err := h.Stats(Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []Count{{"Emilia", 4}, {"Rem", 2}}; !slices.Equal(all.Names, want) {
+		t.Errorf("most greeted names = %v, want %v", all.Names, want)
+	}
+
+	entries, err := h.Entries(Query{Locale: "ja"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 1 || entries[0].Name != "Emilia" || !entries[0].Time.Equal(day(-3)) {
+		t.Errorf("Entries(ja) = %v, want the Japanese greeting", entries)
+	}
+
+	entries, err = h.Entries(Query{Since: day(-4), Until: day(-2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 2 {
+		t.Errorf("Entries(from -4 to -2 days) = %v, want 2 entries", entries)
+	}
+}
+
+// TestHistoryPartialLine checks that a partial last line, as a crash could
+// leave, is skipped, and dropped by compaction.
+func TestHistoryPartialLine(t *testing.T) {
+	h, path := openTestHistory(t)
+
+	recordAll(t, h, testEntries[:2])
+
+	appendPartialLine(t, path)
+
+	if entries, err := h.Entries(Query{}); len(entries) != 2 || err != nil {
+		t.Fatalf("Entries() = %d entries, %v, want 2, nil", len(entries), err)
+	}
+
+	if _, err := h.Compact(Retention{}); err != nil {
+		t.Fatal(err)
+	}
+
+	recordAll(t, h, testEntries[2:3])
+
+	if entries, err := h.Entries(Query{}); len(entries) != 3 || err != nil {
+		t.Errorf("Entries() after compacting = %d entries, %v, want 3, nil", len(entries), err)
+	}
+}
+
+// TestHistoryPartialLineRecord checks that entries recorded after a partial
+// line can still be read, stats taken and compacted.
+func TestHistoryPartialLineRecord(t *testing.T) {
+	h, path := openTestHistory(t)
+
+	recordAll(t, h, testEntries[:2])
+	h.Close()
+
+	// Reopening drops the partial line, so the next entry is whole.
+	appendPartialLine(t, path)
+
+	h, err := OpenHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	recordAll(t, h, testEntries[2:3])
+
+	if entries, err := h.Entries(Query{}); len(entries) != 3 || err != nil {
+		t.Fatalf("Entries() after reopening = %d entries, %v, want 3, nil", len(entries), err)
+	}
+
+	// A partial line written behind the back of an open history only costs
+	// the entry recorded right after it.
+	appendPartialLine(t, path)
+	recordAll(t, h, testEntries[3:5])
+
+	if entries, err := h.Entries(Query{}); len(entries) != 4 || err != nil {
+		t.Errorf("Entries() = %d entries, %v, want 4, nil", len(entries), err)
+	}
+
+	if _, err := h.Stats(Query{}); err != nil {
+		t.Errorf("Stats() error = %v", err)
+	}
+
+	if _, err := h.Compact(Retention{}); err != nil {
+		t.Fatalf("Compact() error = %v", err)
+	}
+
+	if entries, err := h.Entries(Query{}); len(entries) != 4 || err != nil {
+		t.Errorf("Entries() after compacting = %d entries, %v, want 4, nil", len(entries), err)
+	}
+}
+
+// appendPartialLine appends the start of an entry to the history file at
+// path, as a crash in the middle of a write would leave it.
+func appendPartialLine(t *testing.T, path string) {
+	t.Helper()
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _ = f.WriteString(`{"time": "2026-03-01T`)
+	f.Close()
+}
+
+// TestHistoryCompact drops entries by age and by count, and checks that
+// the history can still be appended to.
+func TestHistoryCompact(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  Retention
+		dropped int
+		first   time.Time
+	}{
+		{"keep all", Retention{}, 0, day(-10)},
+		{"max age", Retention{MaxAge: 7 * 24 * time.Hour}, 1, day(-5)},
+		{"max entries", Retention{MaxEntries: 2}, 4, day(-2)},
+		{"both", Retention{MaxAge: 7 * 24 * time.Hour, MaxEntries: 4}, 2, day(-4)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, path := openTestHistory(t)
+
+			recordAll(t, h, testEntries)
+
+			dropped, err := h.Compact(tt.policy)
+			if dropped != tt.dropped || err != nil {
+				t.Fatalf("Compact() = %d, %v, want %d, nil", dropped, err, tt.dropped)
+			}
+
+			recordAll(t, h, []Entry{{Name: "Beatrice", Format: "a"}})
+
+			entries, err := h.Entries(Query{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want := len(testEntries) - tt.dropped + 1; len(entries) != want || !entries[0].Time.Equal(tt.first) {
+				t.Errorf("entries after compacting = %v, want %d from %v", entries, want, tt.first)
+			}
+
+			if last := entries[len(entries)-1]; last.Name != "Beatrice" || !last.Time.Equal(historyStart) {
+				t.Errorf("last entry = %v, want Beatrice recorded now", last)
+			}
+
+			if matches, _ := filepath.Glob(path + ".*"); len(matches) != 0 {
+				t.Errorf("temporary files left behind: %v", matches)
+			}
+		})
+	}
+}
+
+// TestHistoryRecorder checks that the entry points record what they greet
+// with the default Recorder, and a Greeter with its own.
+func TestHistoryRecorder(t *testing.T) {
+	h, _ := openTestHistory(t)
+
+	old := DefaultRecorder()
+	defer SetDefaultRecorder(old)
+
+	SetDefaultRecorder(h)
+
+	if _, err := HelloError(" Rem "); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := HelloIn("ja", "Emilia"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := HelloError(""); err == nil {
+		t.Fatal(`HelloError("") error = nil, want an error`)
+	}
+
+	own, _ := openTestHistory(t)
+
+	g := newTestGreeter(t, WithRecorder(own), WithTemplates(TemplateList{{Text: "Yo, {{.Name}}"}}))
+
+	if _, err := g.Greet("Ram"); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := h.Entries(Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 2 || entries[0] != (Entry{Time: historyStart, Name: "Rem", Format: helloFormat}) || entries[1].Locale != "ja" {
+		t.Errorf("default history = %v, want Rem and Emilia in Japanese", entries)
+	}
+
+	entries, err = own.Entries(Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 1 || entries[0].Format != "Yo, {{.Name}}" {
+		t.Errorf("Greeter history = %v, want Ram greeted with its template", entries)
+	}
+}
+
+// TestHistoryErr checks that recording to a closed history fails, and
+// keeps failing.
+func TestHistoryErr(t *testing.T) {
+	h, _ := openTestHistory(t)
+
+	h.Close()
+
+	if err := h.Record(Entry{Name: "Rem"}); err == nil || h.Err() != err {
+		t.Errorf("Record() error = %v, Err() = %v, want the same error", err, h.Err())
+	}
+}
@@ -0,0 +1,333 @@
+package greetings
+
+import (
+	"errors"
+	"fmt"
+	"iter"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// IDs of the rules a name can break.
+const (
+	RuleEmpty     = "empty"
+	RuleControl   = "control"
+	RuleMaxLength = "max-length"
+	RuleDenylist  = "denylist"
+)
+
+// What is wrong with a name that breaks a rule, besides ErrEmptyName.
+var (
+	ErrControlCharacter = errors.New("control character")
+	ErrNameTooLong      = errors.New("name too long")
+	ErrDeniedName       = errors.New("denied word")
+)
+
+// DefaultMaxLength is the most grapheme clusters a name may have with the
+// rules of NewValidator.
+const DefaultMaxLength = 64
+
+// maxClusterRunes is how many runes a grapheme cluster has on average, at
+// most, in a name MaxLength accepts. Emoji joined into a family with skin
+// tones take 11.
+const maxClusterRunes = 16
+
+// ValidationError is returned for a name that breaks a rule of a
+// Validator.
+type ValidationError struct {
+	// Rule is the ID of the rule, such as RuleControl.
+	Rule string
+
+	// Name is the trimmed and normalized name.
+	Name string
+
+	// Pos is the byte offset in Name where the rule is broken.
+	Pos int
+
+	// Err says what is wrong, such as ErrEmptyName.
+	Err error
+}
+
+func (e *ValidationError) Error() string {
+	if e.Rule == RuleEmpty {
+		return e.Err.Error()
+	}
+
+	return fmt.Sprintf("%v at position %d of %q", e.Err, e.Pos, e.Name)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// Rule checks a trimmed and normalized, non-empty name, returning a
+// *ValidationError if the name breaks it.
+type Rule func(name string) *ValidationError
+
+// NoControl rejects names with control characters, such as newlines, and
+// with invisible format characters, such as U+202E, which reverses the text
+// after it. Zero width joiners and non-joiners are allowed inside a grapheme
+// cluster, where they change how the characters around them are drawn.
+func NoControl(name string) *ValidationError {
+	var starts []int
+
+	for i, r := range name {
+		if !unicode.IsControl(r) && !unicode.Is(unicode.Cf, r) {
+			continue
+		}
+
+		if r == zeroWidthJoiner || r == zeroWidthNonJoiner {
+			if starts == nil {
+				starts = graphemes(name)
+			}
+
+			if _, found := slices.BinarySearch(starts, i); !found {
+				continue
+			}
+		}
+
+		return &ValidationError{Rule: RuleControl, Name: name, Pos: i, Err: fmt.Errorf("%w %U", ErrControlCharacter, r)}
+	}
+
+	return nil
+}
+
+// MaxLength rejects names longer than n grapheme clusters, that is, than n
+// characters as a reader sees them. So that a few clusters cannot hide a
+// long name, it also rejects names of more than 16n runes.
+func MaxLength(n int) Rule {
+	return func(name string) *ValidationError {
+		runes := 0
+
+		for i := range name {
+			if runes == n*maxClusterRunes {
+				return &ValidationError{Rule: RuleMaxLength, Name: name, Pos: i, Err: fmt.Errorf("%w, more than %d code points", ErrNameTooLong, n*maxClusterRunes)}
+			}
+
+			runes++
+		}
+
+		starts := graphemes(name)
+
+		if len(starts) <= n {
+			return nil
+		}
+
+		return &ValidationError{Rule: RuleMaxLength, Name: name, Pos: starts[n], Err: fmt.Errorf("%w, more than %d characters", ErrNameTooLong, n)}
+	}
+}
+
+// Denylist rejects names with any of list in them. Words are matched
+// whole and regardless of case, so "Ass" denies "ass" but not "Cassandra".
+func Denylist(list ...string) Rule {
+	denied := make(map[string]bool, len(list))
+
+	for _, w := range list {
+		denied[foldWord(w)] = true
+	}
+
+	return func(name string) *ValidationError {
+		for pos, word := range words(name) {
+			if denied[foldWord(word)] {
+				return &ValidationError{Rule: RuleDenylist, Name: name, Pos: pos, Err: ErrDeniedName}
+			}
+		}
+
+		return nil
+	}
+}
+
+func foldWord(w string) string {
+	return strings.ToLower(norm.NFC.String(w))
+}
+
+// words yields the words of s, that is, its runs of letters, marks and
+// digits, with their byte offsets.
+func words(s string) iter.Seq2[int, string] {
+	return func(yield func(int, string) bool) {
+		start := -1
+
+		for i, r := range s {
+			inWord := unicode.IsLetter(r) || unicode.IsMark(r) || unicode.IsDigit(r)
+
+			switch {
+			case inWord && start < 0:
+				start = i
+			case !inWord && start >= 0:
+				if !yield(start, s[start:i]) {
+					return
+				}
+
+				start = -1
+			}
+		}
+
+		if start >= 0 {
+			yield(start, s[start:])
+		}
+	}
+}
+
+// Validator trims and normalizes names before checking them against its
+// rules. It is safe for concurrent use as long as its fields are not
+// changed.
+type Validator struct {
+	// Rules are checked in order, after the name is found not to be
+	// empty. The first rule broken fails the name.
+	Rules []Rule
+}
+
+// NewValidator returns a Validator that rejects control characters and
+// names longer than DefaultMaxLength grapheme clusters.
+func NewValidator() *Validator {
+	return &Validator{
+		Rules: []Rule{NoControl, MaxLength(DefaultMaxLength)},
+	}
+}
+
+// Validate returns name without leading and trailing white space and in
+// Unicode normalization form C, or a *ValidationError if it is empty or
+// breaks a rule.
+func (v *Validator) Validate(name string) (string, error) {
+	name = norm.NFC.String(strings.TrimSpace(name))
+
+	if name == "" {
+		return "", &ValidationError{Rule: RuleEmpty, Err: ErrEmptyName}
+	}
+
+	for _, rule := range v.Rules {
+		if err := rule(name); err != nil {
+			return "", err
+		}
+	}
+
+	return name, nil
+}
+
+var defaultValidator atomic.Pointer[Validator]
+
+func init() {
+	defaultValidator.Store(NewValidator())
+}
+
+// validate checks name with v, or with the default Validator if v is nil.
+func validate(v *Validator, name string) (string, error) {
+	if v == nil {
+		v = DefaultValidator()
+	}
+
+	return v.Validate(name)
+}
+
+// DefaultValidator returns the Validator of the package-level functions, the
+// Catalogs and the Greeters without one of their own.
+func DefaultValidator() *Validator {
+	return defaultValidator.Load()
+}
+
+// SetDefaultValidator makes v the Validator returned by DefaultValidator.
+func SetDefaultValidator(v *Validator) {
+	defaultValidator.Store(v)
+}
+
+// graphemes returns the byte offsets where the grapheme clusters of s
+// start. It follows the main rules of Unicode Standard Annex #29: marks,
+// variation selectors, emoji modifiers, tags, zero width joiners and
+// non-joiners extend the cluster before them, a zero width joiner after an
+// emoji joins it to the emoji that follows, regional indicators pair up into
+// flags, and CR LF is one cluster.
+func graphemes(s string) []int {
+	var starts []int
+
+	var prev rune
+	regional := 0
+
+	// pictographic is set while the cluster is an emoji followed only by
+	// extending runes, which a zero width joiner can join to another emoji.
+	pictographic := false
+
+	for i, r := range s {
+		if i == 0 || !extends(prev, r, regional, pictographic) {
+			starts = append(starts, i)
+			pictographic = isPictographic(r)
+		} else if !isExtend(r) && !isPictographic(r) {
+			pictographic = false
+		}
+
+		if isRegionalIndicator(r) {
+			regional++
+		} else {
+			regional = 0
+		}
+
+		prev = r
+	}
+
+	return starts
+}
+
+// extends reports whether r continues the cluster of prev, after a run of
+// regional indicators as long as regional. pictographic tells whether the
+// cluster is an emoji followed only by extending runes.
+func extends(prev, r rune, regional int, pictographic bool) bool {
+	switch {
+	case prev == '\r' && r == '\n':
+		return true
+	case unicode.IsControl(prev) || unicode.IsControl(r):
+		return false
+	case isExtend(r):
+		return true
+	case prev == zeroWidthJoiner && pictographic && isPictographic(r):
+		return true
+	case isRegionalIndicator(r) && regional%2 == 1:
+		return true
+	}
+
+	return false
+}
+
+// isExtend reports whether r extends any cluster before it.
+func isExtend(r rune) bool {
+	switch {
+	case r == zeroWidthJoiner, r == zeroWidthNonJoiner, unicode.IsMark(r), unicode.Is(unicode.Variation_Selector, r):
+		return true
+	case r >= 0x1F3FB && r <= 0x1F3FF, r >= 0xE0020 && r <= 0xE007F:
+		// Emoji skin tone modifiers and tags.
+		return true
+	}
+
+	return false
+}
+
+// isPictographic approximates the Extended_Pictographic property with the
+// blocks emoji come from.
+func isPictographic(r rune) bool {
+	switch {
+	case r == 0xA9, r == 0xAE, r == 0x203C, r == 0x2049, r == 0x2122, r == 0x2139:
+		return true
+	case r >= 0x2190 && r <= 0x21FF, r >= 0x2300 && r <= 0x23FF, r >= 0x25A0 && r <= 0x27BF:
+		// Arrows, technical symbols, shapes, dingbats and misc symbols.
+		return true
+	case r >= 0x2B00 && r <= 0x2BFF, r == 0x3030, r == 0x303D, r == 0x3297, r == 0x3299:
+		return true
+	case isRegionalIndicator(r), r >= 0x1F3FB && r <= 0x1F3FF:
+		return false
+	case r >= 0x1F000 && r <= 0x1FAFF, r >= 0x1FC00 && r <= 0x1FFFD:
+		return true
+	}
+
+	return false
+}
+
+const (
+	zeroWidthNonJoiner = '\u200c'
+	zeroWidthJoiner    = '\u200d'
+)
+
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1F1E6 && r <= 0x1F1FF
+}
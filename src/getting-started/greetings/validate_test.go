@@ -0,0 +1,166 @@
+package greetings
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestValidate calls Validator.Validate with names that pass, checking
+// that they come back trimmed and in NFC.
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Rem", "Rem"},
+		{"  Emilia \t\n", "Emilia"},
+		{"Rem ", "Rem"},
+		{"Zoe\u0301", "Zo\u00e9"},
+		{"Ram Rin", "Ram Rin"},
+		{"👩\u200d👩\u200d👧", "👩\u200d👩\u200d👧"},
+		{"\u0645\u06cc\u200c\u0631\u0648\u0645", "\u0645\u06cc\u200c\u0631\u0648\u0645"},
+	}
+
+	v := NewValidator()
+
+	for _, tt := range tests {
+		got, err := v.Validate(tt.name)
+		if got != tt.want || err != nil {
+			t.Errorf("Validate(%q) = %q, %v, want %q, nil", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+// TestValidateErrors calls Validator.Validate with names that break a
+// rule, checking the ValidationError.
+func TestValidateErrors(t *testing.T) {
+	v := &Validator{Rules: []Rule{NoControl, MaxLength(9), Denylist("Ass", "Heck")}}
+
+	tests := []struct {
+		name string
+		rule string
+		pos  int
+		err  error
+	}{
+		{"", RuleEmpty, 0, ErrEmptyName},
+		{" \t ", RuleEmpty, 0, ErrEmptyName},
+		{"Re\x07m", RuleControl, 2, ErrControlCharacter},
+		{"Rem\nRin", RuleControl, 3, ErrControlCharacter},
+		{"Rem\u202eniR", RuleControl, 3, ErrControlCharacter},
+		{"Re\u200bm", RuleControl, 2, ErrControlCharacter},
+		{"Rem\U000e0041", RuleControl, 3, ErrControlCharacter},
+		{"\u200dRem", RuleControl, 0, ErrControlCharacter},
+		{"Emilia Tan", RuleMaxLength, 9, ErrNameTooLong},
+		{"E\u0301milía Tan", RuleMaxLength, 11, ErrNameTooLong},
+		{"Rem HECK", RuleDenylist, 4, ErrDeniedName},
+		{"ass-Rem", RuleDenylist, 0, ErrDeniedName},
+	}
+
+	for _, tt := range tests {
+		msg, err := v.Validate(tt.name)
+
+		var verr *ValidationError
+
+		if msg != "" || !errors.As(err, &verr) {
+			t.Errorf("Validate(%q) = %q, %v, want a ValidationError", tt.name, msg, err)
+			continue
+		}
+
+		if verr.Rule != tt.rule || verr.Pos != tt.pos || !errors.Is(err, tt.err) {
+			t.Errorf("Validate(%q) = rule %s at %d (%v), want rule %s at %d", tt.name, verr.Rule, verr.Pos, err, tt.rule, tt.pos)
+		}
+	}
+
+	if _, err := v.Validate("Cassandra"); err != nil {
+		t.Errorf(`Validate("Cassandra") error = %v, want nil`, err)
+	}
+}
+
+// TestGraphemes checks that grapheme clusters are counted the way a reader
+// sees characters.
+func TestGraphemes(t *testing.T) {
+	tests := []struct {
+		s    string
+		want []int
+	}{
+		{"", nil},
+		{"Rem", []int{0, 1, 2}},
+		{"e\u0301a", []int{0, 3}},
+		{"👍🏽!", []int{0, 8}},
+		{"👩‍👩‍👧x", []int{0, 18}},
+		{"🇯🇵🇫🇷", []int{0, 8}},
+		{"❤️a", []int{0, 6}},
+		{"a\r\nb", []int{0, 1, 3}},
+		{"a\u200db", []int{0, 4}},
+		{"a\u200d👩", []int{0, 4}},
+		{"👩\u200d", []int{0}},
+		{"👍🏽\u200d👩x", []int{0, 15}},
+	}
+
+	for _, tt := range tests {
+		if got := graphemes(tt.s); !slices.Equal(got, tt.want) {
+			t.Errorf("graphemes(%q) = %v, want %v", tt.s, got, tt.want)
+		}
+	}
+
+	// Zero width joiners only join emoji, so they cannot hide a long name.
+	long := strings.Repeat("a\u200d", 500) + "a"
+
+	if n := len(graphemes(long)); n != 501 {
+		t.Errorf("graphemes(a ZWJ a ZWJ ...) = %d clusters, want 501", n)
+	}
+
+	if MaxLength(DefaultMaxLength)(long) == nil {
+		t.Errorf("MaxLength(%d) accepted 501 clusters joined by zero width joiners", DefaultMaxLength)
+	}
+
+	// Marks all extend one cluster, so only the count of runes stops them.
+	marks := "e" + strings.Repeat("\u0301", 1000)
+
+	if err := MaxLength(1)(marks); err == nil || err.Pos != 1+15*2 {
+		t.Errorf("MaxLength(1)(e and 1000 marks) = %v, want an error at %d", err, 1+15*2)
+	}
+}
+
+// TestEntryPointsValidate checks that every greeting entry point uses the
+// default Validator, and that a Greeter can have its own.
+func TestEntryPointsValidate(t *testing.T) {
+	old := DefaultValidator()
+	defer SetDefaultValidator(old)
+
+	SetDefaultValidator(&Validator{Rules: []Rule{Denylist("Subaru")}})
+
+	entryPoints := map[string]func(string) (string, error){
+		"HelloError":       HelloError,
+		"HelloRandomError": HelloRandomError,
+		"HelloIn":          func(name string) (string, error) { return HelloIn("fr", name) },
+		"HellosRandomError": func(name string) (string, error) {
+			_, err := HellosRandomError([]string{"Rem", name})
+			return "", err
+		},
+	}
+
+	for fn, greet := range entryPoints {
+		var verr *ValidationError
+
+		if _, err := greet("Natsuki Subaru"); !errors.As(err, &verr) || verr.Rule != RuleDenylist {
+			t.Errorf("%s(Natsuki Subaru) error = %v, want a denylist ValidationError", fn, err)
+		}
+	}
+
+	if msg, err := HelloError(" Emilia\u0301 "); msg != Hello("Emili\u00e1") || err != nil {
+		t.Errorf("HelloError() = %q, %v, want the name trimmed and normalized", msg, err)
+	}
+
+	g := newTestGreeter(t, WithValidator(NewValidator()), WithTemplates(TemplateList{{Text: "Hi, {{.Name}}"}}))
+
+	if msg, err := g.Greet("Natsuki Subaru"); msg != "Hi, Natsuki Subaru" || err != nil {
+		t.Errorf("Greet() = %q, %v, want the Greeter's own Validator used", msg, err)
+	}
+
+	if _, err := g.Greet(strings.Repeat("a", DefaultMaxLength+1)); !errors.Is(err, ErrNameTooLong) {
+		t.Errorf("Greet() with a long name error = %v, want ErrNameTooLong", err)
+	}
+}
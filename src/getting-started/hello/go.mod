@@ -5,3 +5,5 @@ go 1.25.4
 replace github.com/ccrsxx/learn-go/src/getting-started/greetings => ../greetings
 
 require github.com/ccrsxx/learn-go/src/getting-started/greetings v0.0.0-00010101000000-000000000000
+
+require golang.org/x/text v0.31.0 // indirect
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/ccrsxx/learn-go/src/getting-started/greetings"
+)
+
+// readNames reads the names in the file path, or in stdin if path is "-".
+// Without a column, there is one name per line and blank lines are
+// skipped. Otherwise the file is CSV and the names are in the column with
+// that header.
+func readNames(path, column string, stdin io.Reader) ([]string, error) {
+	r := stdin
+
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		r = f
+	}
+
+	if column != "" {
+		return readCSVColumn(r, column)
+	}
+
+	var names []string
+
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		if name := strings.TrimSpace(scanner.Text()); name != "" {
+			names = append(names, name)
+		}
+	}
+
+	return names, scanner.Err()
+}
+
+func readCSVColumn(r io.Reader, column string) ([]string, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	i := slices.Index(header, column)
+	if i < 0 {
+		return nil, &usageError{fmt.Sprintf("no column %q in %q", column, header)}
+	}
+
+	var names []string
+
+	for {
+		row, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return names, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if i >= len(row) {
+			line, _ := cr.FieldPos(0)
+			return nil, fmt.Errorf("line %d: no column %q", line, column)
+		}
+
+		names = append(names, strings.TrimSpace(row[i]))
+	}
+}
+
+// record is one line of output.
+type record struct {
+	Name    string `json:"name"`
+	Message string `json:"message,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+func newRecord(r greetings.Result) record {
+	rec := record{Name: r.Name, Message: r.Message}
+
+	var nameErr *greetings.NameError
+
+	if errors.As(r.Err, &nameErr) {
+		rec.Error = nameErr.Err.Error()
+	} else if r.Err != nil {
+		rec.Error = r.Err.Error()
+	}
+
+	return rec
+}
+
+// writeRecords writes records to w in format. Text has the message of
+// every name greeted on a line; names that failed are reported on stderr.
+func writeRecords(w io.Writer, format string, records []record) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+
+		return enc.Encode(records)
+	case "csv":
+		cw := csv.NewWriter(w)
+
+		_ = cw.Write([]string{"name", "message", "error"})
+
+		for _, r := range records {
+			_ = cw.Write([]string{r.Name, r.Message, r.Error})
+		}
+
+		cw.Flush()
+
+		return cw.Error()
+	}
+
+	for _, r := range records {
+		if r.Error != "" {
+			continue
+		}
+
+		if _, err := fmt.Fprintln(w, r.Message); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
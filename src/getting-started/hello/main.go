@@ -1,68 +1,330 @@
+// Command hello greets people with the greetings package.
+//
+//	hello greet [flags] [names...]   greet each name
+//	hello random [flags] [names...]  greet each name with a random greeting
+//	hello batch [flags] [names...]   greet all names concurrently, reporting
+//	                                 the ones that fail instead of stopping
+//
+// Without names on the command line, names are read from -input, one per
+// line, or from its -column if it is a CSV file with a header.
+//
+// With -tz, greet says good morning, afternoon or evening for the time of
+// day in a time zone, or the greeting of a -calendar on special dates.
+//
+// hello exits with 2 for bad usage, 3 when a name, locale or time zone is
+// invalid and 1 for any other error. When a batch fails for several reasons,
+// the lowest of their codes wins, so it only exits with 3 when every name
+// that failed was invalid.
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"io"
+	"math/rand/v2"
+	"os"
+	"os/signal"
+	"path/filepath"
 
 	"github.com/ccrsxx/learn-go/src/getting-started/greetings"
 )
 
-func getHelloMessage() string {
-	return greetings.Hello("Emilia")
+// Exit codes.
+const (
+	exitOK         = 0
+	exitInternal   = 1
+	exitUsage      = 2
+	exitValidation = 3
+)
+
+// usageError is a command line the CLI does not understand.
+type usageError struct {
+	msg string
+}
+
+func (e *usageError) Error() string {
+	return e.msg
 }
 
-func sayHello() {
-	message := getHelloMessage()
+// options are the flags shared by every command.
+type options struct {
+	locale  string
+	seed    uint64
+	seeded  bool
+	format  string
+	input   string
+	column  string
+	workers int
+
+	zone     string
+	calendar string
+}
+
+const usage = `usage: hello <command> [flags] [names...]
+
+commands:
+  greet   greet each name
+  random  greet each name with a random greeting
+  batch   greet all names concurrently, reporting the ones that fail
+
+Run hello <command> -h for the flags of a command.
+`
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
 
-	fmt.Println(message)
+	os.Exit(run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
 }
 
-func sayHelloRandom() {
-	// Set properties of the predefined Logger, including
-	// the log entry prefix and a flag to disable printing
-	// the time, source file, and line number.
-	log.SetPrefix("greetings: ")
-	log.SetFlags(0)
+// run runs the command line args and returns the exit code.
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return exitUsage
+	}
+
+	cmd := args[0]
+
+	switch cmd {
+	case "greet", "random", "batch":
+	case "-h", "-help", "--help", "help":
+		fmt.Fprint(stdout, usage)
+		return exitOK
+	default:
+		fmt.Fprintf(stderr, "hello: unknown command %q\n\n%s", cmd, usage)
+		return exitUsage
+	}
 
-	// Request a greeting message.
-	message, err := greetings.HelloRandomError("Rem Rin")
+	opts, names, err := parseFlags(cmd, args[1:], stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+
+	if err == nil && len(names) == 0 {
+		names, err = readNames(opts.input, opts.column, stdin)
+	}
+
+	var records []record
+
+	if err == nil {
+		records, err = greet(ctx, cmd, opts, names)
+	}
+
+	// A batch writes the names that were greeted even if others failed.
+	if records != nil {
+		if werr := writeRecords(stdout, opts.format, records); werr != nil {
+			err = errors.Join(err, werr)
+		}
+	}
 
-	// If an error was returned, print it to the console and
-	// exit the program.
 	if err != nil {
-		log.Fatal(err)
+		fmt.Fprintf(stderr, "hello %s: %v\n", cmd, err)
 	}
 
-	// If no error was returned, print the returned message
-	// to the console.
-	fmt.Println(message)
+	return exitCode(err)
 }
 
-func sayHellosRandom() {
-	// Set properties of the predefined Logger, including
-	// the log entry prefix and a flag to disable printing
-	// the time, source file, and line number.
-	log.SetPrefix("greetings: ")
-	log.SetFlags(0)
+func parseFlags(cmd string, args []string, stderr io.Writer) (options, []string, error) {
+	var opts options
+
+	fs := flag.NewFlagSet("hello "+cmd, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	fs.StringVar(&opts.locale, "locale", "", "greet in the language that best matches this BCP 47 tag or Accept-Language list")
+	fs.StringVar(&opts.format, "format", "text", "output format: text, json or csv")
+	fs.StringVar(&opts.input, "input", "-", "file to read names from when none are given, - for stdin")
+	fs.StringVar(&opts.column, "column", "", "read names from this column of -input as a CSV file with a header")
 
-	names := []string{"Priscilla", "Rem", "Emilia"}
+	if cmd == "greet" {
+		fs.StringVar(&opts.zone, "tz", "", "greet for the time of day in this IANA time zone, such as Asia/Tokyo, or Local")
+		fs.StringVar(&opts.calendar, "calendar", "", "with -tz, greet on special dates from this JSON calendar file")
+	} else {
+		fs.Uint64Var(&opts.seed, "seed", 0, "seed the random greetings, so they are the same every run")
+	}
+
+	if cmd == "batch" {
+		fs.IntVar(&opts.workers, "workers", 0, "number of names greeted at once, 0 for one per CPU; with -seed, names are greeted one at a time")
+	}
 
-	message, err := greetings.HellosRandomError(names)
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return opts, nil, err
+		}
+
+		return opts, nil, &usageError{err.Error()}
+	}
+
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "seed" {
+			opts.seeded = true
+		}
+	})
+
+	switch opts.format {
+	case "text", "json", "csv":
+	default:
+		return opts, nil, &usageError{fmt.Sprintf("unknown format %q", opts.format)}
+	}
 
-	// If an error was returned, print it to the console and
-	// exit the program.
+	if opts.zone != "" && opts.locale != "" {
+		return opts, nil, &usageError{"-tz greets in English, and cannot be used with -locale"}
+	}
+
+	if opts.calendar != "" && opts.zone == "" {
+		return opts, nil, &usageError{"-calendar needs -tz"}
+	}
+
+	return opts, fs.Args(), nil
+}
+
+// greet greets names as cmd does. Greet and random stop at the first name
+// that fails; a batch greets every name and returns a record for each.
+func greet(ctx context.Context, cmd string, opts options, names []string) ([]record, error) {
+	if len(names) == 0 {
+		return nil, &usageError{"no names to greet"}
+	}
+
+	hello, err := greeterFor(cmd, opts)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
-	// If no error was returned, print the returned message
-	// to the console.
-	fmt.Println(message)
+	if cmd == "batch" {
+		workers := opts.workers
+
+		// Seeded greetings only repeat if the names draw from the seed in order.
+		if opts.seeded {
+			workers = 1
+		}
+
+		results, err := greetings.GreetAllFunc(ctx, names, workers, hello)
 
+		records := make([]record, len(results))
+
+		for i, r := range results {
+			records[i] = newRecord(r)
+		}
+
+		return records, err
+	}
+
+	records := make([]record, 0, len(names))
+
+	for _, name := range names {
+		message, err := hello(name)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", name, err)
+		}
+
+		records = append(records, record{Name: name, Message: message})
+	}
+
+	return records, nil
 }
 
-func main() {
-	// sayHello()
-	// sayHelloRandom()
-	sayHellosRandom()
+// greeterFor returns how cmd greets one name. It is safe for concurrent
+// use, so a batch can greet many names at once.
+func greeterFor(cmd string, opts options) (func(string) (string, error), error) {
+	if opts.zone != "" {
+		g := greetings.NewContextualGreeter()
+
+		if opts.calendar != "" {
+			cal, err := greetings.LoadCalendar(os.DirFS(filepath.Dir(opts.calendar)), filepath.Base(opts.calendar))
+			if err != nil {
+				return nil, err
+			}
+
+			g.Calendar = cal
+		}
+
+		return func(name string) (string, error) {
+			return g.Greet(name, opts.zone)
+		}, nil
+	}
+
+	if cmd == "greet" && opts.locale == "" {
+		return greetings.HelloError, nil
+	}
+
+	g, err := newGreeter(cmd, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.locale != "" {
+		c := greetings.DefaultCatalog()
+
+		if _, err := c.Match(opts.locale); err != nil {
+			return nil, err
+		}
+
+		return func(name string) (string, error) {
+			return g.GreetIn(c, opts.locale, name, greetings.Unspecified)
+		}, nil
+	}
+
+	return g.Greet, nil
+}
+
+// newGreeter returns the Greeter that picks the greetings of cmd: always
+// the first one for greet, a seeded one with -seed and the default one
+// otherwise.
+func newGreeter(cmd string, opts options) (*greetings.Greeter, error) {
+	switch {
+	case cmd == "greet":
+		return greetings.NewGreeter(greetings.WithSelector(firstSelector{}))
+	case opts.seeded:
+		return greetings.NewGreeter(greetings.WithSeed(opts.seed))
+	default:
+		return greetings.Default(), nil
+	}
+}
+
+// firstSelector always picks the first greeting that can be picked.
+type firstSelector struct{}
+
+func (firstSelector) Select(r *rand.Rand, weights []float64) int {
+	for i, w := range weights {
+		if w > 0 {
+			return i
+		}
+	}
+
+	return 0
+}
+
+// exitCode returns the exit code for err. An error joining several gets
+// the lowest code of its parts, so it is only a validation error if all of
+// them are.
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		code := exitValidation
+
+		for _, e := range joined.Unwrap() {
+			code = min(code, exitCode(e))
+		}
+
+		return code
+	}
+
+	var usage *usageError
+	var invalid *greetings.ValidationError
+	var locale *greetings.UnsupportedLocaleError
+	var zone *greetings.UnknownTimeZoneError
+
+	switch {
+	case errors.As(err, &usage):
+		return exitUsage
+	case errors.As(err, &invalid), errors.As(err, &locale), errors.As(err, &zone):
+		return exitValidation
+	}
+
+	return exitInternal
 }
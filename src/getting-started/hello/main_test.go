@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func runHello(t *testing.T, stdin string, args ...string) (code int, stdout, stderr string) {
+	t.Helper()
+
+	var out, errOut bytes.Buffer
+
+	code = run(context.Background(), args, strings.NewReader(stdin), &out, &errOut)
+
+	return code, out.String(), errOut.String()
+}
+
+func TestRunExitCodes(t *testing.T) {
+	tests := []struct {
+		name  string
+		stdin string
+		args  []string
+		code  int
+	}{
+		{"greet", "", []string{"greet", "Rem"}, exitOK},
+		{"help", "", []string{"-h"}, exitOK},
+		{"command help", "", []string{"batch", "-h"}, exitOK},
+		{"no command", "", nil, exitUsage},
+		{"unknown command", "", []string{"wave", "Rem"}, exitUsage},
+		{"unknown flag", "", []string{"greet", "-loud", "Rem"}, exitUsage},
+		{"no seed for greet", "", []string{"greet", "-seed", "1", "Rem"}, exitUsage},
+		{"unknown format", "", []string{"random", "-format", "xml", "Rem"}, exitUsage},
+		{"no names", "\n\n", []string{"greet"}, exitUsage},
+		{"empty name", "", []string{"greet", ""}, exitValidation},
+		{"unsupported locale", "", []string{"random", "-locale", "pt-BR", "Rem"}, exitValidation},
+		{"empty name in batch", "", []string{"batch", "Rem", ""}, exitValidation},
+		{"control character", "", []string{"random", "Re\am"}, exitValidation},
+		{"unknown time zone", "", []string{"greet", "-tz", "Mars/Olympus_Mons", "Rem"}, exitValidation},
+		{"tz and locale", "", []string{"greet", "-tz", "UTC", "-locale", "fr", "Rem"}, exitUsage},
+		{"calendar without tz", "", []string{"greet", "-calendar", "calendar.json", "Rem"}, exitUsage},
+		{"missing calendar", "", []string{"greet", "-tz", "UTC", "-calendar", filepath.Join(t.TempDir(), "calendar.json"), "Rem"}, exitInternal},
+		{"missing input", "", []string{"greet", "-input", filepath.Join(t.TempDir(), "names.txt")}, exitInternal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code, _, stderr := runHello(t, tt.stdin, tt.args...); code != tt.code {
+				t.Errorf("run(%q) = %d, want %d; stderr:\n%s", tt.args, code, tt.code, stderr)
+			}
+		})
+	}
+}
+
+func TestRunGreet(t *testing.T) {
+	code, stdout, _ := runHello(t, "", "greet", "Rem", "Ram")
+
+	if want := "Hi, Rem. Welcome tan!\nHi, Ram. Welcome tan!\n"; code != exitOK || stdout != want {
+		t.Errorf("greet = %d %q, want %q", code, stdout, want)
+	}
+}
+
+// TestRunSeed checks that the same seed gives the same random greetings.
+func TestRunSeed(t *testing.T) {
+	names := []string{"Rem", "Ram", "Emilia", "Beatrice", "Priscilla"}
+
+	for _, cmd := range []string{"random", "batch"} {
+		_, a, _ := runHello(t, "", append([]string{cmd, "-seed", "42"}, names...)...)
+		_, b, _ := runHello(t, "", append([]string{cmd, "-seed", "42"}, names...)...)
+
+		if a != b || strings.Count(a, "\n") != len(names) {
+			t.Errorf("%s -seed 42 greeted differently:\n%s\n%s", cmd, a, b)
+		}
+	}
+}
+
+func TestRunLocale(t *testing.T) {
+	code, stdout, _ := runHello(t, "", "greet", "-locale", "ja", "Rem")
+
+	if code != exitOK || !strings.Contains(stdout, "Rem") || strings.Contains(stdout, "Hi") {
+		t.Errorf("greet -locale ja = %d %q, want a Japanese greeting", code, stdout)
+	}
+
+	code, stdout, _ = runHello(t, "", "batch", "-locale", "fr", "-format", "json", "Rem", "")
+
+	var records []record
+
+	if err := json.Unmarshal([]byte(stdout), &records); err != nil {
+		t.Fatal(err)
+	}
+
+	if code != exitValidation || len(records) != 2 || records[0].Message == "" || records[1].Error != "empty name" {
+		t.Errorf("batch -locale fr = %d %+v, want Rem greeted and the empty name failed", code, records)
+	}
+}
+
+func TestRunLocaleSeed(t *testing.T) {
+	names := []string{"Rem", "Ram", "Emilia", "Beatrice", "Priscilla", "Felt", "Anastasia", "Crusch"}
+
+	// greet always picks the same greeting, random does with -seed.
+	for _, args := range [][]string{
+		{"greet", "-locale", "fr"},
+		{"random", "-locale", "fr", "-seed", "1"},
+		{"batch", "-locale", "fr", "-seed", "1"},
+	} {
+		_, a, _ := runHello(t, "", append(args, names...)...)
+		_, b, _ := runHello(t, "", append(args, names...)...)
+
+		if a != b || strings.Count(a, "\n") != len(names) {
+			t.Errorf("%q greeted differently:\n%s\n%s", args, a, b)
+		}
+	}
+
+	_, stdout, _ := runHello(t, "", append([]string{"greet", "-locale", "fr"}, names...)...)
+
+	if strings.Count(stdout, "Bonjour") != len(names) {
+		t.Errorf("greet -locale fr = %q, want the first French greeting for everyone", stdout)
+	}
+}
+
+func TestRunTimeZone(t *testing.T) {
+	code, stdout, _ := runHello(t, "", "greet", "-tz", "Asia/Tokyo", "Rem")
+
+	if code != exitOK || !strings.HasPrefix(stdout, "Good ") || !strings.HasSuffix(stdout, ", Rem!\n") {
+		t.Errorf("greet -tz Asia/Tokyo = %d %q, want a greeting for the time of day", code, stdout)
+	}
+
+	path := filepath.Join(t.TempDir(), "calendar.json")
+
+	// Every day of the year, so the test does not depend on the date.
+	var entries []string
+
+	for d := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC); d.Year() == 2024; d = d.AddDate(0, 0, 1) {
+		entries = append(entries, fmt.Sprintf(`{"date": %q, "text": "Happy day, {{.Name}}!"}`, d.Format("01-02")))
+	}
+
+	if err := os.WriteFile(path, []byte("["+strings.Join(entries, ",")+"]"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	code, stdout, _ = runHello(t, "", "greet", "-tz", "UTC", "-calendar", path, "Rem")
+
+	if want := "Happy day, Rem!\n"; code != exitOK || stdout != want {
+		t.Errorf("greet -calendar = %d %q, want %q", code, stdout, want)
+	}
+}
+
+func TestRunStdin(t *testing.T) {
+	_, stdout, _ := runHello(t, "Rem\n\n  Ram  \n", "greet")
+
+	if want := "Hi, Rem. Welcome tan!\nHi, Ram. Welcome tan!\n"; stdout != want {
+		t.Errorf("greet from stdin = %q, want %q", stdout, want)
+	}
+}
+
+func TestRunCSV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "people.csv")
+
+	if err := os.WriteFile(path, []byte("id,name\n1,Rem\n2,\"Emilia, Half Elf\"\n3,\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	code, stdout, stderr := runHello(t, "", "batch", "-input", path, "-column", "name", "-format", "csv", "-workers", "2")
+
+	if code != exitValidation || !strings.Contains(stderr, "empty name") {
+		t.Errorf("batch = %d, stderr %q, want the empty name reported", code, stderr)
+	}
+
+	rows, err := csv.NewReader(strings.NewReader(stdout)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]string{
+		{"name", "message", "error"},
+		{"Rem", "", ""},
+		{"Emilia, Half Elf", "", ""},
+		{"", "", "empty name"},
+	}
+
+	if len(rows) != len(want) {
+		t.Fatalf("batch CSV = %q, want %d rows", rows, len(want))
+	}
+
+	for i, row := range rows {
+		if row[0] != want[i][0] || row[2] != want[i][2] || (i > 0 && i < 3 && !strings.Contains(row[1], row[0])) {
+			t.Errorf("row %d = %q, want %q with a greeting", i, row, want[i])
+		}
+	}
+
+	if code, _, _ := runHello(t, "", "greet", "-input", path, "-column", "email"); code != exitUsage {
+		t.Errorf("greet -column email = %d, want %d", code, exitUsage)
+	}
+}
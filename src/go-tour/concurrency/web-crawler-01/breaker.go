@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without fetching while a host's circuit is open.
+var ErrCircuitOpen = errors.New("circuit open")
+
+// BreakerFetcher stops fetching from hosts that keep failing. After
+// Threshold failures in a row the host's circuit opens and every fetch to it
+// fails with ErrCircuitOpen for Cooldown. Then a single fetch is let through
+// as a probe: if it works the circuit closes again, otherwise it stays open
+// for another Cooldown.
+type BreakerFetcher struct {
+	Fetcher Fetcher
+
+	// Threshold is the number of failures in a row that opens a circuit.
+	// Zero or less never opens one.
+	Threshold int
+	Cooldown  time.Duration
+
+	// IsFailure decides which errors count against a host. It defaults to
+	// IsTransient, so a missing page does not open the circuit.
+	IsFailure func(err error) bool
+
+	// Now returns the current time. It defaults to time.Now.
+	Now func() time.Time
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+type circuit struct {
+	failures  int
+	openUntil time.Time
+
+	// probing is set while the single fetch after Cooldown is running.
+	probing bool
+
+	// generation changes whenever the circuit opens or lets a probe
+	// through. Fetches started in an older generation are not recorded,
+	// so a slow fetch from before the circuit opened cannot close it.
+	generation int
+}
+
+// NewBreakerFetcher returns a BreakerFetcher that opens a host's circuit
+// after threshold failures in a row and keeps it open for cooldown.
+func NewBreakerFetcher(fetcher Fetcher, threshold int, cooldown time.Duration) *BreakerFetcher {
+	return &BreakerFetcher{
+		Fetcher:   fetcher,
+		Threshold: threshold,
+		Cooldown:  cooldown,
+		IsFailure: IsTransient,
+		Now:       time.Now,
+		circuits:  make(map[string]*circuit),
+	}
+}
+
+// WithBreaker returns a Middleware with a circuit breaker per host.
+func WithBreaker(threshold int, cooldown time.Duration) Middleware {
+	return func(f Fetcher) Fetcher {
+		return NewBreakerFetcher(f, threshold, cooldown)
+	}
+}
+
+func (f *BreakerFetcher) Fetch(url string) (string, []string, error) {
+	return bodyAndLinks(f.FetchResponse(context.Background(), url))
+}
+
+func (f *BreakerFetcher) FetchResponse(ctx context.Context, url string) (*Response, error) {
+	return f.guard(url, func() (*Response, error) {
+		return fetchResponse(ctx, f.Fetcher, url)
+	})
+}
+
+func (f *BreakerFetcher) Revalidate(ctx context.Context, url string, cached *Response) (*Response, error) {
+	return f.guard(url, func() (*Response, error) {
+		return revalidate(ctx, f.Fetcher, url, cached)
+	})
+}
+
+func (f *BreakerFetcher) guard(url string, fetch func() (*Response, error)) (*Response, error) {
+	host := hostOf(url)
+
+	generation, ok := f.allow(host)
+	if !ok {
+		return nil, fmt.Errorf("%w for %s: %s", ErrCircuitOpen, host, url)
+	}
+
+	resp, err := fetch()
+
+	f.record(host, generation, err)
+
+	return resp, err
+}
+
+// allow reports whether a fetch to host may go ahead, and the generation
+// of the circuit it starts in.
+func (f *BreakerFetcher) allow(host string) (int, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	c := f.circuit(host)
+
+	if f.Threshold <= 0 || c.failures < f.Threshold {
+		return c.generation, true
+	}
+
+	if c.probing || f.now().Before(c.openUntil) {
+		return c.generation, false
+	}
+
+	c.probing = true
+	c.generation++
+
+	return c.generation, true
+}
+
+// record updates the circuit of host with the outcome of a fetch started
+// in generation. Outcomes from an older generation are ignored.
+func (f *BreakerFetcher) record(host string, generation int, err error) {
+	isFailure := f.IsFailure
+	if isFailure == nil {
+		isFailure = IsTransient
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	c := f.circuit(host)
+
+	if generation != c.generation {
+		return
+	}
+
+	c.probing = false
+
+	if err == nil || !isFailure(err) {
+		c.failures = 0
+		return
+	}
+
+	c.failures++
+
+	if c.failures >= f.Threshold {
+		c.openUntil = f.now().Add(f.Cooldown)
+		c.generation++
+	}
+}
+
+// circuit returns the circuit of host. The caller holds the lock.
+func (f *BreakerFetcher) circuit(host string) *circuit {
+	if f.circuits == nil {
+		f.circuits = make(map[string]*circuit)
+	}
+
+	c, ok := f.circuits[host]
+	if !ok {
+		c = &circuit{}
+		f.circuits[host] = c
+	}
+
+	return c
+}
+
+func (f *BreakerFetcher) now() time.Time {
+	if f.Now == nil {
+		return time.Now()
+	}
+
+	return f.Now()
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheFetcher keeps successful responses of the Fetcher it wraps in
+// memory, following HTTP caching rules. A response is served from the cache
+// while it is fresh according to Cache-Control max-age or Expires. Once it
+// is stale, it is revalidated with a conditional request built from its ETag
+// and Last-Modified headers when it has them.
+type CacheFetcher struct {
+	Fetcher Fetcher
+
+	// Now returns the current time. It defaults to time.Now.
+	Now func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+	stats   CacheStats
+}
+
+// CacheStats counts how fetches through a CacheFetcher were answered.
+type CacheStats struct {
+	// Hits were served from the cache without a request.
+	Hits int
+
+	// Revalidated were confirmed unchanged by a conditional request.
+	Revalidated int
+
+	// Misses needed a full fetch.
+	Misses int
+}
+
+type cacheEntry struct {
+	resp    *Response
+	expires time.Time
+}
+
+// NewCacheFetcher returns an empty CacheFetcher in front of fetcher.
+func NewCacheFetcher(fetcher Fetcher) *CacheFetcher {
+	return &CacheFetcher{
+		Fetcher: fetcher,
+		Now:     time.Now,
+		entries: make(map[string]*cacheEntry),
+	}
+}
+
+// WithCache returns a Middleware that caches fetches in memory.
+func WithCache() Middleware {
+	return func(f Fetcher) Fetcher {
+		return NewCacheFetcher(f)
+	}
+}
+
+// Stats returns how many fetches were answered by the cache so far.
+func (f *CacheFetcher) Stats() CacheStats {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.stats
+}
+
+func (f *CacheFetcher) Fetch(url string) (string, []string, error) {
+	return bodyAndLinks(f.FetchResponse(context.Background(), url))
+}
+
+func (f *CacheFetcher) FetchResponse(ctx context.Context, url string) (*Response, error) {
+	now := f.now()
+
+	f.mu.Lock()
+	entry := f.entries[url]
+
+	if entry != nil && now.Before(entry.expires) {
+		f.stats.Hits++
+		f.mu.Unlock()
+
+		return copyResponse(entry.resp), nil
+	}
+
+	f.mu.Unlock()
+
+	if entry != nil && hasValidators(entry.resp) {
+		resp, err := revalidate(ctx, f.Fetcher, url, entry.resp)
+
+		if err == nil && resp.StatusCode == http.StatusNotModified {
+			fresh := copyResponse(entry.resp)
+
+			// A 304 may carry newer caching headers for the stored response.
+			for key, values := range resp.Header {
+				fresh.Header[key] = values
+			}
+
+			f.store(url, fresh, now)
+
+			f.mu.Lock()
+			f.stats.Revalidated++
+			f.mu.Unlock()
+
+			return copyResponse(fresh), nil
+		}
+
+		return f.miss(url, resp, err, now)
+	}
+
+	resp, err := fetchResponse(ctx, f.Fetcher, url)
+
+	return f.miss(url, resp, err, now)
+}
+
+// Revalidate skips the cache and passes the conditional request on, so a
+// CacheFetcher can sit below another cache.
+func (f *CacheFetcher) Revalidate(ctx context.Context, url string, cached *Response) (*Response, error) {
+	return revalidate(ctx, f.Fetcher, url, cached)
+}
+
+// miss stores the result of a full fetch and counts it.
+func (f *CacheFetcher) miss(url string, resp *Response, err error, now time.Time) (*Response, error) {
+	f.mu.Lock()
+	f.stats.Misses++
+	f.mu.Unlock()
+
+	switch {
+	case err == nil:
+		f.store(url, resp, now)
+	case errors.Is(err, ErrNotFound):
+		f.mu.Lock()
+		delete(f.entries, url)
+		f.mu.Unlock()
+	}
+
+	return resp, err
+}
+
+// store caches resp if HTTP caching rules allow it and it will ever be
+// useful: it must be fresh for a while or be able to be revalidated.
+func (f *CacheFetcher) store(url string, resp *Response, now time.Time) {
+	if resp.StatusCode != http.StatusOK {
+		return
+	}
+
+	directives := cacheControl(resp.Header)
+
+	if _, ok := directives["no-store"]; ok {
+		return
+	}
+
+	expires := freshUntil(resp.Header, directives, now)
+
+	if !expires.After(now) && !hasValidators(resp) {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.entries[url] = &cacheEntry{resp: copyResponse(resp), expires: expires}
+}
+
+func (f *CacheFetcher) now() time.Time {
+	if f.Now == nil {
+		return time.Now()
+	}
+
+	return f.Now()
+}
+
+// freshUntil returns when a response received at now goes stale.
+func freshUntil(h http.Header, directives map[string]string, now time.Time) time.Time {
+	if _, ok := directives["no-cache"]; ok {
+		return now
+	}
+
+	if maxAge, ok := directives["max-age"]; ok {
+		seconds, err := strconv.Atoi(maxAge)
+		if err != nil {
+			return now
+		}
+
+		// Age is how long the response already sat in caches along the way.
+		age, _ := strconv.Atoi(h.Get("Age"))
+
+		return now.Add(time.Duration(seconds-age) * time.Second)
+	}
+
+	if expires := h.Get("Expires"); expires != "" {
+		// An Expires header that does not parse means already expired.
+		t, err := http.ParseTime(expires)
+		if err != nil {
+			return now
+		}
+
+		// Expires is relative to the server's clock, which Date tells us.
+		if date, err := http.ParseTime(h.Get("Date")); err == nil {
+			return now.Add(t.Sub(date))
+		}
+
+		return t
+	}
+
+	return now
+}
+
+// cacheControl parses the Cache-Control header into its directives.
+func cacheControl(h http.Header) map[string]string {
+	directives := make(map[string]string)
+
+	for _, value := range h.Values("Cache-Control") {
+		for part := range strings.SplitSeq(value, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(part), "=")
+
+			if name != "" {
+				directives[strings.ToLower(name)] = strings.Trim(arg, `"`)
+			}
+		}
+	}
+
+	return directives
+}
+
+func hasValidators(resp *Response) bool {
+	return resp.Header.Get("ETag") != "" || resp.Header.Get("Last-Modified") != ""
+}
+
+// copyResponse returns a copy of resp that the caller can change without
+// touching the cache.
+func copyResponse(resp *Response) *Response {
+	c := *resp
+	c.Header = resp.Header.Clone()
+
+	if c.Header == nil {
+		c.Header = make(http.Header)
+	}
+
+	c.Links = append([]string(nil), resp.Links...)
+
+	return &c
+}
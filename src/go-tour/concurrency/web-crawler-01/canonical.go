@@ -0,0 +1,282 @@
+package main
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// Canonicalizer rewrites URLs into a canonical form so that different
+// spellings of the same page dedupe to one key. Each rule can be turned
+// on or off on its own.
+type Canonicalizer struct {
+	// LowercaseHost lowercases the host. The scheme is always lowercased.
+	LowercaseHost bool
+
+	// DropDefaultPort removes :80 from http and :443 from https URLs.
+	DropDefaultPort bool
+
+	// DropFragment removes the #fragment.
+	DropFragment bool
+
+	// SortQuery orders query parameters by key.
+	SortQuery bool
+
+	// NormalizeEscapes decodes percent-encoded unreserved characters and
+	// uppercases the hex digits of every other escape.
+	NormalizeEscapes bool
+
+	// RemoveDotSegments resolves "." and ".." path segments.
+	RemoveDotSegments bool
+
+	// IgnoreTrailingSlash treats /pkg and /pkg/ as the same path.
+	IgnoreTrailingSlash bool
+
+	// StripTrackingParams removes the query parameters in TrackingParams.
+	StripTrackingParams bool
+
+	// TrackingParams are the parameter names removed by StripTrackingParams.
+	// A name ending in "*" matches every parameter with that prefix.
+	TrackingParams []string
+}
+
+// DefaultTrackingParams are common analytics parameters that do not
+// change the page that is served.
+var DefaultTrackingParams = []string{
+	"utm_*",
+	"gclid",
+	"fbclid",
+	"mc_cid",
+	"mc_eid",
+	"_ga",
+}
+
+// NewCanonicalizer returns a Canonicalizer with every rule on except
+// StripTrackingParams.
+func NewCanonicalizer() *Canonicalizer {
+	return &Canonicalizer{
+		LowercaseHost:       true,
+		DropDefaultPort:     true,
+		DropFragment:        true,
+		SortQuery:           true,
+		NormalizeEscapes:    true,
+		RemoveDotSegments:   true,
+		IgnoreTrailingSlash: true,
+		TrackingParams:      DefaultTrackingParams,
+	}
+}
+
+// Canonicalize returns the canonical form of rawURL.
+func (c *Canonicalizer) Canonicalize(rawURL string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return "", err
+	}
+
+	// Opaque URLs such as mailto: have no host or path to work on.
+	if u.Opaque != "" {
+		return u.String(), nil
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	host := u.Host
+
+	if c.LowercaseHost {
+		host = strings.ToLower(host)
+	}
+
+	if c.DropDefaultPort {
+		if port := u.Port(); (scheme == "http" && port == "80") || (scheme == "https" && port == "443") {
+			host = strings.TrimSuffix(host, ":"+port)
+		}
+	}
+
+	path := u.EscapedPath()
+
+	if c.NormalizeEscapes {
+		path = normalizeEscapes(path)
+	}
+
+	if c.RemoveDotSegments {
+		path = removeDotSegments(path)
+	}
+
+	if c.IgnoreTrailingSlash && len(path) > 1 {
+		path = strings.TrimRight(path, "/")
+	}
+
+	if path == "" && host != "" {
+		path = "/"
+	}
+
+	query := u.RawQuery
+
+	if c.NormalizeEscapes {
+		query = normalizeEscapes(query)
+	}
+
+	query = c.canonicalQuery(query)
+
+	var b strings.Builder
+
+	if scheme != "" {
+		b.WriteString(scheme + ":")
+	}
+
+	if host != "" || u.User != nil || scheme == "http" || scheme == "https" {
+		b.WriteString("//")
+
+		if u.User != nil {
+			b.WriteString(u.User.String() + "@")
+		}
+
+		b.WriteString(host)
+	}
+
+	b.WriteString(path)
+
+	if query != "" {
+		b.WriteString("?" + query)
+	}
+
+	if !c.DropFragment && u.Fragment != "" {
+		b.WriteString("#" + u.EscapedFragment())
+	}
+
+	return b.String(), nil
+}
+
+func (c *Canonicalizer) canonicalQuery(query string) string {
+	if query == "" || (!c.SortQuery && !c.StripTrackingParams) {
+		return query
+	}
+
+	params := strings.Split(query, "&")
+
+	if c.StripTrackingParams {
+		params = slices.DeleteFunc(params, func(param string) bool {
+			key, _, _ := strings.Cut(param, "=")
+			return c.isTracking(key)
+		})
+	}
+
+	// Empty pairs come from "a=1&&b=2" or a trailing "&".
+	params = slices.DeleteFunc(params, func(param string) bool {
+		return param == ""
+	})
+
+	if c.SortQuery {
+		// Repeated keys keep their relative order, since some servers read
+		// ?tag=a&tag=b as an ordered list.
+		slices.SortStableFunc(params, func(a, b string) int {
+			ak, _, _ := strings.Cut(a, "=")
+			bk, _, _ := strings.Cut(b, "=")
+
+			return strings.Compare(ak, bk)
+		})
+	}
+
+	return strings.Join(params, "&")
+}
+
+func (c *Canonicalizer) isTracking(key string) bool {
+	key = strings.ToLower(key)
+
+	for _, name := range c.TrackingParams {
+		if prefix, ok := strings.CutSuffix(name, "*"); ok {
+			if strings.HasPrefix(key, prefix) {
+				return true
+			}
+		} else if key == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// normalizeEscapes decodes escapes of unreserved characters, which mean the
+// same thing either way, and uppercases the hex digits of the rest.
+func normalizeEscapes(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' || i+2 >= len(s) || !isHex(s[i+1]) || !isHex(s[i+2]) {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		c := unhex(s[i+1])<<4 | unhex(s[i+2])
+
+		if isUnreserved(c) {
+			b.WriteByte(c)
+		} else {
+			b.WriteString(strings.ToUpper(s[i : i+3]))
+		}
+
+		i += 2
+	}
+
+	return b.String()
+}
+
+func isHex(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
+
+// isUnreserved reports whether c is an unreserved character of RFC 3986.
+func isUnreserved(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+// removeDotSegments resolves "." and ".." segments as described in
+// RFC 3986, section 5.2.4.
+func removeDotSegments(path string) string {
+	if !strings.Contains(path, ".") {
+		return path
+	}
+
+	var out []string
+
+	segments := strings.Split(path, "/")
+
+	for i, seg := range segments {
+		last := i == len(segments)-1
+
+		switch seg {
+		case ".":
+			// A trailing "." still names a directory.
+			if last {
+				out = append(out, "")
+			}
+		case "..":
+			if len(out) > 1 {
+				out = out[:len(out)-1]
+			}
+
+			if last {
+				out = append(out, "")
+			}
+		default:
+			out = append(out, seg)
+		}
+	}
+
+	return strings.Join(out, "/")
+}
@@ -0,0 +1,106 @@
+package main
+
+import "testing"
+
+func TestCanonicalizeRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(c *Canonicalizer)
+		in    string
+		want  string
+	}{
+		{"scheme is always lowercased", nil, "HTTPS://Golang.org/pkg", "https://Golang.org/pkg"},
+		{"lowercase host", func(c *Canonicalizer) { c.LowercaseHost = true }, "HTTPS://GOLANG.ORG/pkg", "https://golang.org/pkg"},
+		{"keep default port", nil, "https://golang.org:443/pkg", "https://golang.org:443/pkg"},
+		{"drop https port", func(c *Canonicalizer) { c.DropDefaultPort = true }, "https://golang.org:443/pkg", "https://golang.org/pkg"},
+		{"drop http port", func(c *Canonicalizer) { c.DropDefaultPort = true }, "http://golang.org:80/pkg", "http://golang.org/pkg"},
+		{"keep other port", func(c *Canonicalizer) { c.DropDefaultPort = true }, "http://golang.org:8080/pkg", "http://golang.org:8080/pkg"},
+		{"keep fragment", nil, "https://golang.org/pkg#top", "https://golang.org/pkg#top"},
+		{"drop fragment", func(c *Canonicalizer) { c.DropFragment = true }, "https://golang.org/pkg#top", "https://golang.org/pkg"},
+		{"keep query order", nil, "https://golang.org/?b=2&a=1", "https://golang.org/?b=2&a=1"},
+		{"sort query", func(c *Canonicalizer) { c.SortQuery = true }, "https://golang.org/?b=2&a=1", "https://golang.org/?a=1&b=2"},
+		{"sort query keeps repeated keys in order", func(c *Canonicalizer) { c.SortQuery = true }, "https://golang.org/?t=z&b=1&t=a", "https://golang.org/?b=1&t=z&t=a"},
+		{"decode unreserved escapes", func(c *Canonicalizer) { c.NormalizeEscapes = true }, "https://golang.org/%7Euser/%41bc", "https://golang.org/~user/Abc"},
+		{"uppercase reserved escapes", func(c *Canonicalizer) { c.NormalizeEscapes = true }, "https://golang.org/a%2fb?q=%3d", "https://golang.org/a%2Fb?q=%3D"},
+		{"keep dot segments", nil, "https://golang.org/a/../b", "https://golang.org/a/../b"},
+		{"remove dot segments", func(c *Canonicalizer) { c.RemoveDotSegments = true }, "https://golang.org/a/./b/../c", "https://golang.org/a/c"},
+		{"dot segments above root", func(c *Canonicalizer) { c.RemoveDotSegments = true }, "https://golang.org/../../a", "https://golang.org/a"},
+		{"trailing dot dot", func(c *Canonicalizer) { c.RemoveDotSegments = true }, "https://golang.org/a/b/..", "https://golang.org/a/"},
+		{"keep trailing slash", nil, "https://golang.org/pkg/", "https://golang.org/pkg/"},
+		{"ignore trailing slash", func(c *Canonicalizer) { c.IgnoreTrailingSlash = true }, "https://golang.org/pkg/", "https://golang.org/pkg"},
+		{"root keeps its slash", func(c *Canonicalizer) { c.IgnoreTrailingSlash = true }, "https://golang.org/", "https://golang.org/"},
+		{"empty path", nil, "https://golang.org", "https://golang.org/"},
+		{"keep tracking params", nil, "https://golang.org/?utm_source=x&a=1", "https://golang.org/?utm_source=x&a=1"},
+		{
+			"strip tracking params",
+			func(c *Canonicalizer) {
+				c.StripTrackingParams = true
+				c.TrackingParams = DefaultTrackingParams
+			},
+			"https://golang.org/?utm_source=x&a=1&UTM_Medium=y&gclid=1",
+			"https://golang.org/?a=1",
+		},
+		{"opaque URL", nil, "mailto:Gopher@golang.org", "mailto:Gopher@golang.org"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Canonicalizer{}
+
+			if tt.setup != nil {
+				tt.setup(c)
+			}
+
+			got, err := c.Canonicalize(tt.in)
+			if err != nil || got != tt.want {
+				t.Errorf("Canonicalize(%q) = %q, %v, want %q, nil", tt.in, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanonicalizeDefaults(t *testing.T) {
+	variants := []string{
+		"https://golang.org/pkg",
+		"https://golang.org/pkg/",
+		"HTTPS://GOLANG.ORG/pkg/#top",
+		"https://golang.org:443/pkg/./",
+		"https://golang.org/%70kg",
+	}
+
+	c := NewCanonicalizer()
+
+	for _, v := range variants {
+		if got, _ := c.Canonicalize(v); got != "https://golang.org/pkg" {
+			t.Errorf("Canonicalize(%q) = %q, want %q", v, got, "https://golang.org/pkg")
+		}
+	}
+
+	a, _ := c.Canonicalize("https://golang.org/search?b=2&a=1")
+	b, _ := c.Canonicalize("https://golang.org/search?a=1&b=2")
+
+	if a != b {
+		t.Errorf("query variants canonicalize to %q and %q, want the same", a, b)
+	}
+}
+
+func TestCachedUrlVisitCanonical(t *testing.T) {
+	c := NewCachedUrl()
+
+	if c.Visit("https://golang.org/pkg/") {
+		t.Fatal("first Visit() = true, want false")
+	}
+
+	for _, v := range []string{"https://golang.org/pkg", "HTTPS://GOLANG.ORG/pkg/#top"} {
+		if !c.Visit(v) {
+			t.Errorf("Visit(%q) = false, want true", v)
+		}
+	}
+
+	raw := &CachedUrl{visitedUrls: make(map[string]bool)}
+	raw.Visit("https://golang.org/pkg/")
+
+	if raw.Visit("https://golang.org/pkg") {
+		t.Error("Visit() without a Canonicalizer deduped a different raw string")
+	}
+}
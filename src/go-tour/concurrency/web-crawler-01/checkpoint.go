@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Checkpoint is a snapshot of a crawl that can be resumed later.
+type Checkpoint struct {
+	// Visited holds the keys of CachedUrl, which are canonical URLs when
+	// the set has a Canonicalizer.
+	Visited []string `json:"visited"`
+
+	// Frontier holds the URLs that were queued or being fetched.
+	Frontier []FrontierItem `json:"frontier"`
+
+	// Scheduled counts the pages queued so far, so MaxPages keeps
+	// counting from where the crawl stopped.
+	Scheduled int `json:"scheduled"`
+
+	// Fingerprints holds the content hashes of the pages fetched so far, so
+	// pages fetched after resuming are still compared with them.
+	Fingerprints []Fingerprint `json:"fingerprints,omitempty"`
+
+	Saved time.Time `json:"saved"`
+}
+
+// FrontierItem is a URL waiting to be fetched.
+type FrontierItem struct {
+	URL      string `json:"url"`
+	Depth    int    `json:"depth"`
+	Referrer string `json:"referrer,omitempty"`
+}
+
+// CheckpointStore keeps the latest Checkpoint of a crawl in a JSON file.
+type CheckpointStore struct {
+	Path string
+}
+
+// NewCheckpointStore returns a CheckpointStore that writes to path.
+func NewCheckpointStore(path string) *CheckpointStore {
+	return &CheckpointStore{Path: path}
+}
+
+// Save replaces the stored checkpoint with cp. The file is written next to
+// the old one and renamed over it, so a crash mid-write keeps the previous
+// checkpoint intact.
+func (s *CheckpointStore) Save(cp *Checkpoint) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(s.Path, data)
+}
+
+// Load returns the stored checkpoint. It returns an error satisfying
+// errors.Is(err, fs.ErrNotExist) when nothing has been saved yet.
+func (s *CheckpointStore) Load() (*Checkpoint, error) {
+	data, err := os.ReadFile(s.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cp Checkpoint
+
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, err
+	}
+
+	return &cp, nil
+}
+
+// writeFileAtomic writes data next to path and renames it over path, so a
+// crash mid-write keeps the previous file intact.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
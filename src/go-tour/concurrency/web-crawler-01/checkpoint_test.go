@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// crashFetcher runs onFetch before the nth fetch, to simulate the
+// crawl being interrupted at that point.
+type crashFetcher struct {
+	Fetcher
+	n       int
+	onFetch func()
+
+	mu      sync.Mutex
+	fetches int
+}
+
+func (f *crashFetcher) Fetch(url string) (string, []string, error) {
+	f.mu.Lock()
+	f.fetches++
+	crash := f.fetches == f.n
+	f.mu.Unlock()
+
+	if crash {
+		f.onFetch()
+	}
+
+	return f.Fetcher.Fetch(url)
+}
+
+func uninterruptedKeys(t *testing.T) []string {
+	t.Helper()
+
+	c := NewCrawler(&chainFetcher{})
+	c.MaxDepth = 6
+
+	if _, err := c.Crawl(context.Background(), "p"); err != nil {
+		t.Fatalf("Crawl() error = %v", err)
+	}
+
+	return c.Visited.Keys()
+}
+
+func TestResumeAfterCancel(t *testing.T) {
+	want := uninterruptedKeys(t)
+	store := NewCheckpointStore(filepath.Join(t.TempDir(), "crawl.json"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := NewCrawler(&crashFetcher{Fetcher: &chainFetcher{}, n: 10, onFetch: cancel})
+	c.MaxDepth = 6
+	c.Checkpoints = store
+	c.CheckpointEvery = 3
+
+	first, err := c.Crawl(ctx, "p")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Crawl() error = %v, want context.Canceled", err)
+	}
+
+	resumed := NewCrawler(&chainFetcher{})
+	resumed.MaxDepth = 6
+	resumed.Checkpoints = store
+
+	second, err := resumed.Resume(context.Background())
+	if err != nil {
+		t.Fatalf("Resume() error = %v", err)
+	}
+
+	if got := resumed.Visited.Keys(); !slices.Equal(got, want) {
+		t.Errorf("Resume() visited %d URLs, want %d", len(got), len(want))
+	}
+
+	var ok int
+
+	for _, p := range append(first.Pages, second.Pages...) {
+		if p.Status == PageOK {
+			ok++
+		}
+	}
+
+	if ok != len(want) {
+		t.Errorf("fetched %d pages across both runs, want %d", ok, len(want))
+	}
+}
+
+func TestResumeFromPeriodicCheckpoint(t *testing.T) {
+	want := uninterruptedKeys(t)
+
+	dir := t.TempDir()
+	store := NewCheckpointStore(filepath.Join(dir, "crawl.json"))
+	crashed := NewCheckpointStore(filepath.Join(dir, "crashed.json"))
+
+	// Copy the last periodic checkpoint halfway through, as if the
+	// process had died there and never saved again.
+	snapshot := func() {
+		data, err := os.ReadFile(store.Path)
+		if err != nil {
+			t.Errorf("no periodic checkpoint: %v", err)
+			return
+		}
+
+		if err := os.WriteFile(crashed.Path, data, 0o644); err != nil {
+			t.Error(err)
+		}
+	}
+
+	c := NewCrawler(&crashFetcher{Fetcher: &chainFetcher{}, n: 20, onFetch: snapshot})
+	c.MaxDepth = 6
+	c.Workers = 1
+	c.Checkpoints = store
+	c.CheckpointEvery = 5
+
+	if _, err := c.Crawl(context.Background(), "p"); err != nil {
+		t.Fatalf("Crawl() error = %v", err)
+	}
+
+	resumed := NewCrawler(&chainFetcher{})
+	resumed.MaxDepth = 6
+	resumed.Checkpoints = crashed
+
+	result, err := resumed.Resume(context.Background())
+	if err != nil {
+		t.Fatalf("Resume() error = %v", err)
+	}
+
+	if len(result.Pages) == 0 || len(result.Pages) >= len(want) {
+		t.Errorf("Resume() fetched %d pages, want some but fewer than %d", len(result.Pages), len(want))
+	}
+
+	if got := resumed.Visited.Keys(); !slices.Equal(got, want) {
+		t.Errorf("Resume() visited %d URLs, want %d", len(got), len(want))
+	}
+}
+
+func TestResumeKeepsFingerprints(t *testing.T) {
+	f := fakeFetcher{
+		"https://a.example/":     &fakeResult{article, []string{"https://a.example/copy"}},
+		"https://a.example/copy": &fakeResult{article, nil},
+	}
+
+	d := NewDuplicateDetector(3)
+	d.Check("https://a.example/", 0, article)
+
+	store := NewCheckpointStore(filepath.Join(t.TempDir(), "crawl.json"))
+
+	err := store.Save(&Checkpoint{
+		Visited:      []string{"https://a.example/", "https://a.example/copy"},
+		Frontier:     []FrontierItem{{URL: "https://a.example/copy", Depth: 1, Referrer: "https://a.example/"}},
+		Scheduled:    2,
+		Fingerprints: d.Fingerprints(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewCrawler(f)
+	c.Checkpoints = store
+	c.Duplicates = NewDuplicateDetector(3)
+
+	result, err := c.Resume(context.Background())
+	if err != nil {
+		t.Fatalf("Resume() error = %v", err)
+	}
+
+	page, _ := result.Page("https://a.example/copy")
+
+	if page.Status != PageDuplicate || page.DuplicateOf != "https://a.example/" {
+		t.Errorf("Page(copy) = %q of %q, want a duplicate of the page fetched before the checkpoint", page.Status, page.DuplicateOf)
+	}
+
+	cp, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cp.Fingerprints) != 2 {
+		t.Errorf("checkpoint has %d fingerprints, want 2", len(cp.Fingerprints))
+	}
+}
+
+// stallFetcher holds fetches of the stall URL until their context is done
+// and passes every other fetch on to its Fetcher.
+type stallFetcher struct {
+	Fetcher
+	stall   string
+	stalled atomic.Int32
+}
+
+func (f *stallFetcher) FetchResponse(ctx context.Context, url string) (*Response, error) {
+	if url != f.stall {
+		return fetchResponse(ctx, f.Fetcher, url)
+	}
+
+	f.stalled.Add(1)
+	defer f.stalled.Add(-1)
+
+	<-ctx.Done()
+
+	return nil, ctx.Err()
+}
+
+func TestCrawlCheckpointErrorStopsWorkers(t *testing.T) {
+	f := &stallFetcher{Fetcher: &chainFetcher{}, stall: "pa"}
+
+	c := NewCrawler(f)
+	c.MaxDepth = 3
+	c.Workers = 2
+	c.Checkpoints = NewCheckpointStore(filepath.Join(t.TempDir(), "missing", "crawl.json"))
+	c.CheckpointEvery = 2
+
+	if _, err := c.Crawl(context.Background(), "p"); err == nil {
+		t.Fatalf("Crawl() error = nil, want the checkpoint error")
+	}
+
+	if n := f.stalled.Load(); n != 0 {
+		t.Errorf("%d fetches still running after Crawl() returned, want 0", n)
+	}
+}
+
+func TestResumeWithoutCheckpoint(t *testing.T) {
+	c := NewCrawler(fetcher)
+	c.Checkpoints = NewCheckpointStore(filepath.Join(t.TempDir(), "missing.json"))
+
+	if _, err := c.Resume(context.Background()); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Resume() error = %v, want fs.ErrNotExist", err)
+	}
+}
@@ -0,0 +1,532 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/rpc"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ccrsxx/learn-go/src/go-tour/concurrency/web-crawler-01/extract"
+)
+
+// Coordinator runs a crawl whose pages are fetched by RemoteWorkers in
+// other processes. It owns the frontier and the visited set, and hands out
+// pages to workers over net/rpc.
+//
+// A page handed to a worker is leased to it. Workers send heartbeats, which
+// renew their leases. A lease that is not renewed in time, because the
+// worker died or hung up, expires and the page goes back to the frontier
+// for another worker to fetch. So does a page the worker is still busy with
+// after PageTimeout.
+type Coordinator struct {
+	// Crawler holds the crawl limits, the visited set and the checkpoint
+	// store. Its Fetcher is not used, since the workers do the fetching.
+	Crawler *Crawler
+
+	// LeaseTimeout is how long a worker keeps its pages without a heartbeat.
+	LeaseTimeout time.Duration
+
+	// HeartbeatEvery is how often workers are told to send heartbeats.
+	HeartbeatEvery time.Duration
+
+	// PageTimeout is the longest a page stays leased to one worker, however
+	// many heartbeats it sends, so a fetch that hangs is handed to another
+	// worker. Zero means no limit.
+	PageTimeout time.Duration
+
+	// HostDelay is the minimum time between handing out two pages of the
+	// same host, to any workers, so adding workers does not make the crawl
+	// less polite.
+	HostDelay time.Duration
+
+	mu       sync.Mutex
+	result   *CrawlResult
+	frontier *frontier
+	leases   map[string]*lease
+	workers  map[string]time.Time
+	nextHost map[string]time.Time
+	nextID   int
+	done     chan struct{}
+}
+
+type lease struct {
+	worker  string
+	expires time.Time
+
+	// deadline is when the lease ends even if the worker is alive. It is
+	// zero without a PageTimeout.
+	deadline time.Time
+}
+
+// renew extends the lease to at most timeout from now.
+func (l *lease) renew(now time.Time, timeout time.Duration) {
+	l.expires = now.Add(timeout)
+
+	if !l.deadline.IsZero() && l.deadline.Before(l.expires) {
+		l.expires = l.deadline
+	}
+}
+
+// NewCoordinator returns a Coordinator with default limits.
+func NewCoordinator() *Coordinator {
+	return &Coordinator{
+		Crawler:        NewCrawler(nil),
+		LeaseTimeout:   10 * time.Second,
+		HeartbeatEvery: 2 * time.Second,
+		PageTimeout:    time.Minute,
+	}
+}
+
+// Crawl crawls pages starting with seeds, serving workers that connect to l
+// until the frontier is empty or ctx is done. l is closed when Crawl returns.
+// As with Crawler.Crawl, an early end returns the pages finished so far
+// together with ctx.Err().
+func (c *Coordinator) Crawl(ctx context.Context, l net.Listener, seeds []string) (*CrawlResult, error) {
+	if c.LeaseTimeout <= 0 || c.HeartbeatEvery <= 0 {
+		l.Close()
+		return nil, fmt.Errorf("coordinator: lease timeout %v and heartbeat interval %v must be positive", c.LeaseTimeout, c.HeartbeatEvery)
+	}
+
+	c.Crawler.prepare()
+
+	c.result = &CrawlResult{Started: time.Now()}
+	c.leases = make(map[string]*lease)
+	c.workers = make(map[string]time.Time)
+	c.nextHost = make(map[string]time.Time)
+	c.done = make(chan struct{})
+
+	c.frontier = newFrontier(nil, 0)
+
+	if c.Crawler.MaxDepth > 0 {
+		for _, seed := range seeds {
+			c.Crawler.addSeed(c.result, c.frontier, seed)
+		}
+	}
+
+	if c.frontier.empty() {
+		close(c.done)
+	}
+
+	server := rpc.NewServer()
+
+	if err := server.RegisterName("Coordinator", &CoordinatorService{c: c}); err != nil {
+		return nil, err
+	}
+
+	conns := make(map[net.Conn]bool)
+	var connsMu sync.Mutex
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			connsMu.Lock()
+			conns[conn] = true
+			connsMu.Unlock()
+
+			go server.ServeConn(conn)
+		}
+	}()
+
+	defer func() {
+		l.Close()
+
+		connsMu.Lock()
+		defer connsMu.Unlock()
+
+		for conn := range conns {
+			conn.Close()
+		}
+	}()
+
+	ticker := time.NewTicker(c.HeartbeatEvery)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			c.waitForWorkers(ctx)
+
+			c.mu.Lock()
+			defer c.mu.Unlock()
+
+			c.result.Duration = time.Since(c.result.Started)
+
+			if err := c.Crawler.checkpoint(c.frontier); err != nil {
+				return c.result, err
+			}
+
+			return c.result, nil
+
+		case <-ticker.C:
+			c.expire(time.Now())
+
+		case <-ctx.Done():
+			c.mu.Lock()
+			defer c.mu.Unlock()
+
+			// Stop handing out work before saving where we got to.
+			c.finish()
+
+			if err := c.Crawler.checkpoint(c.frontier); err != nil {
+				return c.Crawler.stop(c.result, c.frontier, errors.Join(ctx.Err(), err))
+			}
+
+			return c.Crawler.stop(c.result, c.frontier, ctx.Err())
+		}
+	}
+}
+
+// waitForWorkers gives connected workers a chance to hear that the crawl
+// is over, so they can exit cleanly instead of seeing the connection drop.
+func (c *Coordinator) waitForWorkers(ctx context.Context) {
+	deadline := time.After(c.HeartbeatEvery)
+
+	for {
+		c.mu.Lock()
+		n := len(c.workers)
+		c.mu.Unlock()
+
+		if n == 0 {
+			return
+		}
+
+		select {
+		case <-time.After(10 * time.Millisecond):
+		case <-deadline:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// expire requeues the pages of expired leases and forgets workers that
+// stopped sending heartbeats.
+func (c *Coordinator) expire(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for id, seen := range c.workers {
+		if now.Sub(seen) > c.LeaseTimeout {
+			delete(c.workers, id)
+		}
+	}
+
+	var requeue []crawlTask
+
+	for url, l := range c.leases {
+		if now.Before(l.expires) {
+			continue
+		}
+
+		requeue = append(requeue, c.frontier.inflight[url])
+
+		delete(c.leases, url)
+		delete(c.frontier.inflight, url)
+	}
+
+	// Expired pages have waited longest, so they go to the front.
+	c.frontier.queue = append(requeue, c.frontier.queue...)
+}
+
+// finish marks the crawl as over. The caller holds the lock.
+func (c *Coordinator) finish() {
+	select {
+	case <-c.done:
+	default:
+		close(c.done)
+	}
+}
+
+func (c *Coordinator) isDone() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// seen records a sign of life from worker and renews its leases. The
+// caller holds the lock.
+func (c *Coordinator) seen(worker string, now time.Time) {
+	c.workers[worker] = now
+
+	for _, l := range c.leases {
+		if l.worker == worker {
+			l.renew(now, c.LeaseTimeout)
+		}
+	}
+}
+
+// CoordinatorService is the net/rpc service of a Coordinator.
+type CoordinatorService struct {
+	c *Coordinator
+}
+
+// RegisterArgs introduces a worker to the coordinator.
+type RegisterArgs struct {
+	Name string
+}
+
+// RegisterReply tells a new worker its ID and how often to send heartbeats.
+type RegisterReply struct {
+	WorkerID       string
+	HeartbeatEvery time.Duration
+}
+
+// LeaseArgs asks for up to Max pages to fetch.
+type LeaseArgs struct {
+	WorkerID string
+	Max      int
+}
+
+// LeaseReply holds the pages leased to a worker. It holds none when every
+// page is leased to someone else, and Done is set once the crawl is over.
+type LeaseReply struct {
+	Tasks []FrontierItem
+	Done  bool
+}
+
+// HeartbeatArgs tells the coordinator a worker is still alive.
+type HeartbeatArgs struct {
+	WorkerID string
+}
+
+// HeartbeatReply is empty.
+type HeartbeatReply struct{}
+
+// ReportArgs holds the result of a page fetched by a worker.
+type ReportArgs struct {
+	WorkerID string
+	Page     RemotePage
+}
+
+// ReportReply is empty.
+type ReportReply struct{}
+
+func (s *CoordinatorService) Register(args *RegisterArgs, reply *RegisterReply) error {
+	c := s.c
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.nextID++
+
+	reply.WorkerID = args.Name + "-" + strconv.Itoa(c.nextID)
+	reply.HeartbeatEvery = c.HeartbeatEvery
+
+	c.seen(reply.WorkerID, time.Now())
+
+	return nil
+}
+
+func (s *CoordinatorService) Lease(args *LeaseArgs, reply *LeaseReply) error {
+	c := s.c
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.isDone() {
+		reply.Done = true
+		delete(c.workers, args.WorkerID)
+
+		return nil
+	}
+
+	now := time.Now()
+	c.seen(args.WorkerID, now)
+
+	f := c.frontier
+
+	var notDue []crawlTask
+
+	for len(reply.Tasks) < max(args.Max, 1) && len(f.queue) > 0 {
+		task := f.queue[0]
+		f.queue = f.queue[1:]
+
+		if c.HostDelay > 0 {
+			host := hostOf(task.url)
+
+			if now.Before(c.nextHost[host]) {
+				notDue = append(notDue, task)
+				continue
+			}
+
+			c.nextHost[host] = now.Add(c.HostDelay)
+		}
+
+		l := &lease{worker: args.WorkerID}
+
+		if c.PageTimeout > 0 {
+			l.deadline = now.Add(c.PageTimeout)
+		}
+
+		l.renew(now, c.LeaseTimeout)
+
+		f.inflight[task.url] = task
+		c.leases[task.url] = l
+
+		reply.Tasks = append(reply.Tasks, FrontierItem{URL: task.url, Depth: task.depth, Referrer: task.referrer})
+	}
+
+	// Pages of hosts that are not due yet keep their place in the queue.
+	f.queue = append(notDue, f.queue...)
+
+	return nil
+}
+
+func (s *CoordinatorService) Heartbeat(args *HeartbeatArgs, reply *HeartbeatReply) error {
+	c := s.c
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.isDone() {
+		c.seen(args.WorkerID, time.Now())
+	}
+
+	return nil
+}
+
+// Report records a fetched page. Reports for pages that are no longer
+// pending, because another worker already reported them after a lease
+// expired, are ignored.
+func (s *CoordinatorService) Report(args *ReportArgs, reply *ReportReply) error {
+	c := s.c
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.isDone() {
+		return nil
+	}
+
+	c.seen(args.WorkerID, time.Now())
+
+	f := c.frontier
+
+	task, ok := f.inflight[args.Page.URL]
+	if !ok {
+		return nil
+	}
+
+	delete(f.inflight, task.url)
+	delete(c.leases, task.url)
+
+	page := args.Page.pageResult(task)
+
+	c.result.Pages = append(c.result.Pages, page)
+	c.Crawler.expand(c.result, f, page)
+
+	if every := c.Crawler.CheckpointEvery; every > 0 && len(c.result.Pages)%every == 0 {
+		if err := c.Crawler.checkpoint(f); err != nil {
+			return err
+		}
+	}
+
+	if f.empty() {
+		c.finish()
+	}
+
+	return nil
+}
+
+// RemotePage is a PageResult sent from a worker to the coordinator.
+type RemotePage struct {
+	URL      string
+	Status   PageStatus
+	Title    string
+	Links    []string
+	Content  *extract.Page
+	Started  time.Time
+	Duration time.Duration
+	Err      *RemoteError
+}
+
+func newRemotePage(page PageResult) RemotePage {
+	rp := RemotePage{
+		URL:      page.URL,
+		Status:   page.Status,
+		Title:    page.Title,
+		Links:    page.Links,
+		Content:  page.Content,
+		Started:  page.Started,
+		Duration: page.Duration,
+	}
+
+	if page.Err != nil {
+		rp.Err = newRemoteError(page.Err)
+	}
+
+	return rp
+}
+
+// pageResult turns the page back into a PageResult. The depth and referrer
+// come from the coordinator's own task.
+func (p RemotePage) pageResult(task crawlTask) PageResult {
+	page := PageResult{
+		URL:      task.url,
+		Depth:    task.depth,
+		Referrer: task.referrer,
+		Status:   p.Status,
+		Title:    p.Title,
+		Links:    p.Links,
+		Content:  p.Content,
+		Started:  p.Started,
+		Duration: p.Duration,
+	}
+
+	if p.Err != nil {
+		page.Err = p.Err
+	}
+
+	return page
+}
+
+// RemoteError is a fetch error reported by a worker. It keeps enough of the
+// original error for errors.Is, errors.As and ClassifyError to still work.
+type RemoteError struct {
+	Message    string
+	Class      ErrorClass
+	StatusCode int
+}
+
+func newRemoteError(err error) *RemoteError {
+	e := &RemoteError{Message: err.Error(), Class: ClassifyError(err)}
+
+	var statusErr *StatusError
+
+	if errors.As(err, &statusErr) {
+		e.StatusCode = statusErr.StatusCode
+	}
+
+	return e
+}
+
+func (e *RemoteError) Error() string {
+	return e.Message
+}
+
+func (e *RemoteError) Unwrap() error {
+	switch e.Class {
+	case ErrorNotFound:
+		return ErrNotFound
+	case ErrorTimeout:
+		return context.DeadlineExceeded
+	case ErrorBadStatus:
+		return &StatusError{StatusCode: e.StatusCode}
+	case ErrorDNS:
+		return &net.DNSError{Err: e.Message}
+	default:
+		return nil
+	}
+}
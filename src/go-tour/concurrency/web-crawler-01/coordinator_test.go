@@ -0,0 +1,328 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestCoordinator(t *testing.T) (*Coordinator, net.Listener) {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewCoordinator()
+	c.LeaseTimeout = 300 * time.Millisecond
+	c.HeartbeatEvery = 30 * time.Millisecond
+
+	return c, l
+}
+
+// startWorkers runs n workers fetching with f against the coordinator at
+// addr, and returns a function that waits for them and returns their errors.
+func startWorkers(ctx context.Context, addr string, n int, f Fetcher) func() error {
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+
+	for i := range n {
+		wg.Go(func() {
+			w := NewRemoteWorker(f)
+			w.Crawler.Workers = 2
+			w.PollInterval = 10 * time.Millisecond
+
+			errs[i] = w.Run(ctx, addr)
+		})
+	}
+
+	return func() error {
+		wg.Wait()
+		return errors.Join(errs...)
+	}
+}
+
+func TestCoordinatorCrawl(t *testing.T) {
+	c, l := newTestCoordinator(t)
+	c.Crawler.MaxDepth = 6
+
+	wait := startWorkers(context.Background(), l.Addr().String(), 3, &chainFetcher{delay: time.Millisecond})
+
+	result, err := c.Crawl(context.Background(), l, []string{"p"})
+	if err != nil {
+		t.Fatalf("Crawl() error = %v", err)
+	}
+
+	if err := wait(); err != nil {
+		t.Errorf("workers failed: %v", err)
+	}
+
+	if got, want := c.Crawler.Visited.Keys(), uninterruptedKeys(t); !slices.Equal(got, want) {
+		t.Errorf("visited %d URLs, want the %d of a local crawl", len(got), len(want))
+	}
+
+	if len(result.Pages) != 63 {
+		t.Errorf("Crawl() = %d pages, want 63", len(result.Pages))
+	}
+
+	for _, p := range result.Pages {
+		if p.Status != PageOK || p.Depth != len(p.URL)-1 {
+			t.Errorf("page %s = %s at depth %d", p.URL, p.Status, p.Depth)
+		}
+	}
+}
+
+func TestCoordinatorKeepsErrors(t *testing.T) {
+	c, l := newTestCoordinator(t)
+
+	wait := startWorkers(context.Background(), l.Addr().String(), 2, fetcher)
+
+	result, err := c.Crawl(context.Background(), l, []string{"https://golang.org/"})
+	if err != nil {
+		t.Fatalf("Crawl() error = %v", err)
+	}
+
+	if err := wait(); err != nil {
+		t.Errorf("workers failed: %v", err)
+	}
+
+	local, _ := Crawl(context.Background(), "https://golang.org/", 4, fetcher)
+
+	if got, want := pageURLs(result), pageURLs(local); !slices.Equal(got, want) {
+		t.Errorf("pages = %q, want %q", got, want)
+	}
+
+	page, _ := result.Page("https://golang.org/cmd/")
+
+	if page.Status != PageError || !errors.Is(page.Err, ErrNotFound) || ClassifyError(page.Err) != ErrorNotFound {
+		t.Errorf("/cmd/ = %s, %v, want a not found error", page.Status, page.Err)
+	}
+
+	if page.Referrer != "https://golang.org/" || page.Depth != 1 {
+		t.Errorf("/cmd/ referrer %q at depth %d", page.Referrer, page.Depth)
+	}
+}
+
+// stuckFetcher blocks every fetch until release is closed, and closes
+// started on the first one.
+type stuckFetcher struct {
+	started chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func (f *stuckFetcher) Fetch(url string) (string, []string, error) {
+	f.once.Do(func() { close(f.started) })
+
+	<-f.release
+
+	return "stale", nil, nil
+}
+
+func TestCoordinatorReassignsDeadWorker(t *testing.T) {
+	c, l := newTestCoordinator(t)
+	c.Crawler.MaxDepth = 5
+
+	addr := l.Addr().String()
+
+	// The first worker leases the seeds and then dies mid-fetch: it stops
+	// sending heartbeats and never reports.
+	stuck := &stuckFetcher{started: make(chan struct{}), release: make(chan struct{})}
+
+	deadCtx, kill := context.WithCancel(context.Background())
+	waitDead := startWorkers(deadCtx, addr, 1, stuck)
+
+	defer func() {
+		close(stuck.release)
+		_ = waitDead()
+	}()
+
+	type crawl struct {
+		result *CrawlResult
+		err    error
+	}
+
+	done := make(chan crawl)
+
+	go func() {
+		result, err := c.Crawl(context.Background(), l, []string{"p", "q"})
+		done <- crawl{result, err}
+	}()
+
+	<-stuck.started
+	kill()
+
+	wait := startWorkers(context.Background(), addr, 2, &chainFetcher{})
+
+	var got crawl
+
+	select {
+	case got = <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("crawl did not finish after its worker died")
+	}
+
+	if got.err != nil {
+		t.Fatalf("Crawl() error = %v", got.err)
+	}
+
+	if err := wait(); err != nil {
+		t.Errorf("workers failed: %v", err)
+	}
+
+	// Two seeds, each with a full binary tree of 31 pages.
+	if len(got.result.Pages) != 62 {
+		t.Errorf("Crawl() = %d pages, want 62", len(got.result.Pages))
+	}
+
+	for _, p := range got.result.Pages {
+		if p.Status != PageOK || p.Title == "stale" {
+			t.Errorf("page %s = %s %q, want it fetched by a live worker", p.URL, p.Status, p.Title)
+		}
+	}
+}
+
+func TestCoordinatorReassignsHungPage(t *testing.T) {
+	c, l := newTestCoordinator(t)
+	c.Crawler.MaxDepth = 3
+	c.PageTimeout = 200 * time.Millisecond
+
+	addr := l.Addr().String()
+
+	// The first worker stays alive and keeps sending heartbeats, but its
+	// fetches never finish.
+	stuck := &stuckFetcher{started: make(chan struct{}), release: make(chan struct{})}
+
+	hungCtx, stopHung := context.WithCancel(context.Background())
+	waitHung := startWorkers(hungCtx, addr, 1, stuck)
+
+	defer func() {
+		stopHung()
+		close(stuck.release)
+		_ = waitHung()
+	}()
+
+	done := make(chan error)
+
+	go func() {
+		result, err := c.Crawl(context.Background(), l, []string{"p", "q"})
+
+		for _, p := range result.Pages {
+			if p.Title == "stale" {
+				t.Errorf("page %s came from the hung worker", p.URL)
+			}
+		}
+
+		done <- err
+	}()
+
+	<-stuck.started
+
+	wait := startWorkers(context.Background(), addr, 1, &chainFetcher{})
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Crawl() error = %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("crawl did not finish while a worker hung on its pages")
+	}
+
+	if err := wait(); err != nil {
+		t.Errorf("workers failed: %v", err)
+	}
+}
+
+// timingFetcher records when each fetch starts.
+type timingFetcher struct {
+	Fetcher
+
+	mu     sync.Mutex
+	starts []time.Time
+}
+
+func (f *timingFetcher) Fetch(url string) (string, []string, error) {
+	f.mu.Lock()
+	f.starts = append(f.starts, time.Now())
+	f.mu.Unlock()
+
+	return f.Fetcher.Fetch(url)
+}
+
+func TestCoordinatorHostDelay(t *testing.T) {
+	c, l := newTestCoordinator(t)
+	c.Crawler.MaxDepth = 3
+	c.HostDelay = 50 * time.Millisecond
+
+	f := &timingFetcher{Fetcher: &chainFetcher{}}
+	wait := startWorkers(context.Background(), l.Addr().String(), 3, f)
+
+	result, err := c.Crawl(context.Background(), l, []string{"p"})
+	if err != nil {
+		t.Fatalf("Crawl() error = %v", err)
+	}
+
+	if err := wait(); err != nil {
+		t.Errorf("workers failed: %v", err)
+	}
+
+	if len(result.Pages) != 7 {
+		t.Fatalf("Crawl() = %d pages, want 7", len(result.Pages))
+	}
+
+	slices.SortFunc(f.starts, time.Time.Compare)
+
+	// Fetches start a little after their lease, so allow some slack.
+	for i := 1; i < len(f.starts); i++ {
+		if gap := f.starts[i].Sub(f.starts[i-1]); gap < c.HostDelay/2 {
+			t.Errorf("fetches %d and %d of the host started %v apart, want about %v", i-1, i, gap, c.HostDelay)
+		}
+	}
+}
+
+func TestCoordinatorRejectsBadLease(t *testing.T) {
+	c, l := newTestCoordinator(t)
+	c.HeartbeatEvery = 0
+
+	if _, err := c.Crawl(context.Background(), l, []string{"p"}); err == nil {
+		t.Error("Crawl() error = nil with a zero heartbeat interval")
+	}
+}
+
+func TestCoordinatorCancel(t *testing.T) {
+	c, l := newTestCoordinator(t)
+	c.Crawler.MaxDepth = 100
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	wait := startWorkers(ctx, l.Addr().String(), 2, &chainFetcher{delay: 5 * time.Millisecond})
+
+	result, err := c.Crawl(ctx, l, []string{"p"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Crawl() error = %v, want DeadlineExceeded", err)
+	}
+
+	_ = wait()
+
+	var ok, canceled int
+
+	for _, p := range result.Pages {
+		switch p.Status {
+		case PageOK:
+			ok++
+		case PageCanceled:
+			canceled++
+		}
+	}
+
+	if ok == 0 || canceled == 0 {
+		t.Errorf("Crawl() = %d ok and %d canceled pages, want some of each", ok, canceled)
+	}
+}
@@ -0,0 +1,583 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ccrsxx/learn-go/src/go-tour/concurrency/web-crawler-01/extract"
+)
+
+// PageStatus describes what happened to a single URL during a crawl.
+type PageStatus string
+
+const (
+	PageOK       PageStatus = "ok"
+	PageError    PageStatus = "error"
+	PageCanceled PageStatus = "canceled"
+
+	// PageDisallowed marks a URL that robots.txt does not let us fetch.
+	PageDisallowed PageStatus = "disallowed"
+
+	// PageDuplicate marks a page whose content is a near-duplicate of an
+	// earlier page. Its links are not followed.
+	PageDuplicate PageStatus = "duplicate"
+)
+
+// PageResult is the outcome of crawling a single URL.
+type PageResult struct {
+	URL    string
+	Depth  int
+	Status PageStatus
+	Err    error
+
+	// Referrer is the page the URL was first discovered on. It is empty for seeds.
+	Referrer string
+
+	// Title is the page's <title>, or the first line of a body that has none.
+	Title string
+
+	// Links are the URLs found on the page.
+	Links []string
+
+	// DuplicateOf is the earlier page this one is a near-duplicate of.
+	DuplicateOf string
+
+	// Content is the content extracted from the page when Crawler.Extract is set.
+	Content *extract.Page
+
+	Started  time.Time
+	Duration time.Duration
+}
+
+// CrawlResult collects the pages of a crawl in the order they finished.
+type CrawlResult struct {
+	Pages    []PageResult
+	Started  time.Time
+	Duration time.Duration
+
+	// Truncated reports whether MaxPages stopped new pages from being queued.
+	Truncated bool
+}
+
+// DuplicateClusters groups near-duplicate pages. Each cluster starts with
+// the original page, followed by its duplicates in URL order.
+func (r *CrawlResult) DuplicateClusters() [][]string {
+	dups := make(map[string][]string)
+
+	for _, p := range r.Pages {
+		if p.Status == PageDuplicate {
+			dups[p.DuplicateOf] = append(dups[p.DuplicateOf], p.URL)
+		}
+	}
+
+	clusters := make([][]string, 0, len(dups))
+
+	for original, urls := range dups {
+		slices.Sort(urls)
+		clusters = append(clusters, append([]string{original}, urls...))
+	}
+
+	slices.SortFunc(clusters, func(a, b []string) int {
+		return strings.Compare(a[0], b[0])
+	})
+
+	return clusters
+}
+
+// Page returns the result for url, if it was crawled.
+func (r *CrawlResult) Page(url string) (PageResult, bool) {
+	for _, p := range r.Pages {
+		if p.URL == url {
+			return p, true
+		}
+	}
+
+	return PageResult{}, false
+}
+
+// Crawler crawls pages with a fixed number of workers.
+type Crawler struct {
+	Fetcher Fetcher
+
+	// Workers is the number of pages fetched at the same time.
+	Workers int
+
+	// MaxDepth limits how far from the seed the crawl goes. The seed is at
+	// depth 0, so a MaxDepth of 4 fetches pages up to three links away.
+	MaxDepth int
+
+	// MaxPages caps the number of pages fetched. Zero means no limit.
+	MaxPages int
+
+	// Visited dedupes URLs across the whole crawl.
+	Visited *CachedUrl
+
+	// Robots, when set, skips URLs disallowed by robots.txt and applies
+	// each host's Crawl-delay through Limiter.
+	Robots *RobotsPolicy
+
+	// Limiter, when set, spaces out requests to the same host.
+	Limiter *HostLimiter
+
+	// Duplicates, when set, marks pages with near-duplicate content and
+	// stops the crawl from expanding them.
+	Duplicates *DuplicateDetector
+
+	// Checkpoints, when set, stores the visited set and frontier so an
+	// interrupted crawl can be resumed. A checkpoint is saved every
+	// CheckpointEvery pages, when the crawl is canceled and when it ends.
+	Checkpoints     *CheckpointStore
+	CheckpointEvery int
+
+	// CheckLinks, when set, also fetches the links of pages at the last
+	// depth, so they are checked without being expanded.
+	CheckLinks bool
+
+	// Extract, when set, extracts the title, description, headings and
+	// main text of every page fetched into PageResult.Content.
+	Extract bool
+
+	// OnPage, when set, is called with the body of every page fetched
+	// successfully that is not a duplicate, as soon as it is fetched. It is
+	// called from the workers, so it must be safe for concurrent use.
+	OnPage func(page PageResult, body string)
+}
+
+// NewCrawler returns a Crawler that uses fetcher with default limits.
+func NewCrawler(fetcher Fetcher) *Crawler {
+	return &Crawler{
+		Fetcher:  fetcher,
+		Workers:  4,
+		MaxDepth: 4,
+		Visited:  NewCachedUrl(),
+	}
+}
+
+// crawlTask is a URL waiting in the frontier.
+type crawlTask struct {
+	url      string
+	depth    int
+	referrer string
+}
+
+// Crawl uses fetcher to crawl pages starting with url, to a maximum of depth.
+func Crawl(ctx context.Context, url string, depth int, fetcher Fetcher) (*CrawlResult, error) {
+	c := NewCrawler(fetcher)
+	c.MaxDepth = depth
+
+	return c.Crawl(ctx, url)
+}
+
+// Crawl crawls pages starting with seed until the frontier is empty, MaxPages
+// is reached or ctx is done. When ctx ends the crawl early, the pages finished
+// so far are returned together with ctx.Err().
+func (c *Crawler) Crawl(ctx context.Context, seed string) (*CrawlResult, error) {
+	return c.CrawlSeeds(ctx, []string{seed})
+}
+
+// CrawlSeeds is like Crawl but starts from several seeds, all at depth 0.
+func (c *Crawler) CrawlSeeds(ctx context.Context, seeds []string) (*CrawlResult, error) {
+	c.prepare()
+
+	result := &CrawlResult{Started: time.Now()}
+
+	if c.MaxDepth <= 0 {
+		return result, nil
+	}
+
+	f := newFrontier(nil, 0)
+
+	for _, seed := range seeds {
+		c.addSeed(result, f, seed)
+	}
+
+	return c.run(ctx, result, f, nil)
+}
+
+// CrawlFrom is like CrawlSeeds but receives the seeds from a channel, so
+// they are crawled while they are still being loaded. The crawl ends once
+// seeds is closed and every page has a result. Seeds are received until the
+// channel is closed, even past MaxPages, unless ctx is done.
+func (c *Crawler) CrawlFrom(ctx context.Context, seeds <-chan string) (*CrawlResult, error) {
+	c.prepare()
+
+	result := &CrawlResult{Started: time.Now()}
+
+	if c.MaxDepth <= 0 {
+		for range seeds {
+		}
+
+		return result, nil
+	}
+
+	return c.run(ctx, result, newFrontier(nil, 0), seeds)
+}
+
+// addSeed queues seed at depth 0 unless it was visited or MaxPages is reached.
+func (c *Crawler) addSeed(result *CrawlResult, f *frontier, seed string) {
+	if c.MaxPages > 0 && f.scheduled >= c.MaxPages {
+		result.Truncated = true
+		return
+	}
+
+	if !c.Visited.Visit(seed) {
+		f.scheduled++
+		f.queue = append(f.queue, crawlTask{url: seed})
+	}
+}
+
+// Resume continues the crawl saved in Checkpoints. Pages that were being
+// fetched when the checkpoint was taken are fetched again.
+func (c *Crawler) Resume(ctx context.Context) (*CrawlResult, error) {
+	if c.Checkpoints == nil {
+		return nil, errors.New("resume: crawler has no checkpoint store")
+	}
+
+	cp, err := c.Checkpoints.Load()
+	if err != nil {
+		return nil, fmt.Errorf("resume: %w", err)
+	}
+
+	c.prepare()
+	c.Visited.Restore(cp.Visited)
+
+	if c.Duplicates != nil {
+		c.Duplicates.Restore(cp.Fingerprints)
+	}
+
+	queue := make([]crawlTask, 0, len(cp.Frontier))
+
+	for _, item := range cp.Frontier {
+		queue = append(queue, crawlTask{url: item.URL, depth: item.Depth, referrer: item.Referrer})
+	}
+
+	return c.run(ctx, &CrawlResult{Started: time.Now()}, newFrontier(queue, cp.Scheduled), nil)
+}
+
+func (c *Crawler) prepare() {
+	if c.Visited == nil {
+		c.Visited = NewCachedUrl()
+	}
+
+	if c.Robots != nil && c.Limiter == nil {
+		c.Limiter = NewHostLimiter(0)
+	}
+}
+
+// frontier holds the URLs of a running crawl that still need a result.
+type frontier struct {
+	queue    []crawlTask
+	inflight map[string]crawlTask
+
+	// scheduled counts every page ever queued, for MaxPages.
+	scheduled int
+}
+
+func newFrontier(queue []crawlTask, scheduled int) *frontier {
+	return &frontier{
+		queue:     queue,
+		inflight:  make(map[string]crawlTask),
+		scheduled: scheduled,
+	}
+}
+
+func (f *frontier) empty() bool {
+	return len(f.queue) == 0 && len(f.inflight) == 0
+}
+
+// pending returns the tasks being fetched, sorted by URL, followed by the queue.
+func (f *frontier) pending() []crawlTask {
+	tasks := make([]crawlTask, 0, len(f.inflight)+len(f.queue))
+
+	for _, task := range f.inflight {
+		tasks = append(tasks, task)
+	}
+
+	slices.SortFunc(tasks, func(a, b crawlTask) int {
+		return strings.Compare(a.url, b.url)
+	})
+
+	return append(tasks, f.queue...)
+}
+
+// run crawls until the frontier is empty and seeds, when not nil, is closed.
+func (c *Crawler) run(ctx context.Context, result *CrawlResult, f *frontier, seeds <-chan string) (*CrawlResult, error) {
+	workers := max(c.Workers, 1)
+
+	jobs := make(chan crawlTask)
+	results := make(chan PageResult)
+
+	// The workers get their own context, so an early return can abort their
+	// fetches even while ctx is still live. Waiting for them means none is
+	// left blocked on a result nobody reads.
+	workCtx, cancel := context.WithCancel(ctx)
+
+	var wg sync.WaitGroup
+
+	defer func() {
+		cancel()
+		close(jobs)
+		wg.Wait()
+	}()
+
+	for range workers {
+		wg.Go(func() {
+			c.work(workCtx, jobs, results)
+		})
+	}
+
+	for !f.empty() || seeds != nil {
+		// A nil channel blocks forever, so nothing is sent while the queue is empty.
+		var send chan<- crawlTask
+		var next crawlTask
+
+		if len(f.queue) > 0 {
+			send = jobs
+			next = f.queue[0]
+		}
+
+		select {
+		case send <- next:
+			f.queue = f.queue[1:]
+			f.inflight[next.url] = next
+
+		case seed, ok := <-seeds:
+			if !ok {
+				seeds = nil
+				continue
+			}
+
+			c.addSeed(result, f, seed)
+
+		case page := <-results:
+			delete(f.inflight, page.URL)
+			result.Pages = append(result.Pages, page)
+
+			c.expand(result, f, page)
+
+			if c.CheckpointEvery > 0 && len(result.Pages)%c.CheckpointEvery == 0 {
+				if err := c.checkpoint(f); err != nil {
+					return c.stop(result, f, err)
+				}
+			}
+
+		case <-ctx.Done():
+			// Save where we got to, so the crawl can be resumed.
+			if err := c.checkpoint(f); err != nil {
+				return c.stop(result, f, errors.Join(ctx.Err(), err))
+			}
+
+			return c.stop(result, f, ctx.Err())
+		}
+	}
+
+	c.settleDuplicates(result)
+	result.Duration = time.Since(result.Started)
+
+	if err := c.checkpoint(f); err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// settleDuplicates points every near-duplicate page at its original among
+// all the pages fetched, since pages fetched in parallel are checked in no
+// particular order.
+func (c *Crawler) settleDuplicates(result *CrawlResult) {
+	if c.Duplicates == nil {
+		return
+	}
+
+	for i := range result.Pages {
+		p := &result.Pages[i]
+
+		if p.Status != PageOK && p.Status != PageDuplicate {
+			continue
+		}
+
+		if original, ok := c.Duplicates.Original(p.URL); ok {
+			p.Status = PageDuplicate
+			p.DuplicateOf = original
+		} else {
+			p.Status = PageOK
+			p.DuplicateOf = ""
+		}
+	}
+}
+
+// expand queues the links of page that have not been visited yet.
+func (c *Crawler) expand(result *CrawlResult, f *frontier, page PageResult) {
+	limit := c.MaxDepth
+
+	if c.CheckLinks {
+		limit++
+	}
+
+	if page.Status != PageOK || page.Depth+1 >= limit {
+		return
+	}
+
+	for _, link := range page.Links {
+		if c.MaxPages > 0 && f.scheduled >= c.MaxPages {
+			result.Truncated = true
+			return
+		}
+
+		if c.Visited.Visit(link) {
+			continue
+		}
+
+		f.scheduled++
+		f.queue = append(f.queue, crawlTask{url: link, depth: page.Depth + 1, referrer: page.URL})
+	}
+}
+
+// stop ends the crawl early, marking everything left in the frontier as canceled.
+func (c *Crawler) stop(result *CrawlResult, f *frontier, err error) (*CrawlResult, error) {
+	for _, task := range f.pending() {
+		result.Pages = append(result.Pages, canceledPage(task))
+	}
+
+	c.settleDuplicates(result)
+	result.Duration = time.Since(result.Started)
+
+	return result, err
+}
+
+// checkpoint saves the visited set and frontier to Checkpoints, if set.
+func (c *Crawler) checkpoint(f *frontier) error {
+	if c.Checkpoints == nil {
+		return nil
+	}
+
+	cp := &Checkpoint{
+		Visited:   c.Visited.Keys(),
+		Scheduled: f.scheduled,
+		Saved:     time.Now(),
+	}
+
+	if c.Duplicates != nil {
+		cp.Fingerprints = c.Duplicates.Fingerprints()
+	}
+
+	for _, task := range f.pending() {
+		cp.Frontier = append(cp.Frontier, FrontierItem{URL: task.url, Depth: task.depth, Referrer: task.referrer})
+	}
+
+	if err := c.Checkpoints.Save(cp); err != nil {
+		return fmt.Errorf("checkpoint: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Crawler) work(ctx context.Context, jobs <-chan crawlTask, results chan<- PageResult) {
+	for task := range jobs {
+		page := c.fetch(ctx, task)
+
+		select {
+		case results <- page:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (c *Crawler) fetch(ctx context.Context, task crawlTask) PageResult {
+	if ctx.Err() != nil {
+		return canceledPage(task)
+	}
+
+	page := PageResult{
+		URL:      task.url,
+		Depth:    task.depth,
+		Referrer: task.referrer,
+	}
+
+	if c.Robots != nil && !c.Robots.Allowed(ctx, task.url) {
+		if ctx.Err() != nil {
+			return canceledPage(task)
+		}
+
+		page.Status = PageDisallowed
+		return page
+	}
+
+	if c.Limiter != nil {
+		var delay time.Duration
+
+		if c.Robots != nil {
+			delay = c.Robots.CrawlDelay(ctx, task.url)
+		}
+
+		if err := c.Limiter.Wait(ctx, hostOf(task.url), delay); err != nil {
+			return canceledPage(task)
+		}
+	}
+
+	page.Started = time.Now()
+
+	resp, err := fetchResponse(ctx, c.Fetcher, task.url)
+
+	page.Duration = time.Since(page.Started)
+
+	if err != nil {
+		page.Status = PageError
+		page.Err = err
+
+		return page
+	}
+
+	body := resp.Body
+
+	page.Status = PageOK
+	page.Title = pageTitle(body)
+	page.Links = resp.Links
+
+	if c.Extract {
+		base, _ := url.Parse(task.url)
+
+		// A page we cannot extract from is still a page, just without content.
+		if content, err := extract.Extract([]byte(body), resp.Header.Get("Content-Type"), base); err == nil {
+			page.Content = content
+		}
+	}
+
+	if c.Duplicates != nil {
+		if original, ok := c.Duplicates.Check(task.url, task.depth, body); ok {
+			page.Status = PageDuplicate
+			page.DuplicateOf = original
+		}
+	}
+
+	if c.OnPage != nil && page.Status == PageOK {
+		c.OnPage(page, body)
+	}
+
+	return page
+}
+
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+
+	return u.Host
+}
+
+func canceledPage(task crawlTask) PageResult {
+	return PageResult{
+		URL:      task.url,
+		Depth:    task.depth,
+		Referrer: task.referrer,
+		Status:   PageCanceled,
+	}
+}
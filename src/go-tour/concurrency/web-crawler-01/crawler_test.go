@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func pageURLs(r *CrawlResult) []string {
+	var urls []string
+
+	for _, p := range r.Pages {
+		urls = append(urls, p.URL)
+	}
+
+	slices.Sort(urls)
+
+	return urls
+}
+
+func TestCrawlFakeFetcher(t *testing.T) {
+	result, err := Crawl(context.Background(), "https://golang.org/", 4, fetcher)
+	if err != nil {
+		t.Fatalf("Crawl() error = %v", err)
+	}
+
+	want := []string{
+		"https://golang.org/",
+		"https://golang.org/cmd/",
+		"https://golang.org/pkg/",
+		"https://golang.org/pkg/fmt/",
+		"https://golang.org/pkg/os/",
+	}
+
+	if got := pageURLs(result); !slices.Equal(got, want) {
+		t.Fatalf("Crawl() pages = %q, want %q", got, want)
+	}
+
+	tests := []struct {
+		url      string
+		depth    int
+		status   PageStatus
+		referrer string
+	}{
+		{"https://golang.org/", 0, PageOK, ""},
+		{"https://golang.org/pkg/", 1, PageOK, "https://golang.org/"},
+		{"https://golang.org/cmd/", 1, PageError, "https://golang.org/"},
+		{"https://golang.org/pkg/fmt/", 2, PageOK, "https://golang.org/pkg/"},
+	}
+
+	for _, tt := range tests {
+		page, _ := result.Page(tt.url)
+
+		if page.Depth != tt.depth || page.Status != tt.status || page.Referrer != tt.referrer {
+			t.Errorf("Page(%q) = depth %d, %s, referrer %q, want depth %d, %s, referrer %q",
+				tt.url, page.Depth, page.Status, page.Referrer, tt.depth, tt.status, tt.referrer)
+		}
+	}
+
+	if page, _ := result.Page("https://golang.org/cmd/"); !errors.Is(page.Err, ErrNotFound) {
+		t.Errorf("Page(cmd).Err = %v, want ErrNotFound", page.Err)
+	}
+}
+
+func TestCrawlMaxDepth(t *testing.T) {
+	result, err := Crawl(context.Background(), "https://golang.org/", 2, fetcher)
+	if err != nil {
+		t.Fatalf("Crawl() error = %v", err)
+	}
+
+	want := []string{
+		"https://golang.org/",
+		"https://golang.org/cmd/",
+		"https://golang.org/pkg/",
+	}
+
+	if got := pageURLs(result); !slices.Equal(got, want) {
+		t.Errorf("Crawl() pages = %q, want %q", got, want)
+	}
+}
+
+func TestCrawlMaxPages(t *testing.T) {
+	c := NewCrawler(fetcher)
+	c.MaxPages = 2
+
+	result, err := c.Crawl(context.Background(), "https://golang.org/")
+	if err != nil {
+		t.Fatalf("Crawl() error = %v", err)
+	}
+
+	if len(result.Pages) != 2 || !result.Truncated {
+		t.Errorf("Crawl() = %d pages, truncated %v, want 2 pages, truncated", len(result.Pages), result.Truncated)
+	}
+}
+
+// chainFetcher serves an endless chain of pages, each linking to
+// the next two, and records how many fetches run at once.
+type chainFetcher struct {
+	delay   time.Duration
+	running atomic.Int32
+	peak    atomic.Int32
+}
+
+func (f *chainFetcher) Fetch(url string) (string, []string, error) {
+	n := f.running.Add(1)
+	defer f.running.Add(-1)
+
+	for {
+		peak := f.peak.Load()
+		if n <= peak || f.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+
+	time.Sleep(f.delay)
+
+	return url, []string{url + "a", url + "b"}, nil
+}
+
+func TestCrawlWorkerBound(t *testing.T) {
+	f := &chainFetcher{delay: 5 * time.Millisecond}
+
+	c := NewCrawler(f)
+	c.Workers = 3
+	c.MaxDepth = 5
+
+	result, err := c.Crawl(context.Background(), "p")
+	if err != nil {
+		t.Fatalf("Crawl() error = %v", err)
+	}
+
+	if len(result.Pages) != 31 {
+		t.Errorf("Crawl() = %d pages, want 31", len(result.Pages))
+	}
+
+	if peak := f.peak.Load(); peak > 3 {
+		t.Errorf("peak concurrent fetches = %d, want at most 3", peak)
+	}
+}
+
+func TestCrawlCancel(t *testing.T) {
+	f := &chainFetcher{delay: 10 * time.Millisecond}
+
+	c := NewCrawler(f)
+	c.MaxDepth = 100
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	result, err := c.Crawl(ctx, "p")
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Crawl() error = %v, want DeadlineExceeded", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Crawl() took %v after the deadline", elapsed)
+	}
+
+	var ok, canceled int
+
+	for _, p := range result.Pages {
+		switch p.Status {
+		case PageOK:
+			ok++
+		case PageCanceled:
+			canceled++
+		}
+	}
+
+	if ok == 0 || canceled == 0 {
+		t.Errorf("Crawl() = %d ok, %d canceled pages, want some of both", ok, canceled)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+
+	"github.com/ccrsxx/learn-go/src/go-tour/concurrency/web-crawler-01/extract"
+)
+
+// jsonPage is a PageResult as written to a JSON Lines file.
+type jsonPage struct {
+	URL         string        `json:"url"`
+	Depth       int           `json:"depth"`
+	Status      PageStatus    `json:"status"`
+	Referrer    string        `json:"referrer,omitempty"`
+	Title       string        `json:"title,omitempty"`
+	Error       string        `json:"error,omitempty"`
+	ErrorClass  ErrorClass    `json:"error_class,omitempty"`
+	DuplicateOf string        `json:"duplicate_of,omitempty"`
+	Links       int           `json:"links"`
+	Started     time.Time     `json:"started,omitzero"`
+	DurationMS  int64         `json:"duration_ms"`
+	Content     *extract.Page `json:"content,omitempty"`
+}
+
+// WriteJSONLines writes one JSON object per page, in the order the pages
+// finished, with the extracted content of the pages that have it.
+func (r *CrawlResult) WriteJSONLines(w io.Writer) error {
+	enc := json.NewEncoder(w)
+
+	for _, p := range r.Pages {
+		jp := jsonPage{
+			URL:         p.URL,
+			Depth:       p.Depth,
+			Status:      p.Status,
+			Referrer:    p.Referrer,
+			Title:       p.Title,
+			DuplicateOf: p.DuplicateOf,
+			Links:       len(p.Links),
+			Started:     p.Started,
+			DurationMS:  p.Duration.Milliseconds(),
+			Content:     p.Content,
+		}
+
+		if p.Err != nil {
+			jp.Error = p.Err.Error()
+			jp.ErrorClass = ClassifyError(p.Err)
+		}
+
+		if err := enc.Encode(jp); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeJSONLinesFile writes the pages of result to path as JSON Lines.
+func writeJSONLinesFile(result *CrawlResult, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := result.WriteJSONLines(f); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCrawlerExtract(t *testing.T) {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=iso-8859-1")
+		fmt.Fprint(w, "<html lang=\"fr\"><title>Caf\xe9</title><nav>Menu</nav><h1>Carte</h1><p>Cr\xeapes</p><a href=\"/missing\">x</a>")
+	})
+
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	c := NewCrawler(NewHTTPFetcher())
+	c.Extract = true
+
+	result, err := c.CrawlSeeds(context.Background(), []string{ts.URL + "/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	home, _ := result.Page(ts.URL + "/")
+
+	if home.Content == nil {
+		t.Fatal("home page has no content")
+	}
+
+	if home.Content.Title != "Café" || home.Content.Lang != "fr" || home.Content.Text != "Carte\nCrêpes\nx" {
+		t.Errorf("Content = %+v, want the decoded French page", home.Content)
+	}
+
+	if missing, _ := result.Page(ts.URL + "/missing"); missing.Content != nil {
+		t.Errorf("content of a failed page = %+v, want none", missing.Content)
+	}
+
+	var b bytes.Buffer
+
+	if err := result.WriteJSONLines(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	pages := make(map[string]map[string]any)
+	scanner := bufio.NewScanner(&b)
+
+	for scanner.Scan() {
+		var page map[string]any
+
+		if err := json.Unmarshal(scanner.Bytes(), &page); err != nil {
+			t.Fatalf("line %q: %v", scanner.Text(), err)
+		}
+
+		pages[page["url"].(string)] = page
+	}
+
+	if len(pages) != len(result.Pages) {
+		t.Errorf("WriteJSONLines() wrote %d pages, want %d", len(pages), len(result.Pages))
+	}
+
+	content, _ := pages[ts.URL+"/"]["content"].(map[string]any)
+
+	if content["title"] != "Café" || content["charset"] != "windows-1252" {
+		t.Errorf("content = %v, want the extracted page", content)
+	}
+
+	if missing := pages[ts.URL+"/missing"]; missing["status"] != "error" || missing["error_class"] != "not_found" {
+		t.Errorf("missing page = %v, want a not found error", missing)
+	}
+}
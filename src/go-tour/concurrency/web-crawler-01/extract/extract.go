@@ -0,0 +1,289 @@
+// Package extract pulls the readable content out of HTML pages: the title,
+// meta description, canonical link, language, headings and main text.
+package extract
+
+import (
+	"bytes"
+	"net/url"
+	"slices"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html/charset"
+)
+
+// Page is the content extracted from an HTML page.
+type Page struct {
+	Title       string    `json:"title,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Canonical   string    `json:"canonical,omitempty"`
+	Lang        string    `json:"lang,omitempty"`
+	Headings    []Heading `json:"headings,omitempty"`
+
+	// Text is the main text of the page, without navigation, site headers
+	// and footers, forms and scripts. Blocks such as paragraphs are on
+	// their own lines.
+	Text string `json:"text,omitempty"`
+
+	// Charset is the name of the encoding the page was decoded from.
+	Charset string `json:"charset"`
+}
+
+// Heading is an <h1> to <h6> of a page.
+type Heading struct {
+	Level int    `json:"level"`
+	Text  string `json:"text"`
+}
+
+// Extract parses the HTML page body. The charset is taken from contentType,
+// a byte order mark or a <meta> tag, in that order, falling back to
+// windows-1252 as browsers do. base resolves a relative canonical link and
+// may be nil.
+func Extract(body []byte, contentType string, base *url.URL) (*Page, error) {
+	_, name, _ := charset.DetermineEncoding(body, contentType)
+
+	r, err := charset.NewReaderLabel(name, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := html.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Page{Charset: name}
+
+	var mainNode, article, bodyNode *html.Node
+
+	for n := range doc.Descendants() {
+		if n.Type != html.ElementNode {
+			continue
+		}
+
+		switch n.DataAtom {
+		case atom.Html:
+			p.Lang = strings.TrimSpace(attr(n, "lang"))
+
+		case atom.Title:
+			if p.Title == "" {
+				p.Title = collapse(textOf(n))
+			}
+
+		case atom.Meta:
+			p.readMeta(n)
+
+		case atom.Link:
+			if p.Canonical == "" && hasToken(attr(n, "rel"), "canonical") {
+				p.Canonical = resolve(base, attr(n, "href"))
+			}
+
+		case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+			if text := collapse(textOf(n)); text != "" {
+				p.Headings = append(p.Headings, Heading{Level: int(n.Data[1] - '0'), Text: text})
+			}
+
+		case atom.Main:
+			mainNode = firstNode(mainNode, n)
+
+		case atom.Article:
+			article = firstNode(article, n)
+
+		case atom.Body:
+			bodyNode = firstNode(bodyNode, n)
+		}
+	}
+
+	p.Text = mainText(firstNode(mainNode, article, bodyNode, doc))
+
+	return p, nil
+}
+
+// firstNode returns the first of nodes that is not nil.
+func firstNode(nodes ...*html.Node) *html.Node {
+	for _, n := range nodes {
+		if n != nil {
+			return n
+		}
+	}
+
+	return nil
+}
+
+func (p *Page) readMeta(n *html.Node) {
+	content := strings.TrimSpace(attr(n, "content"))
+
+	switch {
+	case strings.EqualFold(attr(n, "name"), "description"):
+		p.Description = content
+	case strings.EqualFold(attr(n, "property"), "og:description") && p.Description == "":
+		p.Description = content
+	case strings.EqualFold(attr(n, "http-equiv"), "content-language") && p.Lang == "":
+		p.Lang = content
+	}
+}
+
+// mainText returns the readable text under root, one block per line.
+func mainText(root *html.Node) string {
+	var lines []string
+	var line strings.Builder
+
+	flush := func() {
+		if text := collapse(line.String()); text != "" {
+			lines = append(lines, text)
+		}
+
+		line.Reset()
+	}
+
+	// Inside a <main> or <article>, a <header> or <footer> belongs to the
+	// content rather than to the site around it.
+	siteChrome := root.Type == html.DocumentNode || root.DataAtom == atom.Body
+
+	var walk func(n *html.Node)
+
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			line.WriteString(n.Data)
+			return
+
+		case html.ElementNode:
+			// root was picked as the content, whatever its class says.
+			if n != root && isBoilerplate(n, siteChrome) {
+				return
+			}
+
+		case html.DocumentNode:
+
+		default:
+			return
+		}
+
+		block := isBlock(n.DataAtom)
+
+		if block {
+			flush()
+		}
+
+		for c := range n.ChildNodes() {
+			walk(c)
+		}
+
+		if block {
+			flush()
+		}
+	}
+
+	walk(root)
+	flush()
+
+	return strings.Join(lines, "\n")
+}
+
+// boilerplateWords mark class names and IDs of page chrome. They are matched
+// against whole words, split on white space, "-" and "_", so "site-nav" is
+// chrome but "unavailable" is not.
+var boilerplateWords = []string{"nav", "menu", "sidebar", "footer", "cookie", "breadcrumb", "banner"}
+
+func isBoilerplate(n *html.Node, siteChrome bool) bool {
+	switch n.DataAtom {
+	case atom.Head, atom.Script, atom.Style, atom.Noscript, atom.Template,
+		atom.Nav, atom.Aside, atom.Form, atom.Iframe, atom.Svg, atom.Button, atom.Select:
+		return true
+	case atom.Header, atom.Footer:
+		if siteChrome {
+			return true
+		}
+	}
+
+	if _, hidden := lookupAttr(n, "hidden"); hidden || attr(n, "aria-hidden") == "true" {
+		return true
+	}
+
+	switch attr(n, "role") {
+	case "navigation", "banner", "contentinfo", "complementary", "search":
+		return true
+	}
+
+	words := strings.FieldsFunc(strings.ToLower(attr(n, "class")+" "+attr(n, "id")), func(r rune) bool {
+		return r == '-' || r == '_' || unicode.IsSpace(r)
+	})
+
+	for _, word := range words {
+		if slices.Contains(boilerplateWords, word) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isBlock(a atom.Atom) bool {
+	switch a {
+	case atom.Address, atom.Article, atom.Blockquote, atom.Body, atom.Br, atom.Dd, atom.Details,
+		atom.Div, atom.Dl, atom.Dt, atom.Figcaption, atom.Figure, atom.H1, atom.H2, atom.H3,
+		atom.H4, atom.H5, atom.H6, atom.Hr, atom.Li, atom.Main, atom.Ol, atom.P, atom.Pre,
+		atom.Section, atom.Summary, atom.Table, atom.Td, atom.Th, atom.Tr, atom.Ul:
+		return true
+	default:
+		return false
+	}
+}
+
+// textOf returns all the text under n.
+func textOf(n *html.Node) string {
+	var b strings.Builder
+
+	for d := range n.Descendants() {
+		if d.Type == html.TextNode {
+			b.WriteString(d.Data)
+		}
+	}
+
+	return b.String()
+}
+
+// collapse trims s and squeezes every run of white space into one space.
+func collapse(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func attr(n *html.Node, key string) string {
+	v, _ := lookupAttr(n, key)
+	return v
+}
+
+func lookupAttr(n *html.Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Namespace == "" && a.Key == key {
+			return a.Val, true
+		}
+	}
+
+	return "", false
+}
+
+// hasToken reports whether the space separated list s holds token.
+func hasToken(s string, token string) bool {
+	for _, t := range strings.Fields(s) {
+		if strings.EqualFold(t, token) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func resolve(base *url.URL, href string) string {
+	href = strings.TrimSpace(href)
+
+	ref, err := url.Parse(href)
+	if err != nil || base == nil {
+		return href
+	}
+
+	return base.ResolveReference(ref).String()
+}
@@ -0,0 +1,261 @@
+package extract
+
+import (
+	"net/url"
+	"slices"
+	"testing"
+)
+
+const article = `<!DOCTYPE html>
+<html lang="en-GB">
+<head>
+	<meta charset="utf-8">
+	<title>  The Go
+		Blog  </title>
+	<meta name="description" content=" Notes on Go. ">
+	<meta property="og:description" content="Ignored, there is a description">
+	<link rel="alternate canonical" href="/blog/go">
+	<style>body { color: red }</style>
+	<script>var tracking = true;</script>
+</head>
+<body>
+	<header><a href="/">Home</a> <a href="/blog/">Blog</a></header>
+	<nav><ul><li>Docs</li><li>Packages</li></ul></nav>
+	<div class="cookie-banner">We use cookies.</div>
+	<main>
+		<header><h1>Go <em>is</em> fun</h1></header>
+		<p>Go is an open source
+			programming language.</p>
+		<h2>Why Go</h2>
+		<p>It is <b>fast</b>.<br>It is simple.</p>
+		<aside>Related posts</aside>
+		<form><button>Subscribe</button></form>
+		<p hidden>Secret</p>
+		<ul><li>One</li><li>Two</li></ul>
+		<h3></h3>
+	</main>
+	<footer>Copyright</footer>
+</body>
+</html>`
+
+func TestExtract(t *testing.T) {
+	base, _ := url.Parse("https://example.com/blog/go?page=1")
+
+	p, err := Extract([]byte(article), "text/html", base)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.Title != "The Go Blog" {
+		t.Errorf("Title = %q, want %q", p.Title, "The Go Blog")
+	}
+
+	if p.Description != "Notes on Go." {
+		t.Errorf("Description = %q, want %q", p.Description, "Notes on Go.")
+	}
+
+	if p.Canonical != "https://example.com/blog/go" {
+		t.Errorf("Canonical = %q, want the absolute URL", p.Canonical)
+	}
+
+	if p.Lang != "en-GB" {
+		t.Errorf("Lang = %q, want en-GB", p.Lang)
+	}
+
+	if p.Charset != "utf-8" {
+		t.Errorf("Charset = %q, want utf-8", p.Charset)
+	}
+
+	headings := []Heading{{1, "Go is fun"}, {2, "Why Go"}}
+
+	if !slices.Equal(p.Headings, headings) {
+		t.Errorf("Headings = %v, want %v", p.Headings, headings)
+	}
+
+	text := "Go is fun\nGo is an open source programming language.\nWhy Go\nIt is fast.\nIt is simple.\nOne\nTwo"
+
+	if p.Text != text {
+		t.Errorf("Text = %q, want %q", p.Text, text)
+	}
+}
+
+func TestExtractMainText(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want string
+	}{
+		{
+			name: "article",
+			html: `<div>Menu</div><article><p>Story</p><footer>By Gopher</footer></article>`,
+			want: "Story\nBy Gopher",
+		},
+		{
+			name: "main before article",
+			html: `<article>Teaser</article><main><p>Body</p></main>`,
+			want: "Body",
+		},
+		{
+			name: "body",
+			html: `<header>Site</header><p>One</p><div id="sidebar">Links</div><p>Two</p><footer>Legal</footer>`,
+			want: "One\nTwo",
+		},
+		{
+			name: "roles",
+			html: `<div role="navigation">Nav</div><div aria-hidden="true">Icon</div><p>Text</p>`,
+			want: "Text",
+		},
+		{
+			name: "chrome words",
+			html: `<div class="site-nav">Nav</div><div id="main_menu">Menu</div><p class="unavailable">Sold out</p>`,
+			want: "Sold out",
+		},
+		{
+			name: "body class",
+			html: `<body class="has-sidebar"><p>Text</p></body>`,
+			want: "Text",
+		},
+		{
+			name: "main class",
+			html: `<main class="main-content with-menu"><p>Text</p></main>`,
+			want: "Text",
+		},
+		{
+			name: "inline",
+			html: `<p>a<span>b</span> <a href="/">c</a></p>`,
+			want: "ab c",
+		},
+		{
+			name: "empty",
+			html: ``,
+			want: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := Extract([]byte(tt.html), "", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if p.Text != tt.want {
+				t.Errorf("Text = %q, want %q", p.Text, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractMeta(t *testing.T) {
+	tests := []struct {
+		name    string
+		html    string
+		want    Page
+		wantErr bool
+	}{
+		{
+			name: "og description",
+			html: `<meta property="og:description" content="From Open Graph">`,
+			want: Page{Description: "From Open Graph"},
+		},
+		{
+			name: "content language",
+			html: `<meta http-equiv="Content-Language" content="fr">`,
+			want: Page{Lang: "fr"},
+		},
+		{
+			name: "lang attribute wins",
+			html: `<html lang="de"><meta http-equiv="content-language" content="fr">`,
+			want: Page{Lang: "de"},
+		},
+		{
+			name: "first title",
+			html: `<title>One</title><svg><title>Two</title></svg>`,
+			want: Page{Title: "One"},
+		},
+		{
+			name: "relative canonical without base",
+			html: `<link rel="canonical" href="/here">`,
+			want: Page{Canonical: "/here"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := Extract([]byte(tt.html), "text/html; charset=utf-8", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := Page{Title: p.Title, Description: p.Description, Canonical: p.Canonical, Lang: p.Lang}
+
+			if got.Title != tt.want.Title || got.Description != tt.want.Description ||
+				got.Canonical != tt.want.Canonical || got.Lang != tt.want.Lang {
+				t.Errorf("Extract() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractCharset(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		contentType string
+		wantCharset string
+		wantTitle   string
+	}{
+		{
+			name:        "header",
+			body:        "<title>Caf\xe9</title>",
+			contentType: "text/html; charset=ISO-8859-1",
+			wantCharset: "windows-1252",
+			wantTitle:   "Café",
+		},
+		{
+			name:        "meta charset",
+			body:        "<meta charset=\"koi8-r\"><title>\xf0\xd2\xc9\xd7\xc5\xd4</title>",
+			wantCharset: "koi8-r",
+			wantTitle:   "Привет",
+		},
+		{
+			name:        "meta http-equiv",
+			body:        "<meta http-equiv=\"Content-Type\" content=\"text/html; charset=shift_jis\"><title>\x93\xfa\x96\x7b</title>",
+			wantCharset: "shift_jis",
+			wantTitle:   "日本",
+		},
+		{
+			name:        "header beats meta",
+			body:        "<meta charset=\"koi8-r\"><title>Caf\xc3\xa9</title>",
+			contentType: "text/html; charset=utf-8",
+			wantCharset: "utf-8",
+			wantTitle:   "Café",
+		},
+		{
+			name:        "byte order mark",
+			body:        "\xfe\xff\x00<\x00t\x00i\x00t\x00l\x00e\x00>\x00h\x00i\x00<\x00/\x00t\x00i\x00t\x00l\x00e\x00>",
+			contentType: "text/html; charset=windows-1252",
+			wantCharset: "utf-16be",
+			wantTitle:   "hi",
+		},
+		{
+			name:        "utf-8 without a label",
+			body:        "<title>Café</title>",
+			wantCharset: "utf-8",
+			wantTitle:   "Café",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := Extract([]byte(tt.body), tt.contentType, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if p.Charset != tt.wantCharset || p.Title != tt.wantTitle {
+				t.Errorf("Extract() = %s %q, want %s %q", p.Charset, p.Title, tt.wantCharset, tt.wantTitle)
+			}
+		})
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// PageUnvisited marks graph nodes that were linked to but never crawled,
+// because they were past MaxDepth or MaxPages.
+const PageUnvisited PageStatus = "unvisited"
+
+// LinkGraph is the directed graph of pages and the links between them.
+// Nodes and edges are sorted so the same crawl always gives the same graph.
+type LinkGraph struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+// GraphNode is a page in a LinkGraph.
+type GraphNode struct {
+	URL    string     `json:"url"`
+	Title  string     `json:"title,omitempty"`
+	Status PageStatus `json:"status"`
+	Depth  int        `json:"depth"`
+}
+
+// GraphEdge is a link from one page to another.
+type GraphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// NewLinkGraph builds the link graph of a crawl. Links are matched to pages
+// on their canonical form under c, so "/pkg" and "/pkg/" are one node; a nil
+// c matches raw strings. A crawled node keeps the URL it was fetched as, and
+// an unvisited one the smallest of the URLs it was linked as.
+func NewLinkGraph(result *CrawlResult, c *Canonicalizer) *LinkGraph {
+	nodes := make(map[string]GraphNode)
+	edges := make(map[[2]string]bool)
+
+	for _, p := range result.Pages {
+		nodes[canonicalKey(c, p.URL)] = GraphNode{URL: p.URL, Title: p.Title, Status: p.Status, Depth: p.Depth}
+	}
+
+	for _, p := range result.Pages {
+		from := canonicalKey(c, p.URL)
+
+		for _, link := range p.Links {
+			to := canonicalKey(c, link)
+			edges[[2]string{from, to}] = true
+
+			n, ok := nodes[to]
+
+			switch {
+			case !ok:
+				nodes[to] = GraphNode{URL: link, Status: PageUnvisited, Depth: p.Depth + 1}
+			case n.Status == PageUnvisited:
+				n.URL = min(n.URL, link)
+				n.Depth = min(n.Depth, p.Depth+1)
+				nodes[to] = n
+			}
+		}
+	}
+
+	g := &LinkGraph{}
+
+	for _, n := range nodes {
+		g.Nodes = append(g.Nodes, n)
+	}
+
+	for e := range edges {
+		g.Edges = append(g.Edges, GraphEdge{From: nodes[e[0]].URL, To: nodes[e[1]].URL})
+	}
+
+	slices.SortFunc(g.Nodes, func(a, b GraphNode) int {
+		return strings.Compare(a.URL, b.URL)
+	})
+
+	slices.SortFunc(g.Edges, func(a, b GraphEdge) int {
+		return cmp.Or(strings.Compare(a.From, b.From), strings.Compare(a.To, b.To))
+	})
+
+	return g
+}
+
+// Orphans returns the crawled pages that no other page links to.
+func (g *LinkGraph) Orphans() []string {
+	linked := make(map[string]bool)
+
+	for _, e := range g.Edges {
+		if e.From != e.To {
+			linked[e.To] = true
+		}
+	}
+
+	var orphans []string
+
+	for _, n := range g.Nodes {
+		if n.Status != PageUnvisited && !linked[n.URL] {
+			orphans = append(orphans, n.URL)
+		}
+	}
+
+	return orphans
+}
+
+// WriteFile writes the graph to path, in the format named by its extension:
+// .dot or .gv for DOT, .graphml for GraphML and .json for JSON.
+func (g *LinkGraph) WriteFile(path string) error {
+	var write func(io.Writer) error
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".dot", ".gv":
+		write = g.WriteDOT
+	case ".graphml":
+		write = g.WriteGraphML
+	case ".json":
+		write = g.WriteJSON
+	default:
+		return fmt.Errorf("unknown graph format: %s", path)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// WriteJSON writes the graph as a JSON object with "nodes" and "edges".
+func (g *LinkGraph) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(g)
+}
+
+// WriteDOT writes the graph in the Graphviz DOT language.
+func (g *LinkGraph) WriteDOT(w io.Writer) error {
+	var b strings.Builder
+
+	b.WriteString("digraph crawl {\n")
+	b.WriteString("\tnode [shape=box];\n")
+
+	for _, n := range g.Nodes {
+		label := n.Title
+		if label == "" {
+			label = n.URL
+		}
+
+		fmt.Fprintf(&b, "\t%s [label=%s, status=%s, depth=%d",
+			dotQuote(n.URL), dotQuote(label), dotQuote(string(n.Status)), n.Depth)
+
+		switch n.Status {
+		case PageOK:
+		case PageUnvisited:
+			b.WriteString(", style=dashed")
+		default:
+			b.WriteString(", color=red")
+		}
+
+		b.WriteString("];\n")
+	}
+
+	for _, e := range g.Edges {
+		fmt.Fprintf(&b, "\t%s -> %s;\n", dotQuote(e.From), dotQuote(e.To))
+	}
+
+	b.WriteString("}\n")
+
+	_, err := io.WriteString(w, b.String())
+
+	return err
+}
+
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+
+	return `"` + s + `"`
+}
+
+type graphML struct {
+	XMLName xml.Name     `xml:"graphml"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   graphMLGraph `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID   string `xml:"id,attr"`
+	For  string `xml:"for,attr"`
+	Name string `xml:"attr.name,attr"`
+	Type string `xml:"attr.type,attr"`
+}
+
+type graphMLGraph struct {
+	ID          string        `xml:"id,attr"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Nodes       []graphMLNode `xml:"node"`
+	Edges       []graphMLEdge `xml:"edge"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	Source string `xml:"source,attr"`
+	Target string `xml:"target,attr"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+// WriteGraphML writes the graph as GraphML, with the title, status and depth
+// of each page as node data.
+func (g *LinkGraph) WriteGraphML(w io.Writer) error {
+	doc := graphML{
+		XMLNS: "http://graphml.graphdrawing.org/xmlns",
+		Keys: []graphMLKey{
+			{ID: "title", For: "node", Name: "title", Type: "string"},
+			{ID: "status", For: "node", Name: "status", Type: "string"},
+			{ID: "depth", For: "node", Name: "depth", Type: "int"},
+		},
+		Graph: graphMLGraph{ID: "crawl", EdgeDefault: "directed"},
+	}
+
+	for _, n := range g.Nodes {
+		doc.Graph.Nodes = append(doc.Graph.Nodes, graphMLNode{
+			ID: n.URL,
+			Data: []graphMLData{
+				{Key: "title", Value: n.Title},
+				{Key: "status", Value: string(n.Status)},
+				{Key: "depth", Value: strconv.Itoa(n.Depth)},
+			},
+		})
+	}
+
+	for _, e := range g.Edges {
+		doc.Graph.Edges = append(doc.Graph.Edges, graphMLEdge{Source: e.From, Target: e.To})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n")
+
+	return err
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+func fakeGraph(t *testing.T) *LinkGraph {
+	t.Helper()
+
+	result, err := Crawl(context.Background(), "https://golang.org/", 4, fetcher)
+	if err != nil {
+		t.Fatalf("Crawl() error = %v", err)
+	}
+
+	return NewLinkGraph(result, NewCanonicalizer())
+}
+
+// checkGolden compares got with testdata/name, or rewrites the file with -update.
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+
+	path := filepath.Join("testdata", name)
+
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s differs from the golden file:\n%s", name, got)
+	}
+}
+
+func TestLinkGraphGolden(t *testing.T) {
+	tests := []struct {
+		file  string
+		write func(g *LinkGraph, b *bytes.Buffer) error
+	}{
+		{"graph.dot", func(g *LinkGraph, b *bytes.Buffer) error { return g.WriteDOT(b) }},
+		{"graph.graphml", func(g *LinkGraph, b *bytes.Buffer) error { return g.WriteGraphML(b) }},
+		{"graph.json", func(g *LinkGraph, b *bytes.Buffer) error { return g.WriteJSON(b) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			// Crawl twice to make sure scheduling does not leak into the output.
+			for range 2 {
+				var b bytes.Buffer
+
+				if err := tt.write(fakeGraph(t), &b); err != nil {
+					t.Fatal(err)
+				}
+
+				checkGolden(t, tt.file, b.Bytes())
+			}
+		})
+	}
+}
+
+func TestLinkGraphUnvisitedAndOrphans(t *testing.T) {
+	result := &CrawlResult{
+		Pages: []PageResult{
+			{URL: "a", Status: PageOK, Depth: 0, Links: []string{"b", "a"}},
+			{URL: "b", Status: PageOK, Depth: 1, Links: []string{"c"}},
+			{URL: "lonely", Status: PageOK, Depth: 0},
+		},
+	}
+
+	g := NewLinkGraph(result, nil)
+
+	if n := g.Nodes[slices.IndexFunc(g.Nodes, func(n GraphNode) bool { return n.URL == "c" })]; n.Status != PageUnvisited || n.Depth != 2 {
+		t.Errorf("node c = %+v, want unvisited at depth 2", n)
+	}
+
+	if got, want := g.Orphans(), []string{"a", "lonely"}; !slices.Equal(got, want) {
+		t.Errorf("Orphans() = %q, want %q", got, want)
+	}
+}
+
+func TestLinkGraphCanonical(t *testing.T) {
+	result := &CrawlResult{
+		Pages: []PageResult{
+			{URL: "https://golang.org/", Status: PageOK, Depth: 0, Links: []string{"https://golang.org/pkg/", "https://golang.org/cmd/"}},
+			{URL: "https://golang.org/pkg/", Status: PageOK, Depth: 1, Links: []string{"https://golang.org/pkg", "https://golang.org/cmd"}},
+		},
+	}
+
+	g := NewLinkGraph(result, NewCanonicalizer())
+
+	var urls []string
+
+	for _, n := range g.Nodes {
+		urls = append(urls, n.URL)
+	}
+
+	if want := []string{"https://golang.org/", "https://golang.org/cmd", "https://golang.org/pkg/"}; !slices.Equal(urls, want) {
+		t.Errorf("nodes = %q, want %q", urls, want)
+	}
+
+	want := []GraphEdge{
+		{From: "https://golang.org/", To: "https://golang.org/cmd"},
+		{From: "https://golang.org/", To: "https://golang.org/pkg/"},
+		{From: "https://golang.org/pkg/", To: "https://golang.org/cmd"},
+		{From: "https://golang.org/pkg/", To: "https://golang.org/pkg/"},
+	}
+
+	if !slices.Equal(g.Edges, want) {
+		t.Errorf("edges = %+v, want %+v", g.Edges, want)
+	}
+
+	if got := g.Orphans(); len(got) != 1 || got[0] != "https://golang.org/" {
+		t.Errorf("Orphans() = %q, want only the seed", got)
+	}
+}
@@ -0,0 +1,470 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// ErrNotFound is returned when the requested page does not exist.
+var ErrNotFound = errors.New("not found")
+
+// ErrBodyTooLarge is returned when a response exceeds HTTPFetcher.MaxBodySize.
+var ErrBodyTooLarge = errors.New("response body too large")
+
+// StatusError reports a response with an unexpected HTTP status code.
+type StatusError struct {
+	URL        string
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("bad status %d: %s", e.StatusCode, e.URL)
+}
+
+// ContentTypeError reports a response whose media type is not accepted.
+type ContentTypeError struct {
+	URL         string
+	ContentType string
+}
+
+func (e *ContentTypeError) Error() string {
+	return fmt.Sprintf("unsupported content type %q: %s", e.ContentType, e.URL)
+}
+
+// HTTPFetcher is a Fetcher that issues real GET requests and
+// extracts the links of HTML pages.
+type HTTPFetcher struct {
+	Client *http.Client
+
+	// UserAgent is sent with every request when not empty.
+	UserAgent string
+
+	// Timeout bounds a whole fetch, including reading the body.
+	Timeout time.Duration
+
+	// MaxBodySize is the maximum number of body bytes read from a response.
+	MaxBodySize int64
+
+	// ContentTypes lists the accepted media types. An empty list accepts any.
+	ContentTypes []string
+}
+
+// NewHTTPFetcher returns an HTTPFetcher with sensible defaults.
+func NewHTTPFetcher() *HTTPFetcher {
+	return &HTTPFetcher{
+		Client:      &http.Client{},
+		UserAgent:   "learn-go-crawler/1.0",
+		Timeout:     10 * time.Second,
+		MaxBodySize: 10 << 20,
+		ContentTypes: []string{
+			"text/html",
+			"application/xhtml+xml",
+			"text/plain",
+		},
+	}
+}
+
+// Response is a fetched page together with its HTTP metadata.
+type Response struct {
+	URL        string
+	StatusCode int
+	Header     http.Header
+	Body       string
+	Links      []string
+}
+
+// ResponseFetcher is implemented by fetchers that can return the whole
+// response of a page, not just its body and links.
+type ResponseFetcher interface {
+	// FetchResponse fetches url, giving up when ctx is done. When the
+	// server answers with an error status, the Response is returned along
+	// with the error.
+	FetchResponse(ctx context.Context, url string) (*Response, error)
+}
+
+// Revalidator is implemented by fetchers that can make conditional requests.
+type Revalidator interface {
+	// Revalidate fetches url again unless it still matches the ETag and
+	// Last-Modified validators of cached. When it does, the returned
+	// Response has status 304 Not Modified and no body.
+	Revalidate(ctx context.Context, url string, cached *Response) (*Response, error)
+}
+
+// StreamFetcher is implemented by fetchers that can hand out the body of a
+// response as it arrives, for files too large to hold in memory.
+type StreamFetcher interface {
+	// FetchStream fetches url and returns its body unread. The caller must
+	// close it. The media type is not checked and the size is not limited.
+	FetchStream(ctx context.Context, url string) (io.ReadCloser, error)
+}
+
+func (f *HTTPFetcher) Fetch(rawURL string) (string, []string, error) {
+	return bodyAndLinks(f.FetchResponse(context.Background(), rawURL))
+}
+
+func (f *HTTPFetcher) FetchResponse(ctx context.Context, rawURL string) (*Response, error) {
+	return f.fetch(ctx, rawURL, nil)
+}
+
+func (f *HTTPFetcher) Revalidate(ctx context.Context, rawURL string, cached *Response) (*Response, error) {
+	return f.fetch(ctx, rawURL, cached)
+}
+
+// FetchStream GETs rawURL and returns its body as it arrives. Timeout only
+// bounds the wait for the response headers, since the body is read at the
+// caller's pace.
+func (f *HTTPFetcher) FetchStream(ctx context.Context, rawURL string) (io.ReadCloser, error) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	if f.Timeout > 0 {
+		timer := time.AfterFunc(f.Timeout, cancel)
+		defer timer.Stop()
+	}
+
+	resp, err := f.do(ctx, rawURL, nil)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	if err := statusError(rawURL, resp.StatusCode); err != nil {
+		resp.Body.Close()
+		cancel()
+
+		return nil, err
+	}
+
+	return &streamBody{ReadCloser: resp.Body, cancel: cancel}, nil
+}
+
+// streamBody is a response body that releases its request when closed.
+type streamBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *streamBody) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
+
+// fetch GETs rawURL, as a conditional request when cached is not nil.
+func (f *HTTPFetcher) fetch(ctx context.Context, rawURL string, cached *Response) (*Response, error) {
+	if f.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, f.Timeout)
+		defer cancel()
+	}
+
+	resp, err := f.do(ctx, rawURL, cached)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	page := &Response{
+		URL:        rawURL,
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+	}
+
+	if cached != nil && resp.StatusCode == http.StatusNotModified {
+		return page, nil
+	}
+
+	if err := statusError(rawURL, resp.StatusCode); err != nil {
+		return page, err
+	}
+
+	body := io.Reader(resp.Body)
+	mediaType := mediaTypeOf(resp.Header.Get("Content-Type"))
+
+	// Servers that leave out the header still send a body we can look at,
+	// so sniff its first bytes the way browsers do instead of rejecting it.
+	if mediaType == "" {
+		head := make([]byte, 512)
+		n, _ := io.ReadFull(resp.Body, head)
+
+		mediaType = mediaTypeOf(http.DetectContentType(head[:n]))
+		body = io.MultiReader(bytes.NewReader(head[:n]), resp.Body)
+	}
+
+	if len(f.ContentTypes) > 0 && !slices.Contains(f.ContentTypes, mediaType) && !acceptsAnyContentType(ctx) {
+		return page, &ContentTypeError{URL: rawURL, ContentType: mediaType}
+	}
+
+	page.Body, err = f.readBody(body)
+	if err != nil {
+		return page, fmt.Errorf("read %s: %w", rawURL, err)
+	}
+
+	if isHTML(mediaType) {
+		// Relative links are resolved against the URL we ended up at after redirects.
+		page.Links = extractLinks(resp.Request.URL, page.Body)
+	}
+
+	return page, nil
+}
+
+// do sends a GET for rawURL, as a conditional request when cached is not nil.
+func (f *HTTPFetcher) do(ctx context.Context, rawURL string, cached *Response) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if f.UserAgent != "" {
+		req.Header.Set("User-Agent", f.UserAgent)
+	}
+
+	if cached != nil {
+		if etag := cached.Header.Get("ETag"); etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+
+		if lastModified := cached.Header.Get("Last-Modified"); lastModified != "" {
+			req.Header.Set("If-Modified-Since", lastModified)
+		}
+	}
+
+	client := f.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return client.Do(req)
+}
+
+type acceptAnyKey struct{}
+
+// acceptAnyContentType returns a copy of ctx under which an HTTPFetcher
+// reads the body whatever its media type, for files like robots.txt that
+// are fetched for the crawler itself rather than as pages.
+func acceptAnyContentType(ctx context.Context) context.Context {
+	return context.WithValue(ctx, acceptAnyKey{}, true)
+}
+
+func acceptsAnyContentType(ctx context.Context) bool {
+	accept, _ := ctx.Value(acceptAnyKey{}).(bool)
+	return accept
+}
+
+// bodyAndLinks turns the result of FetchResponse into the result of Fetch.
+func bodyAndLinks(resp *Response, err error) (string, []string, error) {
+	if err != nil {
+		return "", nil, err
+	}
+
+	return resp.Body, resp.Links, nil
+}
+
+// fetchResponse fetches url with f, wrapping the body and links of a
+// plain Fetcher in a 200 OK Response. Only a ResponseFetcher can be
+// interrupted by ctx.
+func fetchResponse(ctx context.Context, f Fetcher, url string) (*Response, error) {
+	if rf, ok := f.(ResponseFetcher); ok {
+		return rf.FetchResponse(ctx, url)
+	}
+
+	body, links, err := f.Fetch(url)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Response{URL: url, StatusCode: http.StatusOK, Body: body, Links: links}, nil
+}
+
+// revalidate revalidates cached with f, or fetches url again when f
+// cannot make conditional requests.
+func revalidate(ctx context.Context, f Fetcher, url string, cached *Response) (*Response, error) {
+	if rv, ok := f.(Revalidator); ok {
+		return rv.Revalidate(ctx, url, cached)
+	}
+
+	return fetchResponse(ctx, f, url)
+}
+
+// statusError returns the error for a non-2xx status code, or nil.
+func statusError(rawURL string, code int) error {
+	switch {
+	case code == http.StatusNotFound || code == http.StatusGone:
+		return fmt.Errorf("%w: %s", ErrNotFound, rawURL)
+	case code < 200 || code > 299:
+		return &StatusError{URL: rawURL, StatusCode: code}
+	default:
+		return nil
+	}
+}
+
+func (f *HTTPFetcher) readBody(r io.Reader) (string, error) {
+	if f.MaxBodySize <= 0 {
+		b, err := io.ReadAll(r)
+		return string(b), err
+	}
+
+	// Read one extra byte so we can tell a body of exactly MaxBodySize
+	// apart from one that was truncated.
+	b, err := io.ReadAll(io.LimitReader(r, f.MaxBodySize+1))
+	if err != nil {
+		return "", err
+	}
+
+	if int64(len(b)) > f.MaxBodySize {
+		return "", ErrBodyTooLarge
+	}
+
+	return string(b), nil
+}
+
+func mediaTypeOf(contentType string) string {
+	if contentType == "" {
+		return ""
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	}
+
+	return mediaType
+}
+
+func isHTML(mediaType string) bool {
+	return mediaType == "text/html" || mediaType == "application/xhtml+xml"
+}
+
+// extractLinks returns the absolute http(s) targets of every <a href> and
+// <link href> in body, in document order and without duplicates. The first
+// <base href> in the document overrides base; later ones are ignored.
+func extractLinks(base *url.URL, body string) []string {
+	var links []string
+	var hasBase bool
+
+	seen := make(map[string]bool)
+	z := html.NewTokenizer(strings.NewReader(body))
+
+	for {
+		tt := z.Next()
+
+		if tt == html.ErrorToken {
+			return links
+		}
+
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			continue
+		}
+
+		name, hasAttr := z.TagName()
+		tag := atom.Lookup(name)
+
+		if !hasAttr || (tag != atom.A && tag != atom.Link && tag != atom.Base) {
+			continue
+		}
+
+		href, ok := attr(z, "href")
+		if !ok {
+			continue
+		}
+
+		ref, err := url.Parse(strings.TrimSpace(href))
+		if err != nil {
+			continue
+		}
+
+		if tag == atom.Base {
+			if hasBase {
+				continue
+			}
+
+			hasBase = true
+
+			if base != nil {
+				base = base.ResolveReference(ref)
+			} else {
+				base = ref
+			}
+			continue
+		}
+
+		if base != nil {
+			ref = base.ResolveReference(ref)
+		}
+
+		if ref.Scheme != "http" && ref.Scheme != "https" {
+			continue
+		}
+
+		// Fragments never reach the server, so they do not name a new page.
+		ref.Fragment = ""
+		ref.RawFragment = ""
+
+		link := ref.String()
+
+		if !seen[link] {
+			seen[link] = true
+			links = append(links, link)
+		}
+	}
+}
+
+// pageTitle returns the text of the first <title> in body. Bodies without one,
+// like the canned pages of fakeFetcher, use their first non-empty line.
+func pageTitle(body string) string {
+	z := html.NewTokenizer(strings.NewReader(body))
+
+	for {
+		tt := z.Next()
+
+		if tt == html.ErrorToken {
+			break
+		}
+
+		if name, _ := z.TagName(); tt != html.StartTagToken || atom.Lookup(name) != atom.Title {
+			continue
+		}
+
+		if z.Next() == html.TextToken {
+			return strings.Join(strings.Fields(string(z.Text())), " ")
+		}
+
+		return ""
+	}
+
+	if strings.Contains(body, "<") {
+		return ""
+	}
+
+	for line := range strings.Lines(body) {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+
+	return ""
+}
+
+func attr(z *html.Tokenizer, key string) (string, bool) {
+	for {
+		k, v, more := z.TagAttr()
+
+		if string(k) == key {
+			return string(v), true
+		}
+
+		if !more {
+			return "", false
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestSite(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, `<html><head>
+			<title>Home</title>
+			<link rel="stylesheet" href="/style.css">
+		</head><body>
+			<a href="docs/">Docs</a>
+			<a href="/docs/#intro">Docs again</a>
+			<a href="https://example.com/out">Out</a>
+			<a href="mailto:me@example.com">Mail</a>
+			<a href="javascript:void(0)">JS</a>
+			<a>No href</a>
+		</body></html>`)
+	})
+
+	mux.HandleFunc("/docs/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<head><base href="/api/v1/"><base href="/api/v2/"></head><a href="users">Users</a>`)
+	})
+
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/docs/", http.StatusMovedPermanently)
+	})
+
+	mux.HandleFunc("/plain.txt", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprint(w, `<a href="/not-a-link">`)
+	})
+
+	mux.HandleFunc("/untyped", func(w http.ResponseWriter, r *http.Request) {
+		// A nil value stops the server from sniffing a Content-Type itself.
+		w.Header()["Content-Type"] = nil
+		fmt.Fprint(w, `<html><a href="/docs/">Docs</a></html>`)
+	})
+
+	mux.HandleFunc("/image.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		fmt.Fprint(w, "\x89PNG")
+	})
+
+	mux.HandleFunc("/big", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, strings.Repeat("a", 2048))
+	})
+
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	})
+
+	mux.HandleFunc("/broken", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	mux.HandleFunc("/agent", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprint(w, r.UserAgent())
+	})
+
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+
+	return ts
+}
+
+func TestHTTPFetcherLinks(t *testing.T) {
+	ts := newTestSite(t)
+	f := NewHTTPFetcher()
+
+	body, urls, err := f.Fetch(ts.URL + "/")
+	if err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+
+	if !strings.Contains(body, "<title>Home</title>") {
+		t.Errorf("Fetch() body = %q, want the page HTML", body)
+	}
+
+	want := []string{
+		ts.URL + "/style.css",
+		ts.URL + "/docs/",
+		"https://example.com/out",
+	}
+
+	if !slices.Equal(urls, want) {
+		t.Errorf("Fetch() urls = %q, want %q", urls, want)
+	}
+}
+
+func TestHTTPFetcherBaseAndRedirect(t *testing.T) {
+	ts := newTestSite(t)
+	f := NewHTTPFetcher()
+
+	for _, path := range []string{"/docs/", "/moved"} {
+		_, urls, err := f.Fetch(ts.URL + path)
+		if err != nil {
+			t.Fatalf("Fetch(%q) error = %v", path, err)
+		}
+
+		want := []string{ts.URL + "/api/v1/users"}
+
+		if !slices.Equal(urls, want) {
+			t.Errorf("Fetch(%q) urls = %q, want %q", path, urls, want)
+		}
+	}
+}
+
+func TestHTTPFetcherPlainText(t *testing.T) {
+	ts := newTestSite(t)
+	f := NewHTTPFetcher()
+
+	body, urls, err := f.Fetch(ts.URL + "/plain.txt")
+	if err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+
+	if body != `<a href="/not-a-link">` || urls != nil {
+		t.Errorf("Fetch() = %q, %q, want the raw body and no links", body, urls)
+	}
+}
+
+func TestHTTPFetcherSniffsMissingContentType(t *testing.T) {
+	ts := newTestSite(t)
+	f := NewHTTPFetcher()
+
+	_, urls, err := f.Fetch(ts.URL + "/untyped")
+	if err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+
+	want := []string{ts.URL + "/docs/"}
+
+	if !slices.Equal(urls, want) {
+		t.Errorf("Fetch() urls = %q, want %q", urls, want)
+	}
+}
+
+func TestHTTPFetcherCancel(t *testing.T) {
+	ts := newTestSite(t)
+	f := NewHTTPFetcher()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+
+	_, err := f.FetchResponse(ctx, ts.URL+"/slow")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("FetchResponse() error = %v, want %v", err, context.Canceled)
+	}
+
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Errorf("FetchResponse() took %v, want it to stop when ctx is canceled", elapsed)
+	}
+}
+
+func TestHTTPFetcherUserAgent(t *testing.T) {
+	ts := newTestSite(t)
+	f := NewHTTPFetcher()
+	f.UserAgent = "test-agent"
+
+	body, _, err := f.Fetch(ts.URL + "/agent")
+	if err != nil || body != "test-agent" {
+		t.Errorf("Fetch() = %q, %v, want %q, nil", body, err, "test-agent")
+	}
+}
+
+func TestHTTPFetcherErrors(t *testing.T) {
+	ts := newTestSite(t)
+
+	tests := []struct {
+		name  string
+		path  string
+		setup func(f *HTTPFetcher)
+		check func(err error) bool
+	}{
+		{
+			name:  "not found",
+			path:  "/missing",
+			check: func(err error) bool { return errors.Is(err, ErrNotFound) },
+		},
+		{
+			name: "bad status",
+			path: "/broken",
+			check: func(err error) bool {
+				var se *StatusError
+				return errors.As(err, &se) && se.StatusCode == http.StatusInternalServerError
+			},
+		},
+		{
+			name: "content type",
+			path: "/image.png",
+			check: func(err error) bool {
+				var ce *ContentTypeError
+				return errors.As(err, &ce) && ce.ContentType == "image/png"
+			},
+		},
+		{
+			name:  "body too large",
+			path:  "/big",
+			setup: func(f *HTTPFetcher) { f.MaxBodySize = 1024 },
+			check: func(err error) bool { return errors.Is(err, ErrBodyTooLarge) },
+		},
+		{
+			name:  "timeout",
+			path:  "/slow",
+			setup: func(f *HTTPFetcher) { f.Timeout = 50 * time.Millisecond },
+			check: func(err error) bool { return errors.Is(err, context.DeadlineExceeded) },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := NewHTTPFetcher()
+
+			if tt.setup != nil {
+				tt.setup(f)
+			}
+
+			_, _, err := f.Fetch(ts.URL + tt.path)
+			if err == nil || !tt.check(err) {
+				t.Errorf("Fetch(%q) error = %v", tt.path, err)
+			}
+		})
+	}
+}
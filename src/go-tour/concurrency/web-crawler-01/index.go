@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/gob"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// BM25 parameters. k1 controls how quickly repeated terms stop adding to
+// the score and b how much long pages are penalized.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// Tokenize splits text into lowercase words made of letters and digits.
+// The index of a word in the returned slice is its position in text.
+func Tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// IndexDoc is a page in an Index.
+type IndexDoc struct {
+	URL   string
+	Title string
+
+	// Length is the number of words on the page.
+	Length int
+}
+
+// Posting records where a term appears on one page. The term frequency is
+// the number of positions.
+type Posting struct {
+	Doc       int
+	Positions []int
+}
+
+// Index is an inverted full-text index of crawled pages. It is safe for
+// concurrent use, so pages can be added while the crawl is running.
+type Index struct {
+	mu       sync.RWMutex
+	docs     []IndexDoc
+	ids      map[string]int
+	postings map[string][]Posting
+	totalLen int
+}
+
+// NewIndex returns an empty Index.
+func NewIndex() *Index {
+	return &Index{
+		ids:      make(map[string]int),
+		postings: make(map[string][]Posting),
+	}
+}
+
+// Len returns the number of pages in the index.
+func (ix *Index) Len() int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	return len(ix.docs)
+}
+
+// Add indexes the visible text of body as the page at url. Adding a URL
+// that is already indexed replaces the earlier version of the page.
+func (ix *Index) Add(url string, title string, body string) {
+	words := Tokenize(visibleText(body))
+
+	positions := make(map[string][]int)
+
+	for i, w := range words {
+		positions[w] = append(positions[w], i)
+	}
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	id, ok := ix.ids[url]
+
+	if ok {
+		ix.remove(id)
+	} else {
+		id = len(ix.docs)
+		ix.ids[url] = id
+		ix.docs = append(ix.docs, IndexDoc{URL: url})
+	}
+
+	ix.docs[id] = IndexDoc{URL: url, Title: title, Length: len(words)}
+	ix.totalLen += len(words)
+
+	for term, pos := range positions {
+		list := ix.postings[term]
+
+		// Keep postings sorted by document, which a replaced page can break.
+		i, _ := slices.BinarySearchFunc(list, id, func(p Posting, id int) int {
+			return cmp.Compare(p.Doc, id)
+		})
+
+		ix.postings[term] = slices.Insert(list, i, Posting{Doc: id, Positions: pos})
+	}
+}
+
+// remove drops the postings of document id. The caller holds the lock.
+func (ix *Index) remove(id int) {
+	ix.totalLen -= ix.docs[id].Length
+
+	for term, list := range ix.postings {
+		list = slices.DeleteFunc(list, func(p Posting) bool {
+			return p.Doc == id
+		})
+
+		if len(list) == 0 {
+			delete(ix.postings, term)
+		} else {
+			ix.postings[term] = list
+		}
+	}
+}
+
+// Hit is a page matching a search.
+type Hit struct {
+	URL   string
+	Title string
+	Score float64
+}
+
+// Search returns up to limit pages matching query, best first. Pages are
+// ranked with BM25 over the query terms that are not negated. A limit of
+// zero or less returns every match.
+func (ix *Index) Search(query string, limit int) ([]Hit, error) {
+	q, err := ParseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	matches := q.root.eval(ix)
+
+	hits := make([]Hit, 0, len(matches))
+
+	for id := range matches {
+		doc := ix.docs[id]
+		hits = append(hits, Hit{URL: doc.URL, Title: doc.Title, Score: ix.score(id, q.terms)})
+	}
+
+	slices.SortFunc(hits, func(a, b Hit) int {
+		return cmp.Or(cmp.Compare(b.Score, a.Score), strings.Compare(a.URL, b.URL))
+	})
+
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+
+	return hits, nil
+}
+
+// score returns the BM25 score of document id for terms.
+func (ix *Index) score(id int, terms []string) float64 {
+	n := float64(len(ix.docs))
+	avgLen := float64(ix.totalLen) / n
+	docLen := float64(ix.docs[id].Length)
+
+	var score float64
+
+	for _, term := range terms {
+		list := ix.postings[term]
+
+		p, ok := ix.posting(term, id)
+		if !ok {
+			continue
+		}
+
+		df := float64(len(list))
+		tf := float64(len(p.Positions))
+
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		score += idf * tf * (bm25K1 + 1) / (tf + bm25K1*(1-bm25B+bm25B*docLen/avgLen))
+	}
+
+	return score
+}
+
+// posting returns the posting of term in document id.
+func (ix *Index) posting(term string, id int) (Posting, bool) {
+	list := ix.postings[term]
+
+	i, ok := slices.BinarySearchFunc(list, id, func(p Posting, id int) int {
+		return cmp.Compare(p.Doc, id)
+	})
+	if !ok {
+		return Posting{}, false
+	}
+
+	return list[i], true
+}
+
+// indexFile is the on-disk form of an Index.
+type indexFile struct {
+	Docs     []IndexDoc
+	Postings map[string][]Posting
+}
+
+// Save writes the index to path in gob format, replacing the file atomically.
+func (ix *Index) Save(path string) error {
+	ix.mu.RLock()
+	file := indexFile{Docs: ix.docs, Postings: ix.postings}
+
+	var buf bytes.Buffer
+
+	err := gob.NewEncoder(&buf).Encode(file)
+	ix.mu.RUnlock()
+
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path, buf.Bytes())
+}
+
+// LoadIndex reads an index written by Index.Save.
+func LoadIndex(path string) (*Index, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var file indexFile
+
+	if err := gob.NewDecoder(f).Decode(&file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	ix := NewIndex()
+	ix.docs = file.Docs
+
+	if file.Postings != nil {
+		ix.postings = file.Postings
+	}
+
+	for id, doc := range ix.docs {
+		ix.ids[doc.URL] = id
+		ix.totalLen += doc.Length
+	}
+
+	return ix, nil
+}
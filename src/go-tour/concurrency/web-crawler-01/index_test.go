@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	got := Tokenize("Go's net/http, HTTP/2 and ünïcode!")
+	want := []string{"go", "s", "net", "http", "http", "2", "and", "ünïcode"}
+
+	if !slices.Equal(got, want) {
+		t.Errorf("Tokenize() = %q, want %q", got, want)
+	}
+}
+
+func newTestIndex() *Index {
+	ix := NewIndex()
+
+	ix.Add("a", "Concurrency", "<title>Concurrency</title><p>Go channels and goroutines make concurrency simple.</p>")
+	ix.Add("b", "Channels", "Channels channels channels. Buffered channels block when full.")
+	ix.Add("c", "HTTP", "<p>The net/http library serves HTTP. <script>channels()</script></p>")
+	ix.Add("d", "Packages", "Every Go program is made of packages. The http package is one of them.")
+
+	return ix
+}
+
+func hitURLs(hits []Hit) []string {
+	var urls []string
+
+	for _, h := range hits {
+		urls = append(urls, h.URL)
+	}
+
+	return urls
+}
+
+func TestIndexSearch(t *testing.T) {
+	ix := newTestIndex()
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"channels", []string{"b", "a"}},
+		{"go channels", []string{"a"}},
+		{"go AND channels", []string{"a"}},
+		{"goroutines OR buffered", []string{"a", "b"}},
+		{"channels -go", []string{"b"}},
+		{"channels NOT go", []string{"b"}},
+		{"NOT channels", []string{"c", "d"}},
+		{"(goroutines OR buffered) AND block", []string{"b"}},
+		{"go OR http package", []string{"a", "d"}},
+		{`"http package"`, []string{"d"}},
+		{`"package http"`, nil},
+		{"net/http", []string{"c"}},
+		{"CONCURRENCY", []string{"a"}},
+		{"missing", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			hits, err := ix.Search(tt.query, 0)
+			if err != nil {
+				t.Fatalf("Search() error = %v", err)
+			}
+
+			got := hitURLs(hits)
+
+			// Pages with equal scores are ordered by URL, so only compare
+			// the order when the test cares about ranking.
+			if len(tt.want) > 1 && tt.query != "channels" {
+				slices.Sort(got)
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Search(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIndexSearchRanking(t *testing.T) {
+	ix := NewIndex()
+
+	ix.Add("once-long", "", "crawler one two three four five six seven eight nine ten eleven twelve")
+	ix.Add("once-short", "", "crawler one two")
+	ix.Add("twice", "", "crawler crawler one two")
+	ix.Add("none", "", "nothing to see")
+
+	hits, err := ix.Search("crawler", 0)
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+
+	want := []string{"twice", "once-short", "once-long"}
+
+	if got := hitURLs(hits); !slices.Equal(got, want) {
+		t.Errorf("Search() = %q, want %q", got, want)
+	}
+
+	for i := 1; i < len(hits); i++ {
+		if hits[i].Score >= hits[i-1].Score {
+			t.Errorf("Search() scores = %v, want them decreasing", hits)
+		}
+	}
+
+	hits, _ = ix.Search("crawler", 1)
+
+	if got := hitURLs(hits); !slices.Equal(got, want[:1]) {
+		t.Errorf("Search() with limit 1 = %q, want %q", got, want[:1])
+	}
+}
+
+func TestIndexReplacePage(t *testing.T) {
+	ix := newTestIndex()
+
+	ix.Add("b", "Channels", "This page is about mutexes now.")
+
+	if hits, _ := ix.Search("buffered", 0); len(hits) != 0 {
+		t.Errorf("Search(buffered) = %q after the page changed, want nothing", hitURLs(hits))
+	}
+
+	if hits, _ := ix.Search("mutexes", 0); !slices.Equal(hitURLs(hits), []string{"b"}) {
+		t.Errorf("Search(mutexes) = %q, want [b]", hitURLs(hits))
+	}
+
+	if ix.Len() != 4 {
+		t.Errorf("Len() = %d, want 4", ix.Len())
+	}
+}
+
+func TestIndexSaveLoad(t *testing.T) {
+	ix := newTestIndex()
+	path := filepath.Join(t.TempDir(), "crawl.idx")
+
+	if err := ix.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadIndex(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, query := range []string{"channels", `"http package"`, "go -packages"} {
+		want, _ := ix.Search(query, 0)
+		got, _ := loaded.Search(query, 0)
+
+		if !slices.Equal(got, want) {
+			t.Errorf("Search(%q) after load = %v, want %v", query, got, want)
+		}
+	}
+
+	// The loaded index keeps growing incrementally.
+	loaded.Add("e", "Select", "select waits on several channels")
+
+	if hits, _ := loaded.Search("select", 0); !slices.Equal(hitURLs(hits), []string{"e"}) {
+		t.Errorf("Search(select) = %q, want [e]", hitURLs(hits))
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	for _, query := range []string{"", "  ", "(go", "go)", `"go`, "go OR", "NOT", "!!!", "go AND AND"} {
+		if _, err := ParseQuery(query); err == nil {
+			t.Errorf("ParseQuery(%q) error = nil, want an error", query)
+		}
+	}
+}
+
+func TestCrawlBuildsIndex(t *testing.T) {
+	ix := NewIndex()
+
+	c := NewCrawler(fetcher)
+	c.OnPage = func(page PageResult, body string) {
+		ix.Add(page.URL, page.Title, body)
+	}
+
+	if _, err := c.Crawl(context.Background(), "https://golang.org/"); err != nil {
+		t.Fatalf("Crawl() error = %v", err)
+	}
+
+	// /cmd/ is not found, so only the pages that fetched are indexed.
+	if ix.Len() != 4 {
+		t.Errorf("Len() = %d, want 4", ix.Len())
+	}
+
+	hits, err := ix.Search("package", 0)
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+
+	want := []string{"https://golang.org/pkg/fmt/", "https://golang.org/pkg/os/"}
+
+	if got := hitURLs(hits); !slices.Equal(got, want) {
+		t.Errorf("Search(package) = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"slices"
+	"strings"
+)
+
+// ErrorClass groups fetch errors by their cause.
+type ErrorClass string
+
+const (
+	ErrorNotFound  ErrorClass = "not_found"
+	ErrorTimeout   ErrorClass = "timeout"
+	ErrorBadStatus ErrorClass = "bad_status"
+	ErrorDNS       ErrorClass = "dns"
+	ErrorOther     ErrorClass = "other"
+)
+
+// ClassifyError returns the class of a fetch error.
+func ClassifyError(err error) ErrorClass {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	var statusErr *StatusError
+
+	switch {
+	case errors.As(err, &dnsErr):
+		return ErrorDNS
+	case errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, os.ErrDeadlineExceeded),
+		errors.As(err, &netErr) && netErr.Timeout():
+		return ErrorTimeout
+	case errors.Is(err, ErrNotFound):
+		return ErrorNotFound
+	case errors.As(err, &statusErr):
+		return ErrorBadStatus
+	default:
+		return ErrorOther
+	}
+}
+
+// BrokenLink is a URL that failed to fetch, with every page that links to it.
+type BrokenLink struct {
+	URL       string     `json:"url"`
+	Class     ErrorClass `json:"class"`
+	Error     string     `json:"error"`
+	Depth     int        `json:"depth"`
+	Referrers []string   `json:"referrers"`
+}
+
+// SkippedLink is a URL whose target was never judged, such as a page
+// disallowed by robots.txt or a response of a content type the crawler
+// does not read.
+type SkippedLink struct {
+	URL    string `json:"url"`
+	Reason string `json:"reason"`
+	Depth  int    `json:"depth"`
+}
+
+// LinkReport lists the broken links found by a crawl.
+type LinkReport struct {
+	Checked int           `json:"checked"`
+	Broken  []BrokenLink  `json:"broken"`
+	Skipped []SkippedLink `json:"skipped"`
+
+	// passed holds the URLs that fetched fine, for the JUnit test cases.
+	passed []string
+}
+
+// NewLinkReport collects the failed pages of result. Only client and server
+// error statuses and network failures make a link broken. Pages that were
+// canceled, disallowed by robots.txt or failed for other reasons, like an
+// unwanted content type, were never checked and are listed as skipped.
+// Links are matched to pages on their canonical form under c, or on the raw
+// string when c is nil.
+func NewLinkReport(result *CrawlResult, c *Canonicalizer) *LinkReport {
+	referrers := make(map[string][]string)
+
+	for _, p := range result.Pages {
+		for _, link := range p.Links {
+			key := canonicalKey(c, link)
+
+			if !slices.Contains(referrers[key], p.URL) {
+				referrers[key] = append(referrers[key], p.URL)
+			}
+		}
+	}
+
+	r := &LinkReport{Broken: []BrokenLink{}, Skipped: []SkippedLink{}}
+
+	for _, p := range result.Pages {
+		switch p.Status {
+		case PageOK, PageDuplicate:
+			r.Checked++
+			r.passed = append(r.passed, p.URL)
+
+		case PageDisallowed:
+			r.skip(p, "disallowed by robots.txt")
+
+		case PageCanceled:
+			r.skip(p, "canceled")
+
+		case PageError:
+			if !isBroken(p.Err) {
+				r.skip(p, p.Err.Error())
+				continue
+			}
+
+			r.Checked++
+
+			refs := slices.Clone(referrers[canonicalKey(c, p.URL)])
+			slices.Sort(refs)
+
+			r.Broken = append(r.Broken, BrokenLink{
+				URL:       p.URL,
+				Class:     ClassifyError(p.Err),
+				Error:     p.Err.Error(),
+				Depth:     p.Depth,
+				Referrers: refs,
+			})
+		}
+	}
+
+	slices.Sort(r.passed)
+
+	slices.SortFunc(r.Broken, func(a, b BrokenLink) int {
+		return cmp.Compare(a.URL, b.URL)
+	})
+
+	slices.SortFunc(r.Skipped, func(a, b SkippedLink) int {
+		return cmp.Compare(a.URL, b.URL)
+	})
+
+	return r
+}
+
+func (r *LinkReport) skip(p PageResult, reason string) {
+	r.Skipped = append(r.Skipped, SkippedLink{URL: p.URL, Reason: reason, Depth: p.Depth})
+}
+
+// isBroken reports whether err means the link itself is broken: the server
+// answered with a client or server error status, or could not be reached.
+func isBroken(err error) bool {
+	var statusErr *StatusError
+	var netErr net.Error
+
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return true
+	case errors.As(err, &statusErr):
+		return statusErr.StatusCode >= 400 && statusErr.StatusCode <= 599
+	case errors.Is(err, context.Canceled):
+		return false
+	default:
+		// DNS errors and timeouts are network errors too.
+		return errors.As(err, &netErr)
+	}
+}
+
+// WriteText writes a human readable report.
+func (r *LinkReport) WriteText(w io.Writer) error {
+	var b strings.Builder
+
+	for _, l := range r.Broken {
+		fmt.Fprintf(&b, "BROKEN %s (%s, depth %d)\n", l.URL, l.Class, l.Depth)
+		fmt.Fprintf(&b, "  error: %s\n", l.Error)
+
+		for _, ref := range l.Referrers {
+			fmt.Fprintf(&b, "  linked from: %s\n", ref)
+		}
+	}
+
+	for _, l := range r.Skipped {
+		fmt.Fprintf(&b, "SKIPPED %s (%s, depth %d)\n", l.URL, l.Reason, l.Depth)
+	}
+
+	fmt.Fprintf(&b, "%d links checked, %d broken, %d skipped\n", r.Checked, len(r.Broken), len(r.Skipped))
+
+	_, err := io.WriteString(w, b.String())
+
+	return err
+}
+
+// WriteJSON writes the report as JSON.
+func (r *LinkReport) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(r)
+}
+
+type junitSuites struct {
+	XMLName xml.Name     `xml:"testsuites"`
+	Suites  []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Skipped  int         `xml:"skipped,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+// WriteJUnit writes the report as JUnit XML, with one test case per
+// checked URL, so CI systems can show broken links as failed tests.
+// Skipped URLs are skipped test cases.
+func (r *LinkReport) WriteJUnit(w io.Writer) error {
+	suite := junitSuite{
+		Name:     "links",
+		Tests:    r.Checked + len(r.Skipped),
+		Failures: len(r.Broken),
+		Skipped:  len(r.Skipped),
+	}
+
+	for _, url := range r.passed {
+		suite.Cases = append(suite.Cases, junitCase{Name: url, ClassName: "links"})
+	}
+
+	for _, l := range r.Broken {
+		text := "linked from:\n" + strings.Join(l.Referrers, "\n")
+
+		suite.Cases = append(suite.Cases, junitCase{
+			Name:      l.URL,
+			ClassName: "links",
+			Failure:   &junitFailure{Message: l.Error, Type: string(l.Class), Text: text},
+		})
+	}
+
+	for _, l := range r.Skipped {
+		suite.Cases = append(suite.Cases, junitCase{
+			Name:      l.URL,
+			ClassName: "links",
+			Skipped:   &junitSkipped{Message: l.Reason},
+		})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+
+	if err := enc.Encode(junitSuites{Suites: []junitSuite{suite}}); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n")
+
+	return err
+}
+
+// CheckReportFormat returns an error unless format is one that Write
+// supports: "text", "json" or "junit".
+func CheckReportFormat(format string) error {
+	switch format {
+	case "text", "json", "junit":
+		return nil
+	default:
+		return fmt.Errorf("unknown report format: %s", format)
+	}
+}
+
+// Write writes the report in format, which is "text", "json" or "junit".
+func (r *LinkReport) Write(w io.Writer, format string) error {
+	if err := CheckReportFormat(format); err != nil {
+		return err
+	}
+
+	switch format {
+	case "json":
+		return r.WriteJSON(w)
+	case "junit":
+		return r.WriteJUnit(w)
+	default:
+		return r.WriteText(w)
+	}
+}
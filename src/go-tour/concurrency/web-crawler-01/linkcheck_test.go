@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want ErrorClass
+	}{
+		{fmt.Errorf("%w: https://golang.org/cmd/", ErrNotFound), ErrorNotFound},
+		{&StatusError{URL: "u", StatusCode: 500}, ErrorBadStatus},
+		{fmt.Errorf("get: %w", &net.DNSError{Err: "no such host", Name: "nope.invalid", IsNotFound: true}), ErrorDNS},
+		{fmt.Errorf("get: %w", context.DeadlineExceeded), ErrorTimeout},
+		{&ContentTypeError{URL: "u", ContentType: "image/png"}, ErrorOther},
+		{errors.New("boom"), ErrorOther},
+	}
+
+	for _, tt := range tests {
+		if got := ClassifyError(tt.err); got != tt.want {
+			t.Errorf("ClassifyError(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestClassifyHTTPErrors(t *testing.T) {
+	ts := newTestSite(t)
+
+	f := NewHTTPFetcher()
+	f.Timeout = 50 * time.Millisecond
+
+	tests := []struct {
+		path string
+		want ErrorClass
+	}{
+		{"/missing", ErrorNotFound},
+		{"/broken", ErrorBadStatus},
+		{"/slow", ErrorTimeout},
+	}
+
+	for _, tt := range tests {
+		_, _, err := f.Fetch(ts.URL + tt.path)
+
+		if got := ClassifyError(err); got != tt.want {
+			t.Errorf("ClassifyError(Fetch(%q)) = %q, want %q (%v)", tt.path, got, tt.want, err)
+		}
+	}
+}
+
+func fakeLinkReport(t *testing.T) *LinkReport {
+	t.Helper()
+
+	result, err := Crawl(context.Background(), "https://golang.org/", 4, fetcher)
+	if err != nil {
+		t.Fatalf("Crawl() error = %v", err)
+	}
+
+	return NewLinkReport(result, NewCanonicalizer())
+}
+
+func TestLinkReport(t *testing.T) {
+	r := fakeLinkReport(t)
+
+	if r.Checked != 5 || len(r.Broken) != 1 {
+		t.Fatalf("NewLinkReport() = %d checked, %d broken, want 5 checked, 1 broken", r.Checked, len(r.Broken))
+	}
+
+	got := r.Broken[0]
+	want := BrokenLink{
+		URL:       "https://golang.org/cmd/",
+		Class:     ErrorNotFound,
+		Error:     "not found: https://golang.org/cmd/",
+		Depth:     1,
+		Referrers: []string{"https://golang.org/", "https://golang.org/pkg/"},
+	}
+
+	if got.URL != want.URL || got.Class != want.Class || got.Error != want.Error ||
+		got.Depth != want.Depth || !slices.Equal(got.Referrers, want.Referrers) {
+		t.Errorf("Broken[0] = %+v, want %+v", got, want)
+	}
+}
+
+func TestLinkReportLastDepth(t *testing.T) {
+	c := NewCrawler(fetcher)
+	c.MaxDepth = 1
+	c.CheckLinks = true
+
+	result, err := c.Crawl(context.Background(), "https://golang.org/")
+	if err != nil {
+		t.Fatalf("Crawl() error = %v", err)
+	}
+
+	if page, _ := result.Page("https://golang.org/pkg/"); page.Depth != 1 || page.Status != PageOK || len(page.Links) == 0 {
+		t.Errorf("last depth link = %+v, want checked at depth 1", page)
+	}
+
+	if _, ok := result.Page("https://golang.org/pkg/fmt/"); ok {
+		t.Error("links of the last depth pages were expanded")
+	}
+
+	r := NewLinkReport(result, c.Visited.Canonicalizer)
+
+	if r.Checked != 3 || len(r.Broken) != 1 || r.Broken[0].URL != "https://golang.org/cmd/" {
+		t.Errorf("NewLinkReport() = %d checked, %+v broken, want 3 checked, /cmd/ broken", r.Checked, r.Broken)
+	}
+}
+
+func TestLinkReportCanonicalReferrers(t *testing.T) {
+	result := &CrawlResult{
+		Pages: []PageResult{
+			{URL: "https://golang.org/", Status: PageOK, Links: []string{"https://golang.org/cmd/"}},
+			{URL: "https://golang.org/pkg/", Status: PageOK, Depth: 1, Links: []string{"https://golang.org/cmd"}},
+			{URL: "https://golang.org/cmd/", Status: PageError, Depth: 1, Err: ErrNotFound},
+		},
+	}
+
+	r := NewLinkReport(result, NewCanonicalizer())
+
+	if want := []string{"https://golang.org/", "https://golang.org/pkg/"}; len(r.Broken) != 1 || !slices.Equal(r.Broken[0].Referrers, want) {
+		t.Errorf("Broken = %+v, want /cmd/ referred by %q", r.Broken, want)
+	}
+}
+
+func TestLinkReportSkipped(t *testing.T) {
+	dnsErr := fmt.Errorf("get: %w", &net.DNSError{Err: "no such host", Name: "nope.invalid", IsNotFound: true})
+
+	result := &CrawlResult{
+		Pages: []PageResult{
+			{URL: "https://a.example/", Status: PageOK},
+			{URL: "https://a.example/down", Status: PageError, Err: &StatusError{URL: "https://a.example/down", StatusCode: 503}},
+			{URL: "https://nope.invalid/", Status: PageError, Err: dnsErr},
+			{URL: "https://a.example/logo.png", Status: PageError, Err: &ContentTypeError{URL: "https://a.example/logo.png", ContentType: "image/png"}},
+			{URL: "https://a.example/huge", Status: PageError, Err: fmt.Errorf("read https://a.example/huge: %w", ErrBodyTooLarge)},
+			{URL: "https://b.example/", Status: PageError, Err: ErrCircuitOpen},
+			{URL: "https://a.example/admin", Status: PageDisallowed},
+			{URL: "https://a.example/later", Status: PageCanceled, Err: context.Canceled},
+		},
+	}
+
+	r := NewLinkReport(result, nil)
+
+	var broken, skipped []string
+
+	for _, l := range r.Broken {
+		broken = append(broken, l.URL)
+	}
+
+	for _, l := range r.Skipped {
+		skipped = append(skipped, l.URL)
+	}
+
+	wantBroken := []string{"https://a.example/down", "https://nope.invalid/"}
+	wantSkipped := []string{
+		"https://a.example/admin",
+		"https://a.example/huge",
+		"https://a.example/later",
+		"https://a.example/logo.png",
+		"https://b.example/",
+	}
+
+	if !slices.Equal(broken, wantBroken) {
+		t.Errorf("Broken = %q, want %q", broken, wantBroken)
+	}
+
+	if !slices.Equal(skipped, wantSkipped) {
+		t.Errorf("Skipped = %q, want %q", skipped, wantSkipped)
+	}
+
+	if r.Checked != 3 {
+		t.Errorf("Checked = %d, want 3", r.Checked)
+	}
+}
+
+func TestCheckReportFormat(t *testing.T) {
+	for _, format := range []string{"text", "json", "junit"} {
+		if err := CheckReportFormat(format); err != nil {
+			t.Errorf("CheckReportFormat(%q) error = %v", format, err)
+		}
+	}
+
+	if err := CheckReportFormat("yaml"); err == nil {
+		t.Error("CheckReportFormat(yaml) error = nil, want an error")
+	}
+}
+
+func TestLinkReportFormats(t *testing.T) {
+	r := fakeLinkReport(t)
+
+	var text bytes.Buffer
+
+	if err := r.Write(&text, "text"); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(text.String(), "BROKEN https://golang.org/cmd/ (not_found, depth 1)") {
+		t.Errorf("text report = %q", text.String())
+	}
+
+	var js bytes.Buffer
+
+	if err := r.Write(&js, "json"); err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded LinkReport
+
+	if err := json.Unmarshal(js.Bytes(), &decoded); err != nil || len(decoded.Broken) != 1 {
+		t.Errorf("json report = %s, %v", js.String(), err)
+	}
+
+	var junit bytes.Buffer
+
+	if err := r.Write(&junit, "junit"); err != nil {
+		t.Fatal(err)
+	}
+
+	var suites junitSuites
+
+	if err := xml.Unmarshal(junit.Bytes(), &suites); err != nil {
+		t.Fatalf("junit report does not parse: %v", err)
+	}
+
+	suite := suites.Suites[0]
+
+	if suite.Tests != 5 || suite.Failures != 1 || len(suite.Cases) != 5 {
+		t.Errorf("junit suite = %d tests, %d failures, %d cases, want 5, 1, 5", suite.Tests, suite.Failures, len(suite.Cases))
+	}
+
+	if err := r.Write(&junit, "yaml"); err == nil {
+		t.Error("Write(yaml) error = nil, want an error")
+	}
+}
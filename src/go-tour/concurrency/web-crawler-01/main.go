@@ -1,8 +1,20 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"io/fs"
+	"log"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
 	"sync"
+	"time"
 )
 
 type Fetcher interface {
@@ -11,70 +23,622 @@ type Fetcher interface {
 	Fetch(url string) (body string, urls []string, err error)
 }
 
-// Crawl uses fetcher to recursively crawl
-// pages starting with url, to a maximum of depth.
-func Crawl(url string, depth int, fetcher Fetcher, wg *sync.WaitGroup, cachedUrl *CachedUrl) {
-	defer wg.Done()
+// CachedUrl is the set of URLs a crawl has already visited.
+type CachedUrl struct {
+	mu          sync.Mutex
+	visitedUrls map[string]bool
+
+	// Canonicalizer, when set, dedupes URLs on their canonical form
+	// instead of the raw string.
+	Canonicalizer *Canonicalizer
+}
+
+// NewCachedUrl returns an empty CachedUrl that dedupes on canonical URLs.
+func NewCachedUrl() *CachedUrl {
+	return &CachedUrl{
+		visitedUrls:   make(map[string]bool),
+		Canonicalizer: NewCanonicalizer(),
+	}
+}
+
+// Visit marks url as visited and reports whether it had been visited before.
+func (c *CachedUrl) Visit(url string) bool {
+	key := c.key(url)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.visitedUrls[key] {
+		return true // Already visited
+	}
+
+	c.visitedUrls[key] = true // Mark it NOW, while we still hold the lock
+
+	return false // New visit
+}
+
+// Keys returns the visited keys in sorted order.
+func (c *CachedUrl) Keys() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	keys := make([]string, 0, len(c.visitedUrls))
+
+	for key := range c.visitedUrls {
+		keys = append(keys, key)
+	}
+
+	slices.Sort(keys)
+
+	return keys
+}
+
+// Restore marks keys, as returned by Keys, as visited.
+func (c *CachedUrl) Restore(keys []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.visitedUrls == nil {
+		c.visitedUrls = make(map[string]bool)
+	}
+
+	for _, key := range keys {
+		c.visitedUrls[key] = true
+	}
+}
+
+func (c *CachedUrl) key(url string) string {
+	return canonicalKey(c.Canonicalizer, url)
+}
+
+// canonicalKey returns the canonical form of url under c, or url itself
+// when c is nil.
+func canonicalKey(c *Canonicalizer, url string) string {
+	if c == nil {
+		return url
+	}
+
+	// A URL that does not parse can still be deduped on its raw string.
+	key, err := c.Canonicalize(url)
+	if err != nil {
+		return url
+	}
+
+	return key
+}
+
+func main() {
+	if len(os.Args) > 1 {
+		commands := map[string]func(args []string) error{
+			"query":       runQuery,
+			"coordinator": runCoordinator,
+			"worker":      runWorker,
+		}
+
+		if command, ok := commands[os.Args[1]]; ok {
+			if err := command(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+
+			return
+		}
+	}
+
+	seed := flag.String("url", "https://golang.org/", "URL to start crawling from")
+	depth := flag.Int("depth", 4, "maximum crawl depth")
+	useHTTP := flag.Bool("http", false, "fetch pages over HTTP instead of the canned fake fetcher")
+	workers := flag.Int("workers", 4, "number of pages fetched in parallel")
+	maxPages := flag.Int("max-pages", 0, "maximum number of pages to fetch, 0 for no limit")
+	timeout := flag.Duration("timeout", 0, "stop the crawl after this long, 0 for no limit")
+	userAgent := flag.String("user-agent", "learn-go-crawler/1.0", "User-Agent sent with requests and matched against robots.txt")
+	robots := flag.Bool("robots", true, "obey robots.txt")
+	delay := flag.Duration("delay", 0, "minimum time between two requests to the same host")
+	checkpoint := flag.String("checkpoint", "", "file to save crawl checkpoints to")
+	checkpointEvery := flag.Int("checkpoint-every", 100, "save a checkpoint after this many pages")
+	resume := flag.Bool("resume", false, "resume the crawl saved in -checkpoint instead of starting from -url")
+	graph := flag.String("graph", "", "write the link graph to this .dot, .graphml or .json file")
+	rank := flag.Int("rank", 0, "print the top pages ranked by PageRank, HITS and degree, 0 to skip")
+	checkLinks := flag.Bool("check-links", false, "report broken links instead of listing every page, and exit 1 if any are found")
+	reportFormat := flag.String("report-format", "text", "broken link report format: text, json or junit")
+	reportPath := flag.String("report", "", "write the broken link report to this file instead of stdout")
+	nearDup := flag.Int("near-dup", 3, "mark pages within this many SimHash bits of another page as duplicates, -1 to disable")
+	record := flag.String("record", "", "record every fetch to this fixture file")
+	replay := flag.String("replay", "", "serve fetches from this fixture or .warc file instead of the network")
+	warcPath := flag.String("warc", "", "archive every fetch to this WARC file, compressed per record if it ends in .gz")
+	replayLatency := flag.Duration("replay-latency", 0, "simulated latency of each replayed fetch")
+	cache := flag.Bool("cache", false, "cache responses in memory and revalidate them with conditional requests")
+	retries := flag.Int("retries", 0, "retry fetches that fail with a transient error this many times")
+	breaker := flag.Int("breaker", 0, "stop fetching from a host after this many failures in a row, 0 to disable")
+	breakerCooldown := flag.Duration("breaker-cooldown", 30*time.Second, "how long a host is skipped once -breaker trips")
+	logFetches := flag.Bool("log-fetches", false, "log every fetch to stderr")
+	jsonl := flag.String("jsonl", "", "write every page, with its extracted title, metadata, headings and text, to this JSON Lines file")
+	indexPath := flag.String("index", "", "add the crawled pages to this full-text index file, for the query command")
+	stripTracking := flag.Bool("strip-tracking", false, "ignore tracking query parameters such as utm_source when deduping URLs")
+
+	var sitemaps []string
+
+	flag.Func("sitemap", "read seeds from this sitemap.xml file or URL (repeatable)", func(loc string) error {
+		sitemaps = append(sitemaps, loc)
+		return nil
+	})
+
+	seedList := flag.String("seeds", "", "read seeds from this file, one URL per line")
+	since := flag.String("since", "", "skip sitemap entries whose lastmod is before this date (YYYY-MM-DD)")
+
+	flag.Parse()
+
+	// Catch a bad format before the crawl rather than after it.
+	if *checkLinks {
+		if err := CheckReportFormat(*reportFormat); err != nil {
+			log.Fatalf("bad -report-format: %v", err)
+		}
+	}
+
+	var f Fetcher = fetcher
+	var httpFetcher *HTTPFetcher
+
+	if *useHTTP {
+		hf := NewHTTPFetcher()
+		hf.UserAgent = *userAgent
+		httpFetcher = hf
+		f = hf
+	}
+
+	if *replay != "" {
+		load := LoadFixture
+
+		if isWARC(*replay) {
+			load = LoadWARC
+		}
+
+		fx, err := load(*replay)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		rf := NewReplayFetcher(fx, 1)
+		rf.Latency = *replayLatency
+		f = rf
+	}
+
+	var middlewares []Middleware
+
+	if *cache {
+		middlewares = append(middlewares, WithCache())
+	}
+
+	if *breaker > 0 {
+		middlewares = append(middlewares, WithBreaker(*breaker, *breakerCooldown))
+	}
+
+	if *retries > 0 {
+		middlewares = append(middlewares, WithRetry(*retries+1))
+	}
+
+	if *logFetches {
+		middlewares = append(middlewares, WithLogging(slog.New(slog.NewTextHandler(os.Stderr, nil))))
+	}
+
+	var archive *WARCWriter
+
+	if *warcPath != "" {
+		file, err := os.Create(*warcPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer file.Close()
+
+		archive = NewWARCWriter(file)
+		archive.Gzip = strings.HasSuffix(*warcPath, ".gz")
+
+		err = archive.WriteInfo([]WARCField{
+			{Name: "software", Value: *userAgent},
+			{Name: "format", Value: "WARC File Format 1.1"},
+			{Name: "conformsTo", Value: "https://iipc.github.io/warc-specifications/specifications/warc-format/warc-1.1/"},
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// Archive what goes over the wire, under the cache and the retries.
+		middlewares = append(middlewares, WithWARC(archive, *userAgent))
+	}
+
+	f = Chain(f, middlewares...)
+
+	var recorder *RecordingFetcher
+
+	if *record != "" {
+		recorder = NewRecordingFetcher(f)
+		f = recorder
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	c := NewCrawler(f)
+	c.Workers = *workers
+	c.MaxDepth = *depth
+	c.MaxPages = *maxPages
+	c.Limiter = NewHostLimiter(*delay)
+	c.Visited.Canonicalizer.StripTrackingParams = *stripTracking
+	c.Extract = *jsonl != ""
+	c.CheckLinks = *checkLinks
+
+	if *nearDup >= 0 {
+		c.Duplicates = NewDuplicateDetector(*nearDup)
+	}
+
+	if *robots {
+		c.Robots = NewRobotsPolicy(f, *userAgent)
+		c.Robots.Limiter = c.Limiter
+	}
+
+	if *checkpoint != "" {
+		c.Checkpoints = NewCheckpointStore(*checkpoint)
+		c.CheckpointEvery = *checkpointEvery
+	}
+
+	var index *Index
+
+	if *indexPath != "" {
+		var err error
+
+		index, err = openIndex(*indexPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		c.OnPage = func(page PageResult, body string) {
+			index.Add(page.URL, page.Title, body)
+		}
+	}
+
+	var result *CrawlResult
+	var err error
+
+	if *resume {
+		result, err = c.Resume(ctx)
+	} else {
+		loader := NewSitemapLoader(f)
+
+		// Stream sitemaps straight from the HTTP client, since the
+		// middlewares hold whole responses in memory.
+		if httpFetcher != nil && *replay == "" {
+			loader.Fetcher = httpFetcher
+		}
 
-	// TODO: Fetch URLs in parallel.
-	// TODO: Don't fetch the same URL twice.
-	// This implementation doesn't do either:
-	if depth <= 0 {
-		return
+		loader.Robots = c.Robots
+		loader.Limiter = c.Limiter
+
+		if *since != "" {
+			t, err := time.Parse(time.DateOnly, *since)
+			if err != nil {
+				log.Fatalf("bad -since: %v", err)
+			}
+
+			loader.Since = t
+		}
+
+		result, err = crawlSeeds(ctx, c, loader, *seed, sitemaps, *seedList)
+	}
+
+	if result == nil {
+		log.Fatal(err)
+	}
+
+	if index != nil {
+		if err := index.Save(*indexPath); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if archive != nil {
+		if err := archive.Err(); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if recorder != nil {
+		if err := recorder.Fixture().Save(*record); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	broken := false
+
+	if *checkLinks {
+		var reportErr error
+
+		broken, reportErr = writeLinkReport(result, c.Visited.Canonicalizer, *reportFormat, *reportPath)
+		if reportErr != nil {
+			log.Fatal(reportErr)
+		}
+	} else {
+		printResult(result)
 	}
 
-	if cachedUrl.Visit(url) {
-		fmt.Printf("already visited: %s\n", url)
-		return
+	if *jsonl != "" {
+		if err := writeJSONLinesFile(result, *jsonl); err != nil {
+			log.Fatal(err)
+		}
 	}
 
-	fmt.Printf("visiting: %s\n", url)
+	if *graph != "" {
+		if err := NewLinkGraph(result, c.Visited.Canonicalizer).WriteFile(*graph); err != nil {
+			log.Fatal(err)
+		}
+	}
 
-	body, urls, err := fetcher.Fetch(url)
+	if *rank > 0 {
+		metrics := NewLinkAnalysis().Analyze(NewLinkGraph(result, c.Visited.Canonicalizer))
 
-	fmt.Printf("Crawl: depth=%d url=%s\n", depth, url)
+		if err := metrics.WriteText(os.Stdout, *rank); err != nil {
+			log.Fatal(err)
+		}
+	}
 
 	if err != nil {
-		fmt.Println(err)
-		return
+		log.Fatal(err)
 	}
 
-	fmt.Printf("found: %s %q\n", url, body)
+	if broken {
+		os.Exit(1)
+	}
+}
 
-	for _, url := range urls {
-		wg.Add(1)
-		go Crawl(url, depth-1, fetcher, wg, cachedUrl)
+// isWARC reports whether path names a WARC file rather than a JSON fixture.
+func isWARC(path string) bool {
+	return strings.HasSuffix(path, ".warc") || strings.HasSuffix(path, ".warc.gz")
+}
+
+// printResult lists every page of result on stdout.
+func printResult(result *CrawlResult) {
+	for _, page := range result.Pages {
+		fmt.Printf("%-8s depth=%d time=%v url=%s\n", page.Status, page.Depth, page.Duration.Round(time.Millisecond), page.URL)
+
+		if page.Err != nil {
+			fmt.Printf("         %v\n", page.Err)
+		}
+	}
+
+	for _, cluster := range result.DuplicateClusters() {
+		fmt.Printf("duplicates: %s\n", strings.Join(cluster, " "))
 	}
+
+	fmt.Printf("crawled %d pages in %v\n", len(result.Pages), result.Duration.Round(time.Millisecond))
 }
 
-type CachedUrl struct {
-	mu          sync.Mutex
-	visitedUrls map[string]bool
+// crawlSeeds crawls the seeds of the sitemaps and seed list, queueing each
+// one as soon as it is read. When neither is given, the crawl starts from
+// url alone. A seed that fails to load is returned with the crawl's error.
+func crawlSeeds(ctx context.Context, c *Crawler, loader *SitemapLoader, url string, sitemaps []string, seedList string) (*CrawlResult, error) {
+	if len(sitemaps) == 0 && seedList == "" {
+		return c.Crawl(ctx, url)
+	}
+
+	// The loader stops when the crawl does, even if it stopped early.
+	loadCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	seeds := make(chan string)
+	loadErr := make(chan error, 1)
+
+	go func() {
+		defer close(seeds)
+
+		loadErr <- loadSeeds(loadCtx, loader, sitemaps, seedList, func(seed string) error {
+			select {
+			case seeds <- seed:
+				return nil
+			case <-loadCtx.Done():
+				return loadCtx.Err()
+			}
+		})
+	}()
+
+	result, err := c.CrawlFrom(ctx, seeds)
+
+	cancel()
+
+	if seedErr := <-loadErr; seedErr != nil && !errors.Is(seedErr, context.Canceled) {
+		err = errors.Join(err, seedErr)
+	}
+
+	return result, err
 }
 
-func (c *CachedUrl) Visit(url string) bool {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+// loadSeeds calls add with every seed of the sitemaps and the seed list file.
+func loadSeeds(ctx context.Context, loader *SitemapLoader, sitemaps []string, seedList string, add func(seed string) error) error {
+	for _, loc := range sitemaps {
+		if err := loader.Load(ctx, loc, add); err != nil {
+			return err
+		}
+	}
 
-	if c.visitedUrls[url] {
-		return true // Already visited
+	if seedList == "" {
+		return nil
 	}
 
-	c.visitedUrls[url] = true // Mark it NOW, while we still hold the lock
+	f, err := os.Open(seedList)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
 
-	return false // New visit
+	if err := ReadSeedList(f, add); err != nil {
+		return fmt.Errorf("%s: %w", seedList, err)
+	}
+
+	return nil
 }
 
-func main() {
-	var wg sync.WaitGroup
+// writeLinkReport writes the broken link report of result to path, or to
+// stdout when path is empty, and reports whether any link was broken.
+func writeLinkReport(result *CrawlResult, canonicalizer *Canonicalizer, format string, path string) (bool, error) {
+	report := NewLinkReport(result, canonicalizer)
 
-	cachedUrl := CachedUrl{visitedUrls: make(map[string]bool)}
+	if path == "" {
+		return len(report.Broken) > 0, report.Write(os.Stdout, format)
+	}
 
-	wg.Add(1)
+	f, err := os.Create(path)
+	if err != nil {
+		return false, err
+	}
 
-	go Crawl("https://golang.org/", 4, fetcher, &wg, &cachedUrl)
+	if err := report.Write(f, format); err != nil {
+		f.Close()
+		return false, err
+	}
+
+	return len(report.Broken) > 0, f.Close()
+}
+
+// openIndex loads the index at path, or returns an empty one if there is none yet.
+func openIndex(path string) (*Index, error) {
+	index, err := LoadIndex(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return NewIndex(), nil
+	}
+
+	return index, err
+}
+
+// runQuery searches an index built by a crawl with -index and prints the
+// best matches.
+func runQuery(args []string) error {
+	flags := flag.NewFlagSet("query", flag.ExitOnError)
+	indexPath := flags.String("index", "crawl.idx", "index file to search")
+	limit := flags.Int("limit", 10, "maximum number of results, 0 for all")
+
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: %s query [flags] query...\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+
+	// ExitOnError makes Parse exit on bad flags instead of returning.
+	_ = flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	index, err := LoadIndex(*indexPath)
+	if err != nil {
+		return err
+	}
+
+	hits, err := index.Search(strings.Join(flags.Args(), " "), *limit)
+	if err != nil {
+		return err
+	}
+
+	for _, hit := range hits {
+		fmt.Printf("%7.3f  %s  %s\n", hit.Score, hit.URL, hit.Title)
+	}
+
+	fmt.Printf("%d results from %d pages\n", len(hits), index.Len())
+
+	return nil
+}
+
+// runCoordinator serves a crawl to workers started with the worker command.
+func runCoordinator(args []string) error {
+	flags := flag.NewFlagSet("coordinator", flag.ExitOnError)
+	listen := flags.String("listen", "localhost:7070", "TCP address to accept workers on")
+	seed := flags.String("url", "https://golang.org/", "URL to start crawling from")
+	depth := flags.Int("depth", 4, "maximum crawl depth")
+	maxPages := flags.Int("max-pages", 0, "maximum number of pages to fetch, 0 for no limit")
+	leaseTimeout := flags.Duration("lease", 10*time.Second, "hand a page to another worker when its worker is silent this long")
+	pageTimeout := flags.Duration("page-timeout", time.Minute, "hand a page to another worker when its worker is busy with it this long, 0 for no limit")
+	delay := flags.Duration("delay", 0, "minimum time between two requests to the same host, across all workers")
+	checkpoint := flags.String("checkpoint", "", "file to save crawl checkpoints to")
+
+	// ExitOnError makes Parse exit on bad flags instead of returning.
+	_ = flags.Parse(args)
+
+	// Workers send five heartbeats per lease, which needs some time between them.
+	if *leaseTimeout < 100*time.Millisecond {
+		return fmt.Errorf("bad -lease %v: must be at least 100ms", *leaseTimeout)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	l, err := net.Listen("tcp", *listen)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("coordinator listening on %s", l.Addr())
+
+	c := NewCoordinator()
+	c.Crawler.MaxDepth = *depth
+	c.Crawler.MaxPages = *maxPages
+	c.LeaseTimeout = *leaseTimeout
+	c.HeartbeatEvery = *leaseTimeout / 5
+	c.PageTimeout = *pageTimeout
+	c.HostDelay = *delay
+
+	if *checkpoint != "" {
+		c.Crawler.Checkpoints = NewCheckpointStore(*checkpoint)
+		c.Crawler.CheckpointEvery = 100
+	}
+
+	result, err := c.Crawl(ctx, l, []string{*seed})
+	if result != nil {
+		printResult(result)
+	}
+
+	return err
+}
+
+// runWorker fetches pages for a coordinator until its crawl is over.
+func runWorker(args []string) error {
+	flags := flag.NewFlagSet("worker", flag.ExitOnError)
+	addr := flags.String("coordinator", "localhost:7070", "TCP address of the coordinator")
+	useHTTP := flags.Bool("http", false, "fetch pages over HTTP instead of the canned fake fetcher")
+	workers := flags.Int("workers", 4, "number of pages fetched in parallel")
+	userAgent := flags.String("user-agent", "learn-go-crawler/1.0", "User-Agent sent with requests and matched against robots.txt")
+	robots := flags.Bool("robots", true, "obey robots.txt")
+	delay := flags.Duration("delay", 0, "minimum time between two requests to the same host")
+
+	// ExitOnError makes Parse exit on bad flags instead of returning.
+	_ = flags.Parse(args)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var f Fetcher = fetcher
+
+	if *useHTTP {
+		hf := NewHTTPFetcher()
+		hf.UserAgent = *userAgent
+		f = hf
+	}
+
+	w := NewRemoteWorker(f)
+	w.Crawler.Workers = *workers
+	w.Crawler.Limiter = NewHostLimiter(*delay)
+
+	if host, err := os.Hostname(); err == nil {
+		w.Name = host
+	}
+
+	if *robots {
+		w.Crawler.Robots = NewRobotsPolicy(f, *userAgent)
+		w.Crawler.Robots.Limiter = w.Crawler.Limiter
+	}
 
-	wg.Wait()
+	return w.Run(ctx, *addr)
 }
 
 // fakeFetcher is Fetcher that returns canned results.
@@ -89,7 +653,7 @@ func (f fakeFetcher) Fetch(url string) (string, []string, error) {
 	if res, ok := f[url]; ok {
 		return res.body, res.urls, nil
 	}
-	return "", nil, fmt.Errorf("not found: %s", url)
+	return "", nil, fmt.Errorf("%w: %s", ErrNotFound, url)
 }
 
 // fetcher is a populated fakeFetcher.
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// FetcherFunc adapts an ordinary function to the Fetcher interface.
+type FetcherFunc func(url string) (body string, urls []string, err error)
+
+func (f FetcherFunc) Fetch(url string) (string, []string, error) {
+	return f(url)
+}
+
+// Middleware wraps a Fetcher with extra behavior.
+//
+// The fetchers returned by the middlewares in this package also implement
+// ResponseFetcher and Revalidator, and pass both through to the Fetcher they
+// wrap, so they can be stacked in any order.
+type Middleware func(Fetcher) Fetcher
+
+// Chain wraps f in middlewares. The first middleware is the outermost, so
+// it sees every fetch first.
+func Chain(f Fetcher, middlewares ...Middleware) Fetcher {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		f = middlewares[i](f)
+	}
+
+	return f
+}
+
+// LoggingFetcher logs every fetch of the Fetcher it wraps.
+type LoggingFetcher struct {
+	Fetcher Fetcher
+	Logger  *slog.Logger
+}
+
+// NewLoggingFetcher returns a LoggingFetcher that logs to logger.
+func NewLoggingFetcher(fetcher Fetcher, logger *slog.Logger) *LoggingFetcher {
+	return &LoggingFetcher{Fetcher: fetcher, Logger: logger}
+}
+
+// WithLogging returns a Middleware that logs fetches to logger.
+func WithLogging(logger *slog.Logger) Middleware {
+	return func(f Fetcher) Fetcher {
+		return NewLoggingFetcher(f, logger)
+	}
+}
+
+func (f *LoggingFetcher) Fetch(url string) (string, []string, error) {
+	return bodyAndLinks(f.FetchResponse(context.Background(), url))
+}
+
+func (f *LoggingFetcher) FetchResponse(ctx context.Context, url string) (*Response, error) {
+	return f.log("fetch", url, func() (*Response, error) {
+		return fetchResponse(ctx, f.Fetcher, url)
+	})
+}
+
+func (f *LoggingFetcher) Revalidate(ctx context.Context, url string, cached *Response) (*Response, error) {
+	return f.log("revalidate", url, func() (*Response, error) {
+		return revalidate(ctx, f.Fetcher, url, cached)
+	})
+}
+
+func (f *LoggingFetcher) log(msg string, url string, fetch func() (*Response, error)) (*Response, error) {
+	logger := f.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	start := time.Now()
+	resp, err := fetch()
+
+	attrs := []slog.Attr{
+		slog.String("url", url),
+		slog.Duration("duration", time.Since(start)),
+	}
+
+	if resp != nil {
+		attrs = append(attrs,
+			slog.Int("status", resp.StatusCode),
+			slog.Int("bytes", len(resp.Body)),
+			slog.Int("links", len(resp.Links)),
+		)
+	}
+
+	level := slog.LevelInfo
+
+	if err != nil {
+		level = slog.LevelWarn
+		attrs = append(attrs, slog.String("error", err.Error()), slog.String("class", string(ClassifyError(err))))
+	}
+
+	logger.LogAttrs(context.Background(), level, msg, attrs...)
+
+	return resp, err
+}
@@ -0,0 +1,535 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestChain(t *testing.T) {
+	var calls []string
+
+	trace := func(name string) Middleware {
+		return func(next Fetcher) Fetcher {
+			return FetcherFunc(func(url string) (string, []string, error) {
+				calls = append(calls, name)
+				return next.Fetch(url)
+			})
+		}
+	}
+
+	f := Chain(fetcher, trace("outer"), trace("inner"))
+
+	body, _, err := f.Fetch("https://golang.org/")
+	if err != nil || body != "The Go Programming Language" {
+		t.Fatalf("Fetch() = %q, %v", body, err)
+	}
+
+	if want := []string{"outer", "inner"}; !slices.Equal(calls, want) {
+		t.Errorf("calls = %q, want %q", calls, want)
+	}
+}
+
+// cacheSite serves /etag with an ETag and max-age, /lastmod with only a
+// Last-Modified date and /nostore with no-store, counting requests.
+type cacheSite struct {
+	*httptest.Server
+
+	mu          sync.Mutex
+	version     string
+	requests    int
+	notModified int
+}
+
+func newCacheSite(t *testing.T) *cacheSite {
+	t.Helper()
+
+	s := &cacheSite{version: "v1"}
+	modified := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/etag", func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.requests++
+		etag := `"` + s.version + `"`
+
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", "max-age=60")
+
+		if r.Header.Get("If-None-Match") == etag {
+			s.notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprint(w, "etag "+s.version)
+	})
+
+	mux.HandleFunc("/lastmod", func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.requests++
+
+		if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !modified.After(since) {
+			s.notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprint(w, "lastmod")
+	})
+
+	mux.HandleFunc("/nostore", func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.requests++
+
+		w.Header().Set("ETag", `"x"`)
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprint(w, "nostore")
+	})
+
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func (s *cacheSite) counts() (requests, notModified int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.requests, s.notModified
+}
+
+func TestCacheFetcher(t *testing.T) {
+	site := newCacheSite(t)
+
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	cache := NewCacheFetcher(NewHTTPFetcher())
+	cache.Now = func() time.Time { return now }
+
+	steps := []struct {
+		name        string
+		path        string
+		advance     time.Duration
+		version     string
+		body        string
+		requests    int
+		notModified int
+	}{
+		{"first fetch", "/etag", 0, "v1", "etag v1", 1, 0},
+		{"fresh", "/etag", 30 * time.Second, "v1", "etag v1", 1, 0},
+		{"stale and unchanged", "/etag", time.Minute, "v1", "etag v1", 2, 1},
+		{"fresh again after 304", "/etag", 30 * time.Second, "v1", "etag v1", 2, 1},
+		{"stale and changed", "/etag", time.Minute, "v2", "etag v2", 3, 1},
+		{"last modified", "/lastmod", 0, "v2", "lastmod", 4, 1},
+		{"if modified since", "/lastmod", 0, "v2", "lastmod", 5, 2},
+		{"no-store", "/nostore", 0, "v2", "nostore", 6, 2},
+		{"no-store again", "/nostore", 0, "v2", "nostore", 7, 2},
+	}
+
+	for _, step := range steps {
+		now = now.Add(step.advance)
+
+		site.mu.Lock()
+		site.version = step.version
+		site.mu.Unlock()
+
+		body, _, err := cache.Fetch(site.URL + step.path)
+		if err != nil || body != step.body {
+			t.Fatalf("%s: Fetch() = %q, %v, want %q", step.name, body, err, step.body)
+		}
+
+		if requests, notModified := site.counts(); requests != step.requests || notModified != step.notModified {
+			t.Errorf("%s: server saw %d requests and sent %d 304s, want %d and %d",
+				step.name, requests, notModified, step.requests, step.notModified)
+		}
+	}
+
+	want := CacheStats{Hits: 2, Revalidated: 2, Misses: 5}
+
+	if got := cache.Stats(); got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+}
+
+func TestFreshUntil(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	date := now.Add(-time.Hour).Format(http.TimeFormat)
+
+	tests := []struct {
+		header http.Header
+		want   time.Duration
+	}{
+		{http.Header{}, 0},
+		{http.Header{"Cache-Control": {"public, max-age=300"}}, 5 * time.Minute},
+		{http.Header{"Cache-Control": {"max-age=300"}, "Age": {"100"}}, 200 * time.Second},
+		{http.Header{"Cache-Control": {"max-age=300, no-cache"}}, 0},
+		{http.Header{"Cache-Control": {"max-age=soon"}}, 0},
+		{http.Header{"Date": {date}, "Expires": {now.Format(http.TimeFormat)}}, time.Hour},
+		{http.Header{"Expires": {"0"}}, 0},
+	}
+
+	for _, tt := range tests {
+		got := freshUntil(tt.header, cacheControl(tt.header), now).Sub(now)
+
+		if got != tt.want {
+			t.Errorf("freshUntil(%v) = now + %v, want now + %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{&StatusError{StatusCode: http.StatusServiceUnavailable}, true},
+		{&StatusError{StatusCode: http.StatusTooManyRequests}, true},
+		{&StatusError{StatusCode: http.StatusForbidden}, false},
+		{fmt.Errorf("%w: x", ErrNotFound), false},
+		{context.DeadlineExceeded, true},
+		{fmt.Errorf("%w: x", ErrInjected), true},
+		{fmt.Errorf("%w: x", ErrCircuitOpen), false},
+		{&ContentTypeError{ContentType: "image/png"}, false},
+		{errors.New("boom"), false},
+	}
+
+	for _, tt := range tests {
+		if got := IsTransient(tt.err); got != tt.want {
+			t.Errorf("IsTransient(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+// flakyFetcher fails the first failures fetches with err.
+func flakyFetcher(failures int, err error) (Fetcher, *int) {
+	calls := 0
+
+	return FetcherFunc(func(url string) (string, []string, error) {
+		calls++
+
+		if calls <= failures {
+			return "", nil, err
+		}
+
+		return "ok", nil, nil
+	}), &calls
+}
+
+func TestRetryFetcher(t *testing.T) {
+	unavailable := &StatusError{URL: "u", StatusCode: http.StatusServiceUnavailable}
+
+	tests := []struct {
+		name     string
+		failures int
+		err      error
+		calls    int
+		wantErr  bool
+	}{
+		{"recovers", 2, unavailable, 3, false},
+		{"gives up", 5, unavailable, 4, true},
+		{"not transient", 5, fmt.Errorf("%w: u", ErrNotFound), 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inner, calls := flakyFetcher(tt.failures, tt.err)
+
+			var delays []time.Duration
+
+			f := NewRetryFetcher(inner, 4)
+			f.BaseDelay = 100 * time.Millisecond
+			f.MaxDelay = 300 * time.Millisecond
+			f.Sleep = func(d time.Duration) { delays = append(delays, d) }
+
+			_, _, err := f.Fetch("u")
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Fetch() error = %v, want error %v", err, tt.wantErr)
+			}
+
+			if *calls != tt.calls {
+				t.Errorf("Fetch() tried %d times, want %d", *calls, tt.calls)
+			}
+
+			// Every wait is between half and all of the capped exponential delay.
+			for i, d := range delays {
+				full := min(f.BaseDelay<<i, f.MaxDelay)
+
+				if d < full/2 || d > full {
+					t.Errorf("delay %d = %v, want between %v and %v", i, d, full/2, full)
+				}
+			}
+		})
+	}
+}
+
+func TestBreakerFetcher(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	var mu sync.Mutex
+	down := map[string]bool{"bad.example": true}
+	calls := make(map[string]int)
+
+	inner := FetcherFunc(func(url string) (string, []string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		host := hostOf(url)
+		calls[host]++
+
+		if strings.HasSuffix(url, "/missing") {
+			return "", nil, fmt.Errorf("%w: %s", ErrNotFound, url)
+		}
+
+		if down[host] {
+			return "", nil, &StatusError{URL: url, StatusCode: http.StatusBadGateway}
+		}
+
+		return "ok", nil, nil
+	})
+
+	f := NewBreakerFetcher(inner, 3, time.Minute)
+	f.Now = func() time.Time { return now }
+
+	fetch := func(url string) error {
+		_, _, err := f.Fetch(url)
+		return err
+	}
+
+	for range 3 {
+		if err := fetch("https://bad.example/"); errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("circuit opened before the threshold")
+		}
+	}
+
+	if err := fetch("https://bad.example/"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Fetch() error = %v after 3 failures, want ErrCircuitOpen", err)
+	}
+
+	if calls["bad.example"] != 3 {
+		t.Errorf("open circuit still fetched: %d calls, want 3", calls["bad.example"])
+	}
+
+	// Other hosts and missing pages do not trip anything.
+	for range 5 {
+		if err := fetch("https://good.example/missing"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("Fetch(good) error = %v, want ErrNotFound", err)
+		}
+	}
+
+	if err := fetch("https://good.example/"); err != nil {
+		t.Errorf("Fetch(good) error = %v", err)
+	}
+
+	// After the cooldown a failing probe opens the circuit again.
+	now = now.Add(time.Minute)
+
+	if err := fetch("https://bad.example/"); errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("probe after cooldown was not let through")
+	}
+
+	if err := fetch("https://bad.example/"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Fetch() error = %v after a failed probe, want ErrCircuitOpen", err)
+	}
+
+	// A successful probe closes it.
+	now = now.Add(time.Minute)
+
+	mu.Lock()
+	down["bad.example"] = false
+	mu.Unlock()
+
+	for range 3 {
+		if err := fetch("https://bad.example/"); err != nil {
+			t.Fatalf("Fetch() error = %v after the host recovered", err)
+		}
+	}
+}
+
+func TestBreakerFetcherStaleFetch(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	inner := FetcherFunc(func(url string) (string, []string, error) {
+		if strings.HasSuffix(url, "/slow") {
+			close(started)
+			<-release
+
+			return "ok", nil, nil
+		}
+
+		return "", nil, &StatusError{URL: url, StatusCode: http.StatusBadGateway}
+	})
+
+	f := NewBreakerFetcher(inner, 2, time.Minute)
+	f.Now = func() time.Time { return now }
+
+	done := make(chan error)
+
+	go func() {
+		_, _, err := f.Fetch("https://bad.example/slow")
+		done <- err
+	}()
+
+	<-started
+
+	for range 2 {
+		_, _, _ = f.Fetch("https://bad.example/")
+	}
+
+	// The slow fetch started before the circuit opened, so its success
+	// must not close it.
+	close(release)
+
+	if err := <-done; err != nil {
+		t.Fatalf("slow Fetch() error = %v", err)
+	}
+
+	if _, _, err := f.Fetch("https://bad.example/"); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Fetch() error = %v after a stale success, want ErrCircuitOpen", err)
+	}
+}
+
+func TestLoggingFetcher(t *testing.T) {
+	var buf bytes.Buffer
+
+	f := NewLoggingFetcher(fetcher, slog.New(slog.NewJSONHandler(&buf, nil)))
+
+	_, _, _ = f.Fetch("https://golang.org/")
+	_, _, _ = f.Fetch("https://golang.org/cmd/")
+
+	var entries []map[string]any
+
+	for line := range strings.Lines(buf.String()) {
+		var entry map[string]any
+
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("log line %q: %v", line, err)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	if len(entries) != 2 {
+		t.Fatalf("got %d log entries, want 2:\n%s", len(entries), buf.String())
+	}
+
+	ok, failed := entries[0], entries[1]
+
+	if ok["level"] != "INFO" || ok["url"] != "https://golang.org/" || ok["status"] != float64(200) || ok["links"] != float64(2) {
+		t.Errorf("success entry = %v", ok)
+	}
+
+	if failed["level"] != "WARN" || failed["class"] != string(ErrorNotFound) || failed["error"] == nil {
+		t.Errorf("failure entry = %v", failed)
+	}
+}
+
+// permutations returns every ordering of names.
+func permutations(names []string) [][]string {
+	if len(names) <= 1 {
+		return [][]string{slices.Clone(names)}
+	}
+
+	var out [][]string
+
+	for i, name := range names {
+		rest := slices.Concat(names[:i], names[i+1:])
+
+		for _, p := range permutations(rest) {
+			out = append(out, append([]string{name}, p...))
+		}
+	}
+
+	return out
+}
+
+func TestMiddlewareStacksInAnyOrder(t *testing.T) {
+	middlewares := map[string]Middleware{
+		"cache":   WithCache(),
+		"retry":   func(f Fetcher) Fetcher { r := NewRetryFetcher(f, 3); r.Sleep = func(time.Duration) {}; return r },
+		"breaker": WithBreaker(5, time.Minute),
+		"log":     WithLogging(slog.New(slog.DiscardHandler)),
+	}
+
+	for _, order := range permutations([]string{"cache", "retry", "breaker", "log"}) {
+		t.Run(strings.Join(order, ","), func(t *testing.T) {
+			var mu sync.Mutex
+			requests, conditional := 0, 0
+
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+
+				requests++
+
+				// The first request fails, so it has to be retried.
+				if requests == 1 {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+
+				w.Header().Set("ETag", `"v1"`)
+				w.Header().Set("Cache-Control", "no-cache")
+
+				if r.Header.Get("If-None-Match") == `"v1"` {
+					conditional++
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+
+				w.Header().Set("Content-Type", "text/plain")
+				fmt.Fprint(w, "hello")
+			}))
+			defer ts.Close()
+
+			var chain []Middleware
+
+			for _, name := range order {
+				chain = append(chain, middlewares[name])
+			}
+
+			f := Chain(NewHTTPFetcher(), chain...)
+
+			for i := range 2 {
+				body, _, err := f.Fetch(ts.URL)
+				if err != nil || body != "hello" {
+					t.Fatalf("fetch %d = %q, %v, want hello", i, body, err)
+				}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if requests != 3 || conditional != 1 {
+				t.Errorf("server saw %d requests, %d conditional, want 3 and 1", requests, conditional)
+			}
+		})
+	}
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Query is a parsed search query.
+//
+// Words must all appear on a page unless joined by OR. AND, OR and NOT are
+// operators when written in capitals, and NOT binds tighter than AND, which
+// binds tighter than OR. A leading minus negates a word, phrase or group.
+// Double quotes match a phrase, with its words next to each other in order,
+// and parentheses group.
+type Query struct {
+	root queryNode
+
+	// terms are the words that are not negated, used for ranking.
+	terms []string
+}
+
+// ParseQuery parses a search query.
+func ParseQuery(s string) (*Query, error) {
+	tokens, err := lexQuery(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(tokens) == 0 {
+		return nil, errors.New("query: empty query")
+	}
+
+	p := &queryParser{tokens: tokens}
+
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("query: unexpected %q", p.tokens[p.pos].text)
+	}
+
+	q := &Query{root: root}
+	root.collectTerms(&q.terms, false)
+
+	return q, nil
+}
+
+// queryNode is a node of a parsed query. eval returns the documents it
+// matches. The caller holds the index's read lock.
+type queryNode interface {
+	eval(ix *Index) map[int]bool
+	collectTerms(terms *[]string, negated bool)
+}
+
+type termNode struct {
+	term string
+}
+
+func (n termNode) eval(ix *Index) map[int]bool {
+	docs := make(map[int]bool)
+
+	for _, p := range ix.postings[n.term] {
+		docs[p.Doc] = true
+	}
+
+	return docs
+}
+
+func (n termNode) collectTerms(terms *[]string, negated bool) {
+	if !negated {
+		*terms = append(*terms, n.term)
+	}
+}
+
+type phraseNode struct {
+	terms []string
+}
+
+func (n phraseNode) eval(ix *Index) map[int]bool {
+	docs := termNode{n.terms[0]}.eval(ix)
+
+	for id := range docs {
+		if !n.matches(ix, id) {
+			delete(docs, id)
+		}
+	}
+
+	return docs
+}
+
+// matches reports whether the phrase appears in document id.
+func (n phraseNode) matches(ix *Index, id int) bool {
+	next := make(map[int]bool)
+
+	for i, term := range n.terms {
+		p, ok := ix.posting(term, id)
+		if !ok {
+			return false
+		}
+
+		// next holds the positions where the phrase could continue.
+		found := make(map[int]bool)
+
+		for _, pos := range p.Positions {
+			if i == 0 || next[pos] {
+				found[pos+1] = true
+			}
+		}
+
+		if len(found) == 0 {
+			return false
+		}
+
+		next = found
+	}
+
+	return true
+}
+
+func (n phraseNode) collectTerms(terms *[]string, negated bool) {
+	if !negated {
+		*terms = append(*terms, n.terms...)
+	}
+}
+
+type andNode struct {
+	left, right queryNode
+}
+
+func (n andNode) eval(ix *Index) map[int]bool {
+	left, right := n.left.eval(ix), n.right.eval(ix)
+
+	for id := range left {
+		if !right[id] {
+			delete(left, id)
+		}
+	}
+
+	return left
+}
+
+func (n andNode) collectTerms(terms *[]string, negated bool) {
+	n.left.collectTerms(terms, negated)
+	n.right.collectTerms(terms, negated)
+}
+
+type orNode struct {
+	left, right queryNode
+}
+
+func (n orNode) eval(ix *Index) map[int]bool {
+	left := n.left.eval(ix)
+
+	for id := range n.right.eval(ix) {
+		left[id] = true
+	}
+
+	return left
+}
+
+func (n orNode) collectTerms(terms *[]string, negated bool) {
+	n.left.collectTerms(terms, negated)
+	n.right.collectTerms(terms, negated)
+}
+
+type notNode struct {
+	x queryNode
+}
+
+func (n notNode) eval(ix *Index) map[int]bool {
+	excluded := n.x.eval(ix)
+	docs := make(map[int]bool)
+
+	for id := range ix.docs {
+		if !excluded[id] {
+			docs[id] = true
+		}
+	}
+
+	return docs
+}
+
+func (n notNode) collectTerms(terms *[]string, negated bool) {
+	n.x.collectTerms(terms, !negated)
+}
+
+type queryTokenKind int
+
+const (
+	tokenWord queryTokenKind = iota
+	tokenPhrase
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenOpen
+	tokenClose
+)
+
+type queryToken struct {
+	kind queryTokenKind
+	text string
+}
+
+func lexQuery(s string) ([]queryToken, error) {
+	var tokens []queryToken
+
+	for i := 0; i < len(s); {
+		c := s[i]
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+
+		case c == '(':
+			tokens = append(tokens, queryToken{tokenOpen, "("})
+			i++
+
+		case c == ')':
+			tokens = append(tokens, queryToken{tokenClose, ")"})
+			i++
+
+		case c == '-':
+			tokens = append(tokens, queryToken{tokenNot, "-"})
+			i++
+
+		case c == '"':
+			end := strings.IndexByte(s[i+1:], '"')
+			if end < 0 {
+				return nil, errors.New("query: unterminated phrase")
+			}
+
+			tokens = append(tokens, queryToken{tokenPhrase, s[i+1 : i+1+end]})
+			i += end + 2
+
+		default:
+			end := strings.IndexFunc(s[i:], func(r rune) bool {
+				return unicode.IsSpace(r) || r == '(' || r == ')' || r == '"'
+			})
+			if end < 0 {
+				end = len(s) - i
+			}
+
+			word := s[i : i+end]
+			i += end
+
+			switch word {
+			case "AND":
+				tokens = append(tokens, queryToken{tokenAnd, word})
+			case "OR":
+				tokens = append(tokens, queryToken{tokenOr, word})
+			case "NOT":
+				tokens = append(tokens, queryToken{tokenNot, word})
+			default:
+				tokens = append(tokens, queryToken{tokenWord, word})
+			}
+		}
+	}
+
+	return tokens, nil
+}
+
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+}
+
+func (p *queryParser) peek() (queryToken, bool) {
+	if p.pos >= len(p.tokens) {
+		return queryToken{}, false
+	}
+
+	return p.tokens[p.pos], true
+}
+
+func (p *queryParser) parseOr() (queryNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		tok, ok := p.peek()
+		if !ok || tok.kind != tokenOr {
+			return left, nil
+		}
+
+		p.pos++
+
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+
+		left = orNode{left, right}
+	}
+}
+
+func (p *queryParser) parseAnd() (queryNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		tok, ok := p.peek()
+		if !ok || tok.kind == tokenOr || tok.kind == tokenClose {
+			return left, nil
+		}
+
+		// AND is optional between two operands.
+		if tok.kind == tokenAnd {
+			p.pos++
+		}
+
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		left = andNode{left, right}
+	}
+}
+
+func (p *queryParser) parseUnary() (queryNode, error) {
+	tok, ok := p.peek()
+	if !ok {
+		return nil, errors.New("query: unexpected end of query")
+	}
+
+	switch tok.kind {
+	case tokenNot:
+		p.pos++
+
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		return notNode{x}, nil
+
+	case tokenOpen:
+		p.pos++
+
+		x, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		if tok, ok := p.peek(); !ok || tok.kind != tokenClose {
+			return nil, errors.New("query: missing )")
+		}
+
+		p.pos++
+
+		return x, nil
+
+	case tokenWord, tokenPhrase:
+		p.pos++
+
+		// A word such as net/http holds several index words, and matches
+		// them as a phrase.
+		terms := Tokenize(tok.text)
+
+		switch len(terms) {
+		case 0:
+			return nil, fmt.Errorf("query: %q has no words to search for", tok.text)
+		case 1:
+			return termNode{terms[0]}, nil
+		default:
+			return phraseNode{terms}, nil
+		}
+
+	default:
+		return nil, fmt.Errorf("query: unexpected %q", tok.text)
+	}
+}
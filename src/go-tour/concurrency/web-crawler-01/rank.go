@@ -0,0 +1,401 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+// LinkAnalysis ranks the pages of a LinkGraph by the links between them.
+// Links from a page to itself are ignored.
+type LinkAnalysis struct {
+	// Damping is the chance that a PageRank surfer follows a link instead of
+	// jumping to a random page.
+	Damping float64
+
+	// Tolerance stops PageRank and HITS once the scores change by less than
+	// this in total between two iterations.
+	Tolerance float64
+
+	// MaxIterations stops PageRank and HITS if they have not converged.
+	MaxIterations int
+}
+
+// NewLinkAnalysis returns a LinkAnalysis with the usual damping of 0.85.
+func NewLinkAnalysis() *LinkAnalysis {
+	return &LinkAnalysis{
+		Damping:       0.85,
+		Tolerance:     1e-6,
+		MaxIterations: 100,
+	}
+}
+
+// adjacency numbers the nodes of g in order and lists the distinct links
+// out of and into each of them.
+func adjacency(g *LinkGraph) (out, in [][]int) {
+	ids := make(map[string]int, len(g.Nodes))
+
+	for i, n := range g.Nodes {
+		ids[n.URL] = i
+	}
+
+	out = make([][]int, len(g.Nodes))
+	in = make([][]int, len(g.Nodes))
+
+	// Edges are sorted and distinct, so there is no need to dedupe.
+	for _, e := range g.Edges {
+		from, to := ids[e.From], ids[e.To]
+
+		if from != to {
+			out[from] = append(out[from], to)
+			in[to] = append(in[to], from)
+		}
+	}
+
+	return out, in
+}
+
+// PageRank returns the PageRank of every node of g, in the order of
+// g.Nodes, and the number of iterations it took. The ranks add up to 1.
+// Pages without links, such as unvisited ones, spread their rank evenly
+// over every page.
+func (a *LinkAnalysis) PageRank(g *LinkGraph) ([]float64, int) {
+	n := len(g.Nodes)
+	if n == 0 {
+		return nil, 0
+	}
+
+	out, _ := adjacency(g)
+
+	rank := make([]float64, n)
+	next := make([]float64, n)
+
+	for i := range rank {
+		rank[i] = 1 / float64(n)
+	}
+
+	iterations := 0
+
+	for iterations < a.MaxIterations {
+		iterations++
+
+		var dangling float64
+
+		for i, links := range out {
+			if len(links) == 0 {
+				dangling += rank[i]
+			}
+		}
+
+		base := (1-a.Damping)/float64(n) + a.Damping*dangling/float64(n)
+
+		for i := range next {
+			next[i] = base
+		}
+
+		for i, links := range out {
+			for _, j := range links {
+				next[j] += a.Damping * rank[i] / float64(len(links))
+			}
+		}
+
+		delta := l1Distance(rank, next)
+		rank, next = next, rank
+
+		if delta < a.Tolerance {
+			break
+		}
+	}
+
+	return rank, iterations
+}
+
+// HITS returns the hub and authority scores of every node of g, in the
+// order of g.Nodes, and the number of iterations it took. A good hub links
+// to many good authorities, and a good authority is linked from many good
+// hubs. Both score vectors have unit length.
+func (a *LinkAnalysis) HITS(g *LinkGraph) (hubs, authorities []float64, iterations int) {
+	n := len(g.Nodes)
+	out, in := adjacency(g)
+
+	hubs = make([]float64, n)
+	authorities = make([]float64, n)
+
+	for i := range hubs {
+		hubs[i] = 1
+	}
+
+	for iterations < a.MaxIterations {
+		iterations++
+
+		nextAuth := make([]float64, n)
+		nextHubs := make([]float64, n)
+
+		for j, from := range in {
+			for _, i := range from {
+				nextAuth[j] += hubs[i]
+			}
+		}
+
+		normalize(nextAuth)
+
+		for i, to := range out {
+			for _, j := range to {
+				nextHubs[i] += nextAuth[j]
+			}
+		}
+
+		normalize(nextHubs)
+
+		delta := l1Distance(hubs, nextHubs) + l1Distance(authorities, nextAuth)
+		hubs, authorities = nextHubs, nextAuth
+
+		if delta < a.Tolerance {
+			break
+		}
+	}
+
+	return hubs, authorities, iterations
+}
+
+func l1Distance(a, b []float64) float64 {
+	var d float64
+
+	for i := range a {
+		d += math.Abs(a[i] - b[i])
+	}
+
+	return d
+}
+
+// normalize scales v to unit length, leaving a zero vector alone.
+func normalize(v []float64) {
+	var sum float64
+
+	for _, x := range v {
+		sum += x * x
+	}
+
+	if sum == 0 {
+		return
+	}
+
+	norm := math.Sqrt(sum)
+
+	for i := range v {
+		v[i] /= norm
+	}
+}
+
+// StronglyConnectedComponents returns the groups of pages of g that can all
+// reach each other by following links, using Tarjan's algorithm. Each
+// component is sorted by URL, and the components are sorted from largest to
+// smallest.
+func StronglyConnectedComponents(g *LinkGraph) [][]string {
+	out, _ := adjacency(g)
+
+	t := &tarjan{
+		out:     out,
+		index:   make([]int, len(out)),
+		low:     make([]int, len(out)),
+		onStack: make([]bool, len(out)),
+	}
+
+	for i := range t.index {
+		t.index[i] = -1
+	}
+
+	for i := range out {
+		if t.index[i] < 0 {
+			t.connect(i)
+		}
+	}
+
+	components := make([][]string, 0, len(t.components))
+
+	for _, ids := range t.components {
+		urls := make([]string, 0, len(ids))
+
+		for _, id := range ids {
+			urls = append(urls, g.Nodes[id].URL)
+		}
+
+		slices.Sort(urls)
+		components = append(components, urls)
+	}
+
+	slices.SortFunc(components, func(a, b []string) int {
+		return cmp.Or(cmp.Compare(len(b), len(a)), strings.Compare(a[0], b[0]))
+	})
+
+	return components
+}
+
+type tarjan struct {
+	out        [][]int
+	index      []int
+	low        []int
+	onStack    []bool
+	stack      []int
+	next       int
+	components [][]int
+}
+
+func (t *tarjan) connect(v int) {
+	t.index[v] = t.next
+	t.low[v] = t.next
+	t.next++
+
+	t.stack = append(t.stack, v)
+	t.onStack[v] = true
+
+	for _, w := range t.out[v] {
+		switch {
+		case t.index[w] < 0:
+			t.connect(w)
+			t.low[v] = min(t.low[v], t.low[w])
+		case t.onStack[w]:
+			t.low[v] = min(t.low[v], t.index[w])
+		}
+	}
+
+	if t.low[v] != t.index[v] {
+		return
+	}
+
+	// v is the root of a component: everything above it on the stack.
+	var component []int
+
+	for {
+		w := t.stack[len(t.stack)-1]
+		t.stack = t.stack[:len(t.stack)-1]
+		t.onStack[w] = false
+
+		component = append(component, w)
+
+		if w == v {
+			break
+		}
+	}
+
+	t.components = append(t.components, component)
+}
+
+// PageMetrics are the link metrics of one page.
+type PageMetrics struct {
+	URL       string     `json:"url"`
+	Title     string     `json:"title,omitempty"`
+	Status    PageStatus `json:"status"`
+	PageRank  float64    `json:"pagerank"`
+	Hub       float64    `json:"hub"`
+	Authority float64    `json:"authority"`
+	InDegree  int        `json:"in_degree"`
+	OutDegree int        `json:"out_degree"`
+
+	// Component is the index of the page's strongly connected component.
+	Component int `json:"component"`
+}
+
+// LinkMetrics is a ranked report of the pages of a LinkGraph.
+type LinkMetrics struct {
+	// Pages are sorted by PageRank, highest first.
+	Pages []PageMetrics `json:"pages"`
+
+	Components         [][]string `json:"components"`
+	PageRankIterations int        `json:"pagerank_iterations"`
+	HITSIterations     int        `json:"hits_iterations"`
+}
+
+// Analyze computes every metric for the pages of g.
+func (a *LinkAnalysis) Analyze(g *LinkGraph) *LinkMetrics {
+	out, in := adjacency(g)
+	ranks, rankIterations := a.PageRank(g)
+	hubs, authorities, hitsIterations := a.HITS(g)
+	components := StronglyConnectedComponents(g)
+
+	componentOf := make(map[string]int)
+
+	for i, urls := range components {
+		for _, url := range urls {
+			componentOf[url] = i
+		}
+	}
+
+	m := &LinkMetrics{
+		Pages:              make([]PageMetrics, 0, len(g.Nodes)),
+		Components:         components,
+		PageRankIterations: rankIterations,
+		HITSIterations:     hitsIterations,
+	}
+
+	for i, n := range g.Nodes {
+		m.Pages = append(m.Pages, PageMetrics{
+			URL:       n.URL,
+			Title:     n.Title,
+			Status:    n.Status,
+			PageRank:  ranks[i],
+			Hub:       hubs[i],
+			Authority: authorities[i],
+			InDegree:  len(in[i]),
+			OutDegree: len(out[i]),
+			Component: componentOf[n.URL],
+		})
+	}
+
+	slices.SortStableFunc(m.Pages, func(a, b PageMetrics) int {
+		return cmp.Compare(b.PageRank, a.PageRank)
+	})
+
+	return m
+}
+
+// WriteText writes the top limit pages as a table, followed by the
+// components with more than one page. A limit of zero or less writes every page.
+func (m *LinkMetrics) WriteText(w io.Writer, limit int) error {
+	pages := m.Pages
+
+	if limit > 0 && len(pages) > limit {
+		pages = pages[:limit]
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+
+	fmt.Fprintln(tw, "rank\tpagerank\tauthority\thub\tin\tout\tscc\t\turl")
+
+	for i, p := range pages {
+		fmt.Fprintf(tw, "%d\t%.4f\t%.4f\t%.4f\t%d\t%d\t%d\t\t%s\n",
+			i+1, p.PageRank, p.Authority, p.Hub, p.InDegree, p.OutDegree, p.Component+1, p.URL)
+	}
+
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	var b strings.Builder
+
+	for i, c := range m.Components {
+		if len(c) > 1 {
+			fmt.Fprintf(&b, "scc %d: %s\n", i+1, strings.Join(c, " "))
+		}
+	}
+
+	fmt.Fprintf(&b, "%d pages, %d strongly connected components, pagerank converged in %d iterations\n",
+		len(m.Pages), len(m.Components), m.PageRankIterations)
+
+	_, err := io.WriteString(w, b.String())
+
+	return err
+}
+
+// WriteJSON writes the whole report as JSON.
+func (m *LinkMetrics) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(m)
+}
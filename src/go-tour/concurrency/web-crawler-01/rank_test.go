@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"slices"
+	"testing"
+)
+
+// testGraph builds a LinkGraph from an adjacency list of crawled pages.
+func testGraph(links map[string][]string) *LinkGraph {
+	result := &CrawlResult{}
+
+	for url, to := range links {
+		result.Pages = append(result.Pages, PageResult{URL: url, Status: PageOK, Links: to})
+	}
+
+	return NewLinkGraph(result, NewCanonicalizer())
+}
+
+func scoresByURL(g *LinkGraph, scores []float64) map[string]float64 {
+	m := make(map[string]float64)
+
+	for i, n := range g.Nodes {
+		m[n.URL] = scores[i]
+	}
+
+	return m
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
+
+func TestPageRank(t *testing.T) {
+	a := NewLinkAnalysis()
+
+	t.Run("cycle", func(t *testing.T) {
+		g := testGraph(map[string][]string{"a": {"b"}, "b": {"c"}, "c": {"a"}})
+		ranks, _ := a.PageRank(g)
+
+		for i, r := range ranks {
+			if !near(r, 1.0/3) {
+				t.Errorf("rank of %s = %v, want 1/3", g.Nodes[i].URL, r)
+			}
+		}
+	})
+
+	t.Run("star", func(t *testing.T) {
+		// Every page links to hub, which links back to a only. Self links
+		// and a dangling page must not leak rank.
+		g := testGraph(map[string][]string{
+			"a":   {"hub", "a"},
+			"b":   {"hub"},
+			"c":   {"hub"},
+			"hub": {"a"},
+			"d":   nil,
+		})
+
+		ranks, iterations := a.PageRank(g)
+		byURL := scoresByURL(g, ranks)
+
+		var sum float64
+
+		for _, r := range ranks {
+			sum += r
+		}
+
+		if !near(sum, 1) {
+			t.Errorf("ranks add up to %v, want 1", sum)
+		}
+
+		if byURL["hub"] <= byURL["a"] || byURL["a"] <= byURL["b"] || !near(byURL["b"], byURL["c"]) {
+			t.Errorf("ranks = %v, want hub > a > b = c", byURL)
+		}
+
+		if iterations >= a.MaxIterations {
+			t.Errorf("PageRank() did not converge in %d iterations", iterations)
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		if ranks, _ := a.PageRank(&LinkGraph{}); len(ranks) != 0 {
+			t.Errorf("PageRank() = %v, want nothing", ranks)
+		}
+	})
+}
+
+func TestHITS(t *testing.T) {
+	// Two directories link to the same three docs, and one of them also
+	// links to a fourth.
+	g := testGraph(map[string][]string{
+		"dir1": {"doc1", "doc2", "doc3"},
+		"dir2": {"doc1", "doc2", "doc3", "doc4"},
+	})
+
+	hubs, authorities, _ := NewLinkAnalysis().HITS(g)
+	hub, auth := scoresByURL(g, hubs), scoresByURL(g, authorities)
+
+	if hub["dir2"] <= hub["dir1"] || hub["doc1"] != 0 {
+		t.Errorf("hubs = %v, want dir2 > dir1 and docs at 0", hub)
+	}
+
+	if !near(auth["doc1"], auth["doc3"]) || auth["doc1"] <= auth["doc4"] || auth["dir1"] != 0 {
+		t.Errorf("authorities = %v, want doc1 = doc3 > doc4 and dirs at 0", auth)
+	}
+
+	var norm float64
+
+	for _, a := range authorities {
+		norm += a * a
+	}
+
+	if !near(norm, 1) {
+		t.Errorf("authorities have squared length %v, want 1", norm)
+	}
+}
+
+func TestStronglyConnectedComponents(t *testing.T) {
+	g := testGraph(map[string][]string{
+		"a": {"b"},
+		"b": {"c", "d"},
+		"c": {"a"},
+		"d": {"e"},
+		"e": {"d", "f"},
+		"f": nil,
+	})
+
+	got := StronglyConnectedComponents(g)
+	want := [][]string{{"a", "b", "c"}, {"d", "e"}, {"f"}}
+
+	if !slices.EqualFunc(got, want, slices.Equal) {
+		t.Errorf("StronglyConnectedComponents() = %q, want %q", got, want)
+	}
+}
+
+func TestLinkMetrics(t *testing.T) {
+	m := NewLinkAnalysis().Analyze(fakeGraph(t))
+
+	if m.Pages[0].URL != "https://golang.org/pkg/" {
+		t.Errorf("top page = %s, want /pkg/", m.Pages[0].URL)
+	}
+
+	for _, p := range m.Pages {
+		if p.URL == "https://golang.org/" && (p.InDegree != 3 || p.OutDegree != 2) {
+			t.Errorf("degrees of / = in %d, out %d, want 3 and 2", p.InDegree, p.OutDegree)
+		}
+	}
+
+	var b bytes.Buffer
+
+	if err := m.WriteText(&b, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	checkGolden(t, "rank.txt", b.Bytes())
+}
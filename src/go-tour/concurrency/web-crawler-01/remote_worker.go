@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/rpc"
+	"sync"
+	"time"
+)
+
+// RemoteWorker fetches pages for a Coordinator in another process.
+type RemoteWorker struct {
+	// Crawler fetches the leased pages, applying its robots.txt policy and
+	// host limiter. Its Workers is the number of pages leased at a time.
+	Crawler *Crawler
+
+	// Name identifies the worker in the coordinator's worker IDs.
+	Name string
+
+	// PollInterval is how long to wait before asking again when the
+	// coordinator has no pages to hand out.
+	PollInterval time.Duration
+}
+
+// NewRemoteWorker returns a RemoteWorker that fetches with fetcher.
+func NewRemoteWorker(fetcher Fetcher) *RemoteWorker {
+	return &RemoteWorker{
+		Crawler:      NewCrawler(fetcher),
+		Name:         "worker",
+		PollInterval: 100 * time.Millisecond,
+	}
+}
+
+// Run connects to the coordinator at addr and fetches the pages it hands
+// out until the crawl is over or ctx is done. When ctx ends, pages being
+// fetched are not reported, and their leases run out on the coordinator.
+func (w *RemoteWorker) Run(ctx context.Context, addr string) error {
+	client, err := rpc.Dial("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	var reg RegisterReply
+
+	if err := client.Call("Coordinator.Register", &RegisterArgs{Name: w.Name}, &reg); err != nil {
+		return err
+	}
+
+	heartbeatCtx, stopHeartbeat := context.WithCancel(ctx)
+	defer stopHeartbeat()
+
+	go heartbeat(heartbeatCtx, client, reg)
+
+	w.Crawler.prepare()
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var lease LeaseReply
+
+		args := &LeaseArgs{WorkerID: reg.WorkerID, Max: max(w.Crawler.Workers, 1)}
+
+		if err := client.Call("Coordinator.Lease", args, &lease); err != nil {
+			return err
+		}
+
+		if lease.Done {
+			return nil
+		}
+
+		if len(lease.Tasks) == 0 {
+			select {
+			case <-time.After(w.PollInterval):
+			case <-ctx.Done():
+			}
+
+			continue
+		}
+
+		if err := w.fetchAll(ctx, client, reg.WorkerID, lease.Tasks); err != nil {
+			return err
+		}
+	}
+}
+
+// fetchAll fetches tasks in parallel and reports each page as it finishes.
+func (w *RemoteWorker) fetchAll(ctx context.Context, client *rpc.Client, id string, tasks []FrontierItem) error {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var errs []error
+
+	for _, item := range tasks {
+		wg.Go(func() {
+			page := w.Crawler.fetch(ctx, crawlTask{url: item.URL, depth: item.Depth, referrer: item.Referrer})
+
+			if ctx.Err() != nil {
+				return
+			}
+
+			args := &ReportArgs{WorkerID: id, Page: newRemotePage(page)}
+
+			if err := client.Call("Coordinator.Report", args, &ReportReply{}); err != nil {
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+			}
+		})
+	}
+
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// heartbeat tells the coordinator the worker is alive until ctx is done.
+func heartbeat(ctx context.Context, client *rpc.Client, reg RegisterReply) {
+	ticker := time.NewTicker(reg.HeartbeatEvery)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			// A failed heartbeat shows up as a failed call in Run.
+			_ = client.Call("Coordinator.Heartbeat", &HeartbeatArgs{WorkerID: reg.WorkerID}, &HeartbeatReply{})
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ErrInjected is returned by a ReplayFetcher for failures it was told to inject.
+var ErrInjected = errors.New("injected failure")
+
+// Record is one recorded fetch.
+type Record struct {
+	URL        string      `json:"url"`
+	StatusCode int         `json:"status,omitempty"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+	Links      []string    `json:"links,omitempty"`
+
+	// Error is set for fetches that failed without a status code, such as
+	// DNS errors and timeouts.
+	Error string `json:"error,omitempty"`
+}
+
+// Fixture is a set of recorded fetches that can be replayed offline.
+type Fixture struct {
+	Records []Record `json:"records"`
+}
+
+// LoadFixture reads a fixture file written by Fixture.Save.
+func LoadFixture(path string) (*Fixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var fx Fixture
+
+	if err := json.Unmarshal(data, &fx); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return &fx, nil
+}
+
+// Save writes the fixture to path as indented JSON.
+func (fx *Fixture) Save(path string) error {
+	data, err := json.MarshalIndent(fx, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// RecordingFetcher is a Fetcher that records every fetch of the Fetcher it
+// wraps. Status codes and headers are only captured when that Fetcher is a
+// ResponseFetcher.
+type RecordingFetcher struct {
+	Fetcher Fetcher
+
+	mu      sync.Mutex
+	records map[string]Record
+}
+
+// NewRecordingFetcher returns a RecordingFetcher that records fetcher.
+func NewRecordingFetcher(fetcher Fetcher) *RecordingFetcher {
+	return &RecordingFetcher{
+		Fetcher: fetcher,
+		records: make(map[string]Record),
+	}
+}
+
+func (r *RecordingFetcher) Fetch(url string) (string, []string, error) {
+	return bodyAndLinks(r.FetchResponse(context.Background(), url))
+}
+
+func (r *RecordingFetcher) FetchResponse(ctx context.Context, url string) (*Response, error) {
+	resp, err := fetchResponse(ctx, r.Fetcher, url)
+
+	rec := Record{URL: url}
+
+	if resp != nil {
+		rec.StatusCode = resp.StatusCode
+		rec.Header = resp.Header
+		rec.Body = resp.Body
+		rec.Links = resp.Links
+	}
+
+	if err != nil {
+		rec.StatusCode = errorStatus(err, rec.StatusCode)
+		rec.Body = ""
+		rec.Links = nil
+
+		// The status code is enough to rebuild not found and bad status errors.
+		if rec.StatusCode == 0 || statusError(url, rec.StatusCode) == nil {
+			rec.Error = err.Error()
+		}
+	}
+
+	r.mu.Lock()
+	r.records[url] = rec
+	r.mu.Unlock()
+
+	return resp, err
+}
+
+// errorStatus returns the status code behind err, falling back to code.
+func errorStatus(err error, code int) int {
+	var statusErr *StatusError
+
+	switch {
+	case errors.As(err, &statusErr):
+		return statusErr.StatusCode
+	case errors.Is(err, ErrNotFound):
+		return cmp.Or(code, http.StatusNotFound)
+	case code >= 200 && code <= 299:
+		// The request went through but the body was rejected, so replay the
+		// error itself rather than a successful status.
+		return 0
+	default:
+		return code
+	}
+}
+
+// Fixture returns what has been recorded so far, sorted by URL.
+func (r *RecordingFetcher) Fixture() *Fixture {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	fx := &Fixture{Records: make([]Record, 0, len(r.records))}
+
+	for _, rec := range r.records {
+		fx.Records = append(fx.Records, rec)
+	}
+
+	slices.SortFunc(fx.Records, func(a, b Record) int {
+		return cmp.Compare(a.URL, b.URL)
+	})
+
+	return fx
+}
+
+// ReplayFetcher serves recorded fetches from a Fixture without touching
+// the network. URLs that were never recorded are not found.
+type ReplayFetcher struct {
+	// Latency is added to every fetch, plus a random amount up to Jitter.
+	Latency time.Duration
+	Jitter  time.Duration
+
+	// Failures maps URLs to the error their fetch should return instead of
+	// the recorded response.
+	Failures map[string]error
+
+	// FailureRate is the fraction of other fetches that fail with ErrInjected.
+	FailureRate float64
+
+	records map[string]Record
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// NewReplayFetcher returns a ReplayFetcher for fx. seed makes the injected
+// jitter and random failures repeatable.
+func NewReplayFetcher(fx *Fixture, seed int64) *ReplayFetcher {
+	f := &ReplayFetcher{
+		Failures: make(map[string]error),
+		records:  make(map[string]Record, len(fx.Records)),
+		rand:     rand.New(rand.NewSource(seed)),
+	}
+
+	for _, rec := range fx.Records {
+		f.records[rec.URL] = rec
+	}
+
+	return f
+}
+
+func (f *ReplayFetcher) Fetch(url string) (string, []string, error) {
+	return bodyAndLinks(f.FetchResponse(context.Background(), url))
+}
+
+func (f *ReplayFetcher) FetchResponse(ctx context.Context, url string) (*Response, error) {
+	f.mu.Lock()
+
+	delay := f.Latency
+	if f.Jitter > 0 {
+		delay += time.Duration(f.rand.Int63n(int64(f.Jitter)))
+	}
+
+	fail := f.FailureRate > 0 && f.rand.Float64() < f.FailureRate
+
+	f.mu.Unlock()
+
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+
+	if err, ok := f.Failures[url]; ok {
+		return nil, err
+	}
+
+	if fail {
+		return nil, fmt.Errorf("%w: %s", ErrInjected, url)
+	}
+
+	rec, ok := f.records[url]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, url)
+	}
+
+	if rec.Error != "" {
+		return nil, errors.New(rec.Error)
+	}
+
+	resp := &Response{
+		URL:        rec.URL,
+		StatusCode: rec.StatusCode,
+		Header:     rec.Header,
+		Body:       rec.Body,
+		Links:      rec.Links,
+	}
+
+	if err := statusError(url, rec.StatusCode); err != nil {
+		return resp, err
+	}
+
+	return resp, nil
+}
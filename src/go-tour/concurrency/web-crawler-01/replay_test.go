@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func loadTestFixture(t *testing.T) *Fixture {
+	t.Helper()
+
+	fx, err := LoadFixture(filepath.Join("testdata", "golang.org.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return fx
+}
+
+func TestReplayMatchesFakeFetcher(t *testing.T) {
+	want, err := Crawl(context.Background(), "https://golang.org/", 4, fetcher)
+	if err != nil {
+		t.Fatalf("Crawl() error = %v", err)
+	}
+
+	got, err := Crawl(context.Background(), "https://golang.org/", 4, NewReplayFetcher(loadTestFixture(t), 1))
+	if err != nil {
+		t.Fatalf("Crawl() error = %v", err)
+	}
+
+	if !slices.Equal(pageURLs(got), pageURLs(want)) {
+		t.Fatalf("replayed pages = %q, want %q", pageURLs(got), pageURLs(want))
+	}
+
+	for _, w := range want.Pages {
+		g, _ := got.Page(w.URL)
+
+		if g.Status != w.Status || g.Title != w.Title || !slices.Equal(g.Links, w.Links) {
+			t.Errorf("Page(%q) = %s %q %q, want %s %q %q",
+				w.URL, g.Status, g.Title, g.Links, w.Status, w.Title, w.Links)
+		}
+	}
+
+	page, _ := got.Page("https://golang.org/cmd/")
+
+	if !errors.Is(page.Err, ErrNotFound) {
+		t.Errorf("replayed /cmd/ error = %v, want ErrNotFound", page.Err)
+	}
+}
+
+func TestRecordHTTPAndReplay(t *testing.T) {
+	ts := newTestSite(t)
+
+	rec := NewRecordingFetcher(NewHTTPFetcher())
+
+	urls := []string{ts.URL + "/", ts.URL + "/missing", ts.URL + "/broken", ts.URL + "/image.png"}
+
+	for _, url := range urls {
+		_, _, _ = rec.Fetch(url)
+	}
+
+	path := filepath.Join(t.TempDir(), "fixture.json")
+
+	if err := rec.Fixture().Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// Replay with the server gone to make sure nothing touches the network.
+	ts.Close()
+
+	fx, err := LoadFixture(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replay := NewReplayFetcher(fx, 1)
+
+	resp, err := replay.FetchResponse(context.Background(), urls[0])
+	if err != nil {
+		t.Fatalf("FetchResponse(/) error = %v", err)
+	}
+
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/html; charset=utf-8" {
+		t.Errorf("FetchResponse(/) = %d %q, want 200 text/html", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	if pageTitle(resp.Body) != "Home" || len(resp.Links) != 3 {
+		t.Errorf("FetchResponse(/) title %q, links %q", pageTitle(resp.Body), resp.Links)
+	}
+
+	if _, _, err := replay.Fetch(urls[1]); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Fetch(/missing) error = %v, want ErrNotFound", err)
+	}
+
+	var statusErr *StatusError
+
+	if _, _, err := replay.Fetch(urls[2]); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusInternalServerError {
+		t.Errorf("Fetch(/broken) error = %v, want status 500", err)
+	}
+
+	if _, _, err := replay.Fetch(urls[3]); err == nil {
+		t.Errorf("Fetch(/image.png) error = nil, want the recorded content type error")
+	}
+
+	if _, _, err := replay.Fetch(ts.URL + "/never-recorded"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Fetch(unrecorded) error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestReplayInjectedFailures(t *testing.T) {
+	fx := loadTestFixture(t)
+
+	f := NewReplayFetcher(fx, 1)
+	f.Failures["https://golang.org/pkg/"] = context.DeadlineExceeded
+
+	result, err := Crawl(context.Background(), "https://golang.org/", 4, f)
+	if err != nil {
+		t.Fatalf("Crawl() error = %v", err)
+	}
+
+	page, _ := result.Page("https://golang.org/pkg/")
+
+	if ClassifyError(page.Err) != ErrorTimeout {
+		t.Errorf("/pkg/ error = %v, want a timeout", page.Err)
+	}
+
+	if _, ok := result.Page("https://golang.org/pkg/fmt/"); ok {
+		t.Errorf("crawl reached /pkg/fmt/ through a failed page")
+	}
+}
+
+func TestReplayFailureRateIsSeeded(t *testing.T) {
+	fx := loadTestFixture(t)
+
+	failures := func(seed int64) []bool {
+		f := NewReplayFetcher(fx, seed)
+		f.FailureRate = 0.5
+
+		var failed []bool
+
+		for range 20 {
+			_, _, err := f.Fetch("https://golang.org/")
+			if err != nil && !errors.Is(err, ErrInjected) {
+				t.Fatalf("Fetch() error = %v, want ErrInjected", err)
+			}
+
+			failed = append(failed, err != nil)
+		}
+
+		return failed
+	}
+
+	a, b := failures(7), failures(7)
+
+	if !slices.Equal(a, b) {
+		t.Errorf("same seed gave different failures: %v and %v", a, b)
+	}
+
+	if !slices.Contains(a, true) || !slices.Contains(a, false) {
+		t.Errorf("failures = %v, want a mix at rate 0.5", a)
+	}
+}
+
+func TestReplayLatency(t *testing.T) {
+	f := NewReplayFetcher(loadTestFixture(t), 1)
+	f.Latency = 20 * time.Millisecond
+	f.Jitter = 10 * time.Millisecond
+
+	start := time.Now()
+
+	if _, _, err := f.Fetch("https://golang.org/"); err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed < f.Latency {
+		t.Errorf("Fetch() took %v, want at least %v", elapsed, f.Latency)
+	}
+}
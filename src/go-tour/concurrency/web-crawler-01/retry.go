@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"time"
+)
+
+// IsTransient reports whether err is likely to go away if the fetch is
+// tried again: timeouts, dropped connections, 429 Too Many Requests and
+// server errors.
+func IsTransient(err error) bool {
+	var statusErr *StatusError
+	var netErr net.Error
+
+	switch {
+	case err == nil, errors.Is(err, ErrCircuitOpen):
+		return false
+	case errors.As(err, &statusErr):
+		return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= 500
+	case errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, os.ErrDeadlineExceeded),
+		errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, syscall.ECONNREFUSED),
+		errors.Is(err, ErrInjected):
+		return true
+	case errors.As(err, &netErr):
+		return netErr.Timeout()
+	default:
+		return false
+	}
+}
+
+// RetryFetcher tries failed fetches of the Fetcher it wraps again, waiting
+// longer after every attempt.
+type RetryFetcher struct {
+	Fetcher Fetcher
+
+	// MaxAttempts is the number of times a fetch is tried, including the first.
+	MaxAttempts int
+
+	// BaseDelay is the wait before the first retry. It doubles after every
+	// attempt up to MaxDelay, and a random half of it is jitter so many
+	// failing fetches do not all retry at the same moment.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+
+	// Retryable decides which errors are worth another attempt. It defaults
+	// to IsTransient.
+	Retryable func(err error) bool
+
+	// Sleep waits between attempts. It defaults to time.Sleep.
+	Sleep func(d time.Duration)
+}
+
+// NewRetryFetcher returns a RetryFetcher that tries every fetch up to
+// attempts times.
+func NewRetryFetcher(fetcher Fetcher, attempts int) *RetryFetcher {
+	return &RetryFetcher{
+		Fetcher:     fetcher,
+		MaxAttempts: attempts,
+		BaseDelay:   200 * time.Millisecond,
+		MaxDelay:    5 * time.Second,
+		Retryable:   IsTransient,
+		Sleep:       time.Sleep,
+	}
+}
+
+// WithRetry returns a Middleware that tries every fetch up to attempts times.
+func WithRetry(attempts int) Middleware {
+	return func(f Fetcher) Fetcher {
+		return NewRetryFetcher(f, attempts)
+	}
+}
+
+func (f *RetryFetcher) Fetch(url string) (string, []string, error) {
+	return bodyAndLinks(f.FetchResponse(context.Background(), url))
+}
+
+func (f *RetryFetcher) FetchResponse(ctx context.Context, url string) (*Response, error) {
+	return f.retry(ctx, func() (*Response, error) {
+		return fetchResponse(ctx, f.Fetcher, url)
+	})
+}
+
+func (f *RetryFetcher) Revalidate(ctx context.Context, url string, cached *Response) (*Response, error) {
+	return f.retry(ctx, func() (*Response, error) {
+		return revalidate(ctx, f.Fetcher, url, cached)
+	})
+}
+
+// retry calls fetch until it succeeds, fails for good or ctx is done.
+func (f *RetryFetcher) retry(ctx context.Context, fetch func() (*Response, error)) (*Response, error) {
+	retryable := f.Retryable
+	if retryable == nil {
+		retryable = IsTransient
+	}
+
+	sleep := f.Sleep
+	if sleep == nil {
+		sleep = time.Sleep
+	}
+
+	for attempt := 1; ; attempt++ {
+		resp, err := fetch()
+
+		if err == nil || attempt >= f.MaxAttempts || !retryable(err) || ctx.Err() != nil {
+			return resp, err
+		}
+
+		sleep(f.backoff(attempt))
+	}
+}
+
+// backoff returns how long to wait after the given failed attempt.
+func (f *RetryFetcher) backoff(attempt int) time.Duration {
+	d := f.BaseDelay
+
+	for range attempt - 1 {
+		d *= 2
+
+		if f.MaxDelay > 0 && d >= f.MaxDelay {
+			break
+		}
+	}
+
+	if f.MaxDelay > 0 {
+		d = min(d, f.MaxDelay)
+	}
+
+	if d <= 0 {
+		return 0
+	}
+
+	half := d / 2
+
+	return half + rand.N(d-half+1)
+}
@@ -0,0 +1,421 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RobotsRules are the robots.txt rules that apply to one user agent.
+type RobotsRules struct {
+	rules []robotsRule
+
+	// CrawlDelay is the minimum time between two requests to the host.
+	CrawlDelay time.Duration
+}
+
+type robotsRule struct {
+	allow   bool
+	pattern string
+	re      *regexp.Regexp
+}
+
+type robotsGroup struct {
+	agents     []string
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+// allowAll and disallowAll are the rules used when robots.txt is missing or
+// cannot be fetched.
+var (
+	allowAll    = &RobotsRules{}
+	disallowAll = &RobotsRules{rules: []robotsRule{newRobotsRule(false, "/")}}
+)
+
+// ParseRobots parses a robots.txt body and returns the rules of the group that
+// best matches userAgent. Groups naming the agent win over the "*" group, and
+// groups naming the same agent are merged.
+func ParseRobots(body string, userAgent string) *RobotsRules {
+	var groups []*robotsGroup
+	var current *robotsGroup
+
+	// A run of user-agent lines opens a group, and the rules after it belong to
+	// every agent in the run.
+	inAgents := false
+
+	scanner := bufio.NewScanner(strings.NewReader(body))
+
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			if !inAgents {
+				current = &robotsGroup{}
+				groups = append(groups, current)
+				inAgents = true
+			}
+
+			current.agents = append(current.agents, strings.ToLower(value))
+
+		case "allow", "disallow":
+			inAgents = false
+
+			// An empty Disallow allows everything, which is the default anyway.
+			if current == nil || value == "" {
+				continue
+			}
+
+			current.rules = append(current.rules, newRobotsRule(key == "allow", value))
+
+		case "crawl-delay":
+			inAgents = false
+
+			if current == nil {
+				continue
+			}
+
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds >= 0 {
+				current.crawlDelay = time.Duration(seconds * float64(time.Second))
+			}
+		}
+	}
+
+	token := agentToken(userAgent)
+	rules := &RobotsRules{}
+
+	best := -1
+
+	for _, g := range groups {
+		score := g.score(token)
+
+		if score < 0 || score < best {
+			continue
+		}
+
+		if score > best {
+			best = score
+			rules = &RobotsRules{}
+		}
+
+		rules.rules = append(rules.rules, g.rules...)
+		rules.CrawlDelay = max(rules.CrawlDelay, g.crawlDelay)
+	}
+
+	return rules
+}
+
+// score rates how well the group matches the agent token. It is -1 when the
+// group does not apply, 0 for "*" and the length of the name otherwise.
+func (g *robotsGroup) score(token string) int {
+	score := -1
+
+	for _, agent := range g.agents {
+		switch {
+		case agent == "*":
+			score = max(score, 0)
+		case agent != "" && strings.Contains(token, agent):
+			score = max(score, len(agent))
+		}
+	}
+
+	return score
+}
+
+// agentToken returns the product token of a User-Agent header, such as
+// "learn-go-crawler" for "learn-go-crawler/1.0 (+https://example.com)".
+func agentToken(userAgent string) string {
+	token, _, _ := strings.Cut(strings.TrimSpace(userAgent), " ")
+	token, _, _ = strings.Cut(token, "/")
+
+	return strings.ToLower(token)
+}
+
+func newRobotsRule(allow bool, pattern string) robotsRule {
+	expr := regexp.QuoteMeta(pattern)
+	expr = strings.ReplaceAll(expr, `\*`, ".*")
+
+	if strings.HasSuffix(expr, `\$`) {
+		expr = strings.TrimSuffix(expr, `\$`) + "$"
+	}
+
+	return robotsRule{
+		allow:   allow,
+		pattern: pattern,
+		re:      regexp.MustCompile("^" + expr),
+	}
+}
+
+// Allowed reports whether path may be fetched. path is the escaped path of the
+// URL including its query. The longest matching rule wins, and Allow wins a tie.
+func (r *RobotsRules) Allowed(path string) bool {
+	if path == "" {
+		path = "/"
+	}
+
+	allowed := true
+	longest := -1
+
+	for _, rule := range r.rules {
+		if !rule.re.MatchString(path) {
+			continue
+		}
+
+		if n := len(rule.pattern); n > longest || (n == longest && rule.allow) {
+			longest = n
+			allowed = rule.allow
+		}
+	}
+
+	return allowed
+}
+
+// RobotsPolicy fetches and caches robots.txt per host through a Fetcher.
+type RobotsPolicy struct {
+	Fetcher   Fetcher
+	UserAgent string
+
+	// Limiter, when set, spaces out robots.txt fetches along with the pages
+	// of the same host.
+	Limiter *HostLimiter
+
+	// RetryAfter is how long a host stays off limits after its robots.txt
+	// failed with a server or network error. It is fetched again after that.
+	RetryAfter time.Duration
+
+	mu    sync.Mutex
+	hosts map[string]*robotsEntry
+}
+
+type robotsEntry struct {
+	ready chan struct{}
+	rules *RobotsRules
+	err   error
+
+	// expires is when a temporary disallow runs out. It is zero for rules
+	// that last the whole crawl.
+	expires time.Time
+}
+
+// NewRobotsPolicy returns a RobotsPolicy for userAgent that loads
+// robots.txt files with fetcher.
+func NewRobotsPolicy(fetcher Fetcher, userAgent string) *RobotsPolicy {
+	return &RobotsPolicy{
+		Fetcher:    fetcher,
+		UserAgent:  userAgent,
+		RetryAfter: time.Minute,
+		hosts:      make(map[string]*robotsEntry),
+	}
+}
+
+// Rules returns the robots.txt rules for the host of rawURL. robots.txt is
+// fetched once per host, even when many goroutines ask at the same time.
+func (p *RobotsPolicy) Rules(ctx context.Context, rawURL string) (*RobotsRules, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	origin := u.Scheme + "://" + u.Host
+
+	p.mu.Lock()
+
+	if p.hosts == nil {
+		p.hosts = make(map[string]*robotsEntry)
+	}
+
+	entry, ok := p.hosts[origin]
+
+	if ok && entry.expired() {
+		ok = false
+	}
+
+	if !ok {
+		entry = &robotsEntry{ready: make(chan struct{})}
+		p.hosts[origin] = entry
+	}
+
+	p.mu.Unlock()
+
+	if ok {
+		select {
+		case <-entry.ready:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		// The caller that loaded the entry gave up, so load it ourselves.
+		if entry.err != nil {
+			return p.Rules(ctx, rawURL)
+		}
+
+		return entry.rules, nil
+	}
+
+	entry.rules, entry.expires, entry.err = p.load(ctx, origin)
+
+	if entry.err != nil {
+		// The fetch was interrupted, so let the next caller try again.
+		p.mu.Lock()
+		if p.hosts[origin] == entry {
+			delete(p.hosts, origin)
+		}
+		p.mu.Unlock()
+	}
+
+	close(entry.ready)
+
+	return entry.rules, entry.err
+}
+
+// expired reports whether the entry is a temporary disallow that ran out.
+func (e *robotsEntry) expired() bool {
+	select {
+	case <-e.ready:
+		return !e.expires.IsZero() && !time.Now().Before(e.expires)
+	default:
+		return false
+	}
+}
+
+// load fetches the robots.txt of origin. It returns the time the rules
+// expire, or an error only when ctx ended before robots.txt was read.
+func (p *RobotsPolicy) load(ctx context.Context, origin string) (*RobotsRules, time.Time, error) {
+	robotsURL := origin + "/robots.txt"
+
+	if p.Limiter != nil {
+		if err := p.Limiter.Wait(ctx, hostOf(robotsURL), 0); err != nil {
+			return nil, time.Time{}, err
+		}
+	}
+
+	// robots.txt is plain text whatever the server calls it.
+	resp, err := fetchResponse(acceptAnyContentType(ctx), p.Fetcher, robotsURL)
+
+	switch {
+	case err == nil:
+		return ParseRobots(resp.Body, p.UserAgent), time.Time{}, nil
+
+	case ctx.Err() != nil:
+		return nil, time.Time{}, ctx.Err()
+
+	// Server and network errors leave us unsure, so stay off the host for a
+	// while and ask again.
+	case robotsUnavailable(err):
+		return disallowAll, time.Now().Add(p.RetryAfter), nil
+
+	// A missing robots.txt, or any other client error, means there are no rules.
+	default:
+		return allowAll, time.Time{}, nil
+	}
+}
+
+// robotsUnavailable reports whether err means robots.txt could not be read
+// for now, because of a server error or a network failure.
+func robotsUnavailable(err error) bool {
+	var statusErr *StatusError
+	var netErr net.Error
+
+	return errors.As(err, &statusErr) && statusErr.StatusCode >= 500 ||
+		errors.As(err, &netErr) ||
+		errors.Is(err, ErrCircuitOpen) ||
+		IsTransient(err)
+}
+
+// Allowed reports whether rawURL may be crawled. It is false when ctx ends
+// before the rules of the host are known.
+func (p *RobotsPolicy) Allowed(ctx context.Context, rawURL string) bool {
+	rules, err := p.Rules(ctx, rawURL)
+	if err != nil {
+		return false
+	}
+
+	u, _ := url.Parse(rawURL)
+
+	return rules.Allowed(u.RequestURI())
+}
+
+// CrawlDelay returns the Crawl-delay of the host of rawURL.
+func (p *RobotsPolicy) CrawlDelay(ctx context.Context, rawURL string) time.Duration {
+	rules, err := p.Rules(ctx, rawURL)
+	if err != nil {
+		return 0
+	}
+
+	return rules.CrawlDelay
+}
+
+// HostLimiter spaces out requests to the same host, no matter how many
+// goroutines are fetching from it.
+type HostLimiter struct {
+	// Interval is the minimum time between two requests to one host.
+	Interval time.Duration
+
+	mu   sync.Mutex
+	next map[string]time.Time
+}
+
+// NewHostLimiter returns a HostLimiter that allows one request per interval
+// to each host.
+func NewHostLimiter(interval time.Duration) *HostLimiter {
+	return &HostLimiter{
+		Interval: interval,
+		next:     make(map[string]time.Time),
+	}
+}
+
+// Wait blocks until a request to host is allowed. interval overrides
+// Interval when it is longer, which is how a robots.txt Crawl-delay is
+// applied. Wait returns ctx.Err() if ctx is done first.
+func (l *HostLimiter) Wait(ctx context.Context, host string, interval time.Duration) error {
+	interval = max(interval, l.Interval)
+
+	l.mu.Lock()
+
+	if l.next == nil {
+		l.next = make(map[string]time.Time)
+	}
+
+	now := time.Now()
+	at := l.next[host]
+
+	if at.Before(now) {
+		at = now
+	}
+
+	// Reserve the slot before sleeping so concurrent callers queue up behind it.
+	l.next[host] = at.Add(interval)
+
+	l.mu.Unlock()
+
+	delay := time.Until(at)
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
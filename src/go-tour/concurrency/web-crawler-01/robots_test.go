@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testRobots = `
+# Example robots.txt
+User-agent: *
+Disallow: /private/
+Allow: /private/public.html
+Disallow: /*.pdf$
+Disallow: /search?*q=
+Crawl-delay: 0.5
+
+User-agent: learn-go-crawler
+User-agent: otherbot
+Disallow: /no-bots/
+Allow: /no-bots/ok
+Crawl-delay: 2
+
+User-agent: learn-go-crawler
+Disallow: /merged/
+`
+
+func TestRobotsAllowed(t *testing.T) {
+	tests := []struct {
+		agent string
+		path  string
+		want  bool
+	}{
+		{"somebot/2.0", "/", true},
+		{"somebot/2.0", "/private/", false},
+		{"somebot/2.0", "/private/secret.html", false},
+		{"somebot/2.0", "/private/public.html", true},
+		{"somebot/2.0", "/docs/file.pdf", false},
+		{"somebot/2.0", "/docs/file.pdf?download=1", true},
+		{"somebot/2.0", "/search?lang=en&q=go", false},
+		{"somebot/2.0", "/search", true},
+		{"somebot/2.0", "/no-bots/", true},
+		{"learn-go-crawler/1.0", "/private/", true},
+		{"learn-go-crawler/1.0", "/no-bots/page", false},
+		{"learn-go-crawler/1.0", "/no-bots/ok", true},
+		{"learn-go-crawler/1.0", "/merged/page", false},
+		{"OtherBot", "/no-bots/", false},
+		{"OtherBot", "/merged/page", true},
+	}
+
+	for _, tt := range tests {
+		rules := ParseRobots(testRobots, tt.agent)
+
+		if got := rules.Allowed(tt.path); got != tt.want {
+			t.Errorf("ParseRobots(%q).Allowed(%q) = %v, want %v", tt.agent, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestRobotsCrawlDelay(t *testing.T) {
+	tests := []struct {
+		agent string
+		want  time.Duration
+	}{
+		{"somebot", 500 * time.Millisecond},
+		{"learn-go-crawler", 2 * time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := ParseRobots(testRobots, tt.agent).CrawlDelay; got != tt.want {
+			t.Errorf("ParseRobots(%q).CrawlDelay = %v, want %v", tt.agent, got, tt.want)
+		}
+	}
+}
+
+func TestRobotsTieGoesToAllow(t *testing.T) {
+	rules := ParseRobots("User-agent: *\nDisallow: /page\nAllow: /page\n", "bot")
+
+	if !rules.Allowed("/page") {
+		t.Error("Allowed(/page) = false, want true when Allow and Disallow tie")
+	}
+}
+
+// countingFetcher serves robots.txt files from a map and counts the fetches.
+type countingFetcher struct {
+	files   map[string]string
+	errs    map[string]error
+	fetches atomic.Int32
+}
+
+func (f *countingFetcher) Fetch(url string) (string, []string, error) {
+	f.fetches.Add(1)
+
+	if err, ok := f.errs[url]; ok {
+		return "", nil, err
+	}
+
+	if body, ok := f.files[url]; ok {
+		return body, nil, nil
+	}
+
+	return "", nil, fmt.Errorf("%w: %s", ErrNotFound, url)
+}
+
+func TestRobotsPolicy(t *testing.T) {
+	f := &countingFetcher{
+		files: map[string]string{
+			"https://a.example/robots.txt": "User-agent: *\nDisallow: /admin\n",
+		},
+		errs: map[string]error{
+			"https://down.example/robots.txt": &StatusError{URL: "https://down.example/robots.txt", StatusCode: 503},
+		},
+	}
+
+	p := NewRobotsPolicy(f, "learn-go-crawler/1.0")
+
+	var wg sync.WaitGroup
+
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.Allowed(context.Background(), "https://a.example/admin")
+		}()
+	}
+
+	wg.Wait()
+
+	if n := f.fetches.Load(); n != 1 {
+		t.Errorf("robots.txt fetched %d times, want 1", n)
+	}
+
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"https://a.example/", true},
+		{"https://a.example/admin/users", false},
+		{"https://b.example/admin", true},
+		{"https://down.example/", false},
+	}
+
+	for _, tt := range tests {
+		if got := p.Allowed(context.Background(), tt.url); got != tt.want {
+			t.Errorf("Allowed(%q) = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestRobotsPolicyRetriesUnavailable(t *testing.T) {
+	robotsURL := "https://down.example/robots.txt"
+
+	f := &countingFetcher{
+		files: map[string]string{robotsURL: "User-agent: *\nDisallow: /admin\n"},
+		errs:  map[string]error{robotsURL: &StatusError{URL: robotsURL, StatusCode: 503}},
+	}
+
+	p := NewRobotsPolicy(f, "learn-go-crawler/1.0")
+	p.RetryAfter = 20 * time.Millisecond
+
+	if p.Allowed(context.Background(), "https://down.example/") {
+		t.Errorf("Allowed() = true while robots.txt fails, want false")
+	}
+
+	delete(f.errs, robotsURL)
+	time.Sleep(2 * p.RetryAfter)
+
+	if !p.Allowed(context.Background(), "https://down.example/") {
+		t.Errorf("Allowed() = false after robots.txt recovered, want true")
+	}
+
+	if n := f.fetches.Load(); n != 2 {
+		t.Errorf("robots.txt fetched %d times, want 2", n)
+	}
+}
+
+func TestRobotsPolicyHTTP(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		fmt.Fprint(w, "User-agent: *\nDisallow: /admin\n")
+	}))
+	t.Cleanup(ts.Close)
+
+	limiter := NewHostLimiter(time.Hour)
+
+	p := NewRobotsPolicy(NewHTTPFetcher(), "learn-go-crawler/1.0")
+	p.Limiter = limiter
+
+	if p.Allowed(context.Background(), ts.URL+"/admin") {
+		t.Errorf("Allowed(/admin) = true, want robots.txt obeyed despite its content type")
+	}
+
+	if _, ok := limiter.next[hostOf(ts.URL)]; !ok {
+		t.Errorf("robots.txt fetch did not go through the host limiter")
+	}
+}
+
+func TestHostLimiter(t *testing.T) {
+	l := NewHostLimiter(20 * time.Millisecond)
+
+	var mu sync.Mutex
+	var times []time.Time
+
+	var wg sync.WaitGroup
+
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if err := l.Wait(context.Background(), "a.example", 0); err != nil {
+				t.Error(err)
+			}
+
+			mu.Lock()
+			times = append(times, time.Now())
+			mu.Unlock()
+		}()
+	}
+
+	wg.Wait()
+
+	first, last := times[0], times[0]
+
+	for _, at := range times {
+		if at.Before(first) {
+			first = at
+		}
+		if at.After(last) {
+			last = at
+		}
+	}
+
+	if spread := last.Sub(first); spread < 70*time.Millisecond {
+		t.Errorf("5 requests to one host spread over %v, want about 80ms", spread)
+	}
+
+	start := time.Now()
+
+	if err := l.Wait(context.Background(), "b.example", 0); err != nil || time.Since(start) > 10*time.Millisecond {
+		t.Errorf("Wait(b.example) was delayed by another host")
+	}
+}
+
+func TestHostLimiterCancel(t *testing.T) {
+	l := NewHostLimiter(time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	if err := l.Wait(ctx, "a.example", 0); err != nil {
+		t.Fatalf("first Wait() error = %v", err)
+	}
+
+	cancel()
+
+	if err := l.Wait(ctx, "a.example", 0); err != context.Canceled {
+		t.Errorf("Wait() error = %v, want context.Canceled", err)
+	}
+}
+
+func TestCrawlRobots(t *testing.T) {
+	robotsFetcher := fakeFetcher{
+		"https://golang.org/robots.txt": &fakeResult{"User-agent: *\nDisallow: /pkg/fmt/\n", nil},
+	}
+
+	for url, res := range fetcher {
+		robotsFetcher[url] = res
+	}
+
+	c := NewCrawler(robotsFetcher)
+	c.Robots = NewRobotsPolicy(robotsFetcher, "learn-go-crawler")
+
+	result, err := c.Crawl(context.Background(), "https://golang.org/")
+	if err != nil {
+		t.Fatalf("Crawl() error = %v", err)
+	}
+
+	if page, _ := result.Page("https://golang.org/pkg/fmt/"); page.Status != PageDisallowed {
+		t.Errorf("Page(pkg/fmt).Status = %q, want %q", page.Status, PageDisallowed)
+	}
+
+	if page, _ := result.Page("https://golang.org/pkg/os/"); page.Status != PageOK {
+		t.Errorf("Page(pkg/os).Status = %q, want %q", page.Status, PageOK)
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"hash/fnv"
+	"iter"
+	"math/bits"
+	"slices"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// SimHash returns the 64-bit SimHash of the words in text, using
+// overlapping shingles of shingle words. Texts that share most of their
+// shingles get hashes that differ in only a few bits.
+func SimHash(text string, shingle int) uint64 {
+	words := Tokenize(text)
+
+	if len(words) == 0 {
+		return 0
+	}
+
+	shingle = max(min(shingle, len(words)), 1)
+
+	var weights [64]int
+
+	for i := 0; i+shingle <= len(words); i++ {
+		h := fnv.New64a()
+		h.Write([]byte(strings.Join(words[i:i+shingle], " ")))
+		sum := h.Sum64()
+
+		for bit := range 64 {
+			if sum&(1<<bit) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+
+	var hash uint64
+
+	for bit, w := range weights {
+		if w > 0 {
+			hash |= 1 << bit
+		}
+	}
+
+	return hash
+}
+
+// HammingDistance returns the number of bits that differ between a and b.
+func HammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// visibleText returns the text a reader would see on an HTML page, leaving
+// out scripts and styles. Other bodies are returned unchanged.
+func visibleText(body string) string {
+	if !strings.Contains(body, "<") {
+		return body
+	}
+
+	var b strings.Builder
+
+	z := html.NewTokenizer(strings.NewReader(body))
+	skip := 0
+
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return b.String()
+
+		case html.StartTagToken:
+			if name, _ := z.TagName(); isHiddenTag(atom.Lookup(name)) {
+				skip++
+			}
+
+		case html.EndTagToken:
+			if name, _ := z.TagName(); isHiddenTag(atom.Lookup(name)) && skip > 0 {
+				skip--
+			}
+
+		case html.TextToken:
+			if skip == 0 {
+				b.Write(z.Text())
+				b.WriteByte(' ')
+			}
+		}
+	}
+}
+
+func isHiddenTag(tag atom.Atom) bool {
+	return tag == atom.Script || tag == atom.Style || tag == atom.Noscript || tag == atom.Template
+}
+
+// DuplicateDetector remembers the SimHash of every page it has seen and
+// spots pages whose content is a near-duplicate of another one. Of a group
+// of near-duplicates, the page with the lowest depth, and then the lowest
+// URL, is the original, whatever order the pages are checked in.
+type DuplicateDetector struct {
+	// Threshold is the largest Hamming distance between two fingerprints
+	// that still counts as a duplicate.
+	Threshold int
+
+	// Shingle is the number of words per shingle.
+	Shingle int
+
+	mu    sync.Mutex
+	pages []Fingerprint
+	byURL map[string]int
+
+	// bands holds one lookup table per slice of the hash bits. Two hashes
+	// within Threshold bits agree on at least one of Threshold+1 slices, so
+	// only pages sharing a slice with a hash have to be compared to it.
+	bands []map[uint64][]int
+}
+
+// Fingerprint is the SimHash of a page, as saved in a Checkpoint.
+type Fingerprint struct {
+	URL   string `json:"url"`
+	Depth int    `json:"depth"`
+	Hash  uint64 `json:"hash"`
+}
+
+// before reports whether f ranks before g as the original of a group.
+func (f Fingerprint) before(g Fingerprint) bool {
+	if f.Depth != g.Depth {
+		return f.Depth < g.Depth
+	}
+
+	return f.URL < g.URL
+}
+
+// NewDuplicateDetector returns a DuplicateDetector that treats pages
+// within threshold bits of each other as duplicates.
+func NewDuplicateDetector(threshold int) *DuplicateDetector {
+	return &DuplicateDetector{
+		Threshold: threshold,
+		Shingle:   3,
+	}
+}
+
+// Check fingerprints body, remembers it, and reports the original of the
+// near-duplicates seen so far that rank before the page at url and depth.
+// A page that ranks before all of them is an original itself. Pages without
+// any words are never duplicates.
+func (d *DuplicateDetector) Check(url string, depth int, body string) (string, bool) {
+	text := visibleText(body)
+
+	if strings.TrimSpace(text) == "" {
+		return "", false
+	}
+
+	fp := Fingerprint{URL: url, Depth: depth, Hash: SimHash(text, d.Shingle)}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.add(fp)
+
+	return d.original(fp)
+}
+
+// Original reports the original of url among every page checked so far.
+// It can differ from what Check said when a page that ranks before the
+// earlier original was checked later.
+func (d *DuplicateDetector) Original(url string) (string, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	i, ok := d.byURL[url]
+	if !ok {
+		return "", false
+	}
+
+	return d.original(d.pages[i])
+}
+
+// Fingerprints returns the fingerprints of every page checked so far.
+func (d *DuplicateDetector) Fingerprints() []Fingerprint {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return slices.Clone(d.pages)
+}
+
+// Restore remembers fingerprints, as returned by Fingerprints, as if their
+// pages had been checked.
+func (d *DuplicateDetector) Restore(fingerprints []Fingerprint) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, fp := range fingerprints {
+		d.add(fp)
+	}
+}
+
+// add indexes fp, replacing an earlier fingerprint of the same URL.
+func (d *DuplicateDetector) add(fp Fingerprint) {
+	if d.bands == nil {
+		d.bands = make([]map[uint64][]int, min(max(d.Threshold, 0)+1, 64))
+
+		for i := range d.bands {
+			d.bands[i] = make(map[uint64][]int)
+		}
+
+		d.byURL = make(map[string]int)
+	}
+
+	if i, ok := d.byURL[fp.URL]; ok {
+		old := d.pages[i]
+
+		for band, key := range d.keys(old.Hash) {
+			d.bands[band][key] = slices.DeleteFunc(d.bands[band][key], func(j int) bool { return j == i })
+		}
+
+		d.pages[i] = fp
+	} else {
+		d.byURL[fp.URL] = len(d.pages)
+		d.pages = append(d.pages, fp)
+	}
+
+	i := d.byURL[fp.URL]
+
+	for band, key := range d.keys(fp.Hash) {
+		d.bands[band][key] = append(d.bands[band][key], i)
+	}
+}
+
+// original returns the page that ranks first among the near-duplicates of
+// fp, if it ranks before fp.
+func (d *DuplicateDetector) original(fp Fingerprint) (string, bool) {
+	var best *Fingerprint
+
+	for band, key := range d.keys(fp.Hash) {
+		for _, i := range d.bands[band][key] {
+			other := &d.pages[i]
+
+			if !other.before(fp) || HammingDistance(other.Hash, fp.Hash) > d.Threshold {
+				continue
+			}
+
+			if best == nil || other.before(*best) {
+				best = other
+			}
+		}
+	}
+
+	if best == nil {
+		return "", false
+	}
+
+	return best.URL, true
+}
+
+// keys returns the lookup key of hash in every band.
+func (d *DuplicateDetector) keys(hash uint64) iter.Seq2[int, uint64] {
+	return func(yield func(int, uint64) bool) {
+		n := len(d.bands)
+
+		for band := range n {
+			lo, hi := band*64/n, (band+1)*64/n
+			key := hash >> lo & (1<<(hi-lo) - 1)
+
+			if !yield(band, key) {
+				return
+			}
+		}
+	}
+}
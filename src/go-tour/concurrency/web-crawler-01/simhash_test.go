@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const article = `Go is an open source programming language that makes it simple to build
+secure, scalable systems. Go was designed at Google in 2007 to improve programming
+productivity in an era of multicore, networked machines and large codebases. The
+designers wanted to address criticisms of other languages in use at Google while
+keeping their useful characteristics such as static typing and run-time efficiency,
+readability and usability, and high-performance networking and multiprocessing.`
+
+func TestSimHash(t *testing.T) {
+	edited := strings.Replace(article, "2007", "2009", 1)
+	other := "The quick brown fox jumps over the lazy dog while the cat watches from the fence and the birds sing in the trees above the old farmhouse"
+
+	a := SimHash(article, 3)
+
+	if d := HammingDistance(a, SimHash(article, 3)); d != 0 {
+		t.Errorf("same text distance = %d, want 0", d)
+	}
+
+	if d := HammingDistance(a, SimHash(strings.ToUpper(article), 3)); d != 0 {
+		t.Errorf("case-changed text distance = %d, want 0", d)
+	}
+
+	near := HammingDistance(a, SimHash(edited, 3))
+	far := HammingDistance(a, SimHash(other, 3))
+
+	if near > 6 || far < 16 {
+		t.Errorf("distance to edited text = %d, to unrelated text = %d, want <= 6 and >= 16", near, far)
+	}
+
+	if SimHash("", 3) != 0 {
+		t.Error("SimHash(\"\") != 0")
+	}
+}
+
+func TestVisibleText(t *testing.T) {
+	body := `<html><head><title>T</title><style>p{}</style><script>var x = "<p>";</script></head><body><p>Hello <b>world</b></p></body></html>`
+
+	got := strings.Join(strings.Fields(visibleText(body)), " ")
+
+	if got != "T Hello world" {
+		t.Errorf("visibleText() = %q, want %q", got, "T Hello world")
+	}
+}
+
+func TestDuplicateDetector(t *testing.T) {
+	d := NewDuplicateDetector(3)
+
+	if _, dup := d.Check("a", 0, "<p>"+article+"</p>"); dup {
+		t.Fatal("first page reported as a duplicate")
+	}
+
+	if orig, dup := d.Check("b", 0, `<div class="x">`+article+`</div><script>track()</script>`); !dup || orig != "a" {
+		t.Errorf("Check(b) = %q, %v, want a, true", orig, dup)
+	}
+
+	if _, dup := d.Check("c", 0, "Something else entirely, about gophers and their burrows in the hills"); dup {
+		t.Error("unrelated page reported as a duplicate")
+	}
+
+	if _, dup := d.Check("empty", 0, "<html></html>"); dup {
+		t.Error("empty page reported as a duplicate")
+	}
+}
+
+func TestDuplicateDetectorOriginal(t *testing.T) {
+	d := NewDuplicateDetector(3)
+	page := "<p>" + article + "</p>"
+
+	d.Check("https://a.example/b", 1, page)
+
+	if orig, dup := d.Check("https://a.example/a", 1, page); dup {
+		t.Errorf("Check(a) = %q, true, want a to be the original of b", orig)
+	}
+
+	if orig, _ := d.Original("https://a.example/b"); orig != "https://a.example/a" {
+		t.Errorf("Original(b) = %q, want the lower URL", orig)
+	}
+
+	d.Check("https://a.example/z", 0, page)
+
+	for _, url := range []string{"https://a.example/a", "https://a.example/b"} {
+		if orig, _ := d.Original(url); orig != "https://a.example/z" {
+			t.Errorf("Original(%q) = %q, want the shallowest page", url, orig)
+		}
+	}
+}
+
+func TestDuplicateDetectorBands(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+
+	for _, threshold := range []int{0, 3, 10, 40} {
+		d := NewDuplicateDetector(threshold)
+
+		var fps []Fingerprint
+
+		for i := range 500 {
+			hash := r.Uint64()
+
+			// Flip a few bits of an earlier hash now and then, so there
+			// are near-duplicates to find.
+			if i > 0 && r.IntN(2) == 0 {
+				hash = fps[r.IntN(len(fps))].Hash
+
+				for range r.IntN(threshold + 2) {
+					hash ^= 1 << r.IntN(64)
+				}
+			}
+
+			fps = append(fps, Fingerprint{URL: fmt.Sprintf("u%03d", i), Hash: hash})
+		}
+
+		d.Restore(fps)
+
+		for _, fp := range fps {
+			want := ""
+
+			for _, other := range fps {
+				if other.URL < fp.URL && HammingDistance(other.Hash, fp.Hash) <= threshold {
+					want = other.URL
+					break
+				}
+			}
+
+			if got, _ := d.Original(fp.URL); got != want {
+				t.Errorf("threshold %d: Original(%q) = %q, want %q", threshold, fp.URL, got, want)
+			}
+		}
+	}
+}
+
+func TestCrawlDuplicates(t *testing.T) {
+	f := fakeFetcher{
+		"https://a.example/": &fakeResult{article, []string{
+			"https://a.example/copy",
+			"https://a.example/print",
+			"https://a.example/other",
+		}},
+		"https://a.example/copy":  &fakeResult{article, []string{"https://a.example/hidden"}},
+		"https://a.example/print": &fakeResult{strings.Replace(article, "2007", "2009", 1), nil},
+		"https://a.example/other": &fakeResult{"A page about something else entirely, like gophers in burrows.", nil},
+	}
+
+	c := NewCrawler(f)
+	c.Workers = 1
+	c.Duplicates = NewDuplicateDetector(6)
+
+	result, err := c.Crawl(context.Background(), "https://a.example/")
+	if err != nil {
+		t.Fatalf("Crawl() error = %v", err)
+	}
+
+	want := [][]string{{"https://a.example/", "https://a.example/copy", "https://a.example/print"}}
+
+	if got := result.DuplicateClusters(); !slices.EqualFunc(got, want, slices.Equal) {
+		t.Errorf("DuplicateClusters() = %q, want %q", got, want)
+	}
+
+	if _, ok := result.Page("https://a.example/hidden"); ok {
+		t.Error("links of a duplicate page were followed")
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// SitemapEntry is a <url> of a sitemap or a <sitemap> of a sitemap index.
+type SitemapEntry struct {
+	Loc     string
+	LastMod time.Time
+}
+
+// ReadSitemap streams the entries of a sitemap or sitemap index from r,
+// calling fn for each one without loading the whole document. Gzip-compressed
+// input is detected and decompressed. index reports whether the entry is a
+// <sitemap> of an index rather than a page.
+func ReadSitemap(r io.Reader, fn func(entry SitemapEntry, index bool) error) error {
+	return readSitemap(r, 0, fn)
+}
+
+// readSitemap is ReadSitemap failing with ErrBodyTooLarge once the
+// uncompressed document grows past maxSize bytes. A maxSize of 0 or less
+// means no limit.
+func readSitemap(r io.Reader, maxSize int64, fn func(entry SitemapEntry, index bool) error) error {
+	r, err := maybeGunzip(r)
+	if err != nil {
+		return err
+	}
+
+	if maxSize > 0 {
+		r = &sizeLimitReader{r: r, left: maxSize}
+	}
+
+	d := xml.NewDecoder(r)
+
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("sitemap: %w", err)
+		}
+
+		start, ok := tok.(xml.StartElement)
+		if !ok || (start.Name.Local != "url" && start.Name.Local != "sitemap") {
+			continue
+		}
+
+		var raw struct {
+			Loc     string `xml:"loc"`
+			LastMod string `xml:"lastmod"`
+		}
+
+		if err := d.DecodeElement(&raw, &start); err != nil {
+			return fmt.Errorf("sitemap: %w", err)
+		}
+
+		entry := SitemapEntry{Loc: strings.TrimSpace(raw.Loc)}
+
+		if entry.Loc == "" {
+			continue
+		}
+
+		// A lastmod we cannot read is treated like a missing one.
+		entry.LastMod, _ = parseLastMod(raw.LastMod)
+
+		if err := fn(entry, start.Name.Local == "sitemap"); err != nil {
+			return err
+		}
+	}
+}
+
+// maybeGunzip returns a reader that decompresses r if it starts with the
+// gzip magic number, and r itself otherwise.
+func maybeGunzip(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+
+	magic, err := br.Peek(2)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	if len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		return gzip.NewReader(br)
+	}
+
+	return br, nil
+}
+
+// sizeLimitReader reads from r until more than left bytes came through,
+// and fails with ErrBodyTooLarge after that.
+type sizeLimitReader struct {
+	r    io.Reader
+	left int64
+}
+
+func (l *sizeLimitReader) Read(p []byte) (int, error) {
+	if l.left < 0 {
+		return 0, ErrBodyTooLarge
+	}
+
+	n, err := l.r.Read(p)
+	l.left -= int64(n)
+
+	if l.left < 0 {
+		return n, ErrBodyTooLarge
+	}
+
+	return n, err
+}
+
+// lastModLayouts are the W3C Datetime forms allowed in <lastmod>.
+var lastModLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02",
+	"2006-01",
+	"2006",
+}
+
+func parseLastMod(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+
+	if s == "" {
+		return time.Time{}, nil
+	}
+
+	for _, layout := range lastModLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("sitemap: bad lastmod %q", s)
+}
+
+// SitemapLoader collects crawl seeds from sitemaps, following sitemap indexes.
+type SitemapLoader struct {
+	// Fetcher fetches http(s) sitemaps, so they are sent with the same
+	// client and User-Agent as the pages. A StreamFetcher is read as the
+	// sitemap arrives; any other Fetcher is read whole and is bound by its
+	// own size limit. Locations that are not URLs are read from disk.
+	Fetcher Fetcher
+
+	// Robots, when set, refuses sitemaps disallowed by robots.txt and
+	// applies each host's Crawl-delay through Limiter.
+	Robots *RobotsPolicy
+
+	// Limiter, when set, spaces out requests to the same host.
+	Limiter *HostLimiter
+
+	// Since skips entries whose lastmod is before it. Entries without a
+	// lastmod are always kept. The zero time keeps everything.
+	Since time.Time
+
+	// MaxIndexDepth limits how deep nested sitemap indexes are followed.
+	MaxIndexDepth int
+
+	// MaxSize limits the uncompressed size of one sitemap. Zero means no limit.
+	MaxSize int64
+}
+
+// NewSitemapLoader returns a SitemapLoader that fetches sitemaps with
+// fetcher and keeps every entry.
+func NewSitemapLoader(fetcher Fetcher) *SitemapLoader {
+	return &SitemapLoader{
+		Fetcher:       fetcher,
+		MaxIndexDepth: 3,
+
+		// The sitemap protocol allows up to 50 MB uncompressed.
+		MaxSize: 50 << 20,
+	}
+}
+
+// Load calls fn with the location of every page listed by the sitemap at loc.
+func (l *SitemapLoader) Load(ctx context.Context, loc string, fn func(url string) error) error {
+	return l.load(ctx, loc, 0, fn)
+}
+
+func (l *SitemapLoader) load(ctx context.Context, loc string, depth int, fn func(url string) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	rc, err := l.open(ctx, loc)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	err = readSitemap(rc, l.MaxSize, func(entry SitemapEntry, index bool) error {
+		if !l.Since.IsZero() && !entry.LastMod.IsZero() && entry.LastMod.Before(l.Since) {
+			return nil
+		}
+
+		if !index {
+			return fn(entry.Loc)
+		}
+
+		if depth >= l.MaxIndexDepth {
+			return fmt.Errorf("sitemap index nested too deep at %s", entry.Loc)
+		}
+
+		return l.load(ctx, entry.Loc, depth+1, fn)
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", loc, err)
+	}
+
+	return nil
+}
+
+// ReadSeedList calls fn for every URL in a plain text seed list, one per
+// line. Blank lines and lines starting with # are skipped.
+func ReadSeedList(r io.Reader, fn func(url string) error) error {
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if err := fn(line); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+// open returns the sitemap at loc, fetched with Fetcher when it is an
+// http(s) URL and read from disk otherwise.
+func (l *SitemapLoader) open(ctx context.Context, loc string) (io.ReadCloser, error) {
+	if !strings.HasPrefix(loc, "http://") && !strings.HasPrefix(loc, "https://") {
+		return os.Open(loc)
+	}
+
+	if l.Fetcher == nil {
+		return nil, fmt.Errorf("no fetcher for %s", loc)
+	}
+
+	if l.Robots != nil && !l.Robots.Allowed(ctx, loc) {
+		return nil, fmt.Errorf("disallowed by robots.txt: %s", loc)
+	}
+
+	if l.Limiter != nil {
+		var delay time.Duration
+
+		if l.Robots != nil {
+			delay = l.Robots.CrawlDelay(ctx, loc)
+		}
+
+		if err := l.Limiter.Wait(ctx, hostOf(loc), delay); err != nil {
+			return nil, err
+		}
+	}
+
+	if sf, ok := l.Fetcher.(StreamFetcher); ok {
+		return sf.FetchStream(ctx, loc)
+	}
+
+	// Sitemaps are XML or gzip, which a fetcher of pages would refuse.
+	resp, err := fetchResponse(acceptAnyContentType(ctx), l.Fetcher, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	return io.NopCloser(strings.NewReader(resp.Body)), nil
+}
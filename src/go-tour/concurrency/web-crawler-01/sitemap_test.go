@@ -0,0 +1,364 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testURLSet = `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>https://golang.org/</loc><lastmod>2024-03-01</lastmod></url>
+  <url><loc> https://golang.org/pkg/ </loc><lastmod>2023-01-15T10:00:00+00:00</lastmod></url>
+  <url><loc>https://golang.org/doc/</loc></url>
+  <url><loc></loc></url>
+</urlset>`
+
+func TestReadSitemap(t *testing.T) {
+	var got []SitemapEntry
+
+	err := ReadSitemap(strings.NewReader(testURLSet), func(e SitemapEntry, index bool) error {
+		if index {
+			t.Errorf("entry %q reported as an index entry", e.Loc)
+		}
+
+		got = append(got, e)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ReadSitemap() error = %v", err)
+	}
+
+	want := []SitemapEntry{
+		{Loc: "https://golang.org/", LastMod: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{Loc: "https://golang.org/pkg/", LastMod: time.Date(2023, 1, 15, 10, 0, 0, 0, time.UTC)},
+		{Loc: "https://golang.org/doc/"},
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("ReadSitemap() = %d entries, want %d", len(got), len(want))
+	}
+
+	for i := range want {
+		if got[i].Loc != want[i].Loc || !got[i].LastMod.Equal(want[i].LastMod) {
+			t.Errorf("entry %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func gzipped(t *testing.T, s string) []byte {
+	t.Helper()
+
+	var b bytes.Buffer
+
+	zw := gzip.NewWriter(&b)
+
+	if _, err := io.WriteString(zw, s); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return b.Bytes()
+}
+
+func TestSitemapLoaderIndex(t *testing.T) {
+	mux := http.NewServeMux()
+
+	var ts *httptest.Server
+
+	mux.HandleFunc("/sitemap_index.xml", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+			<sitemap><loc>%[1]s/docs.xml.gz</loc><lastmod>2024-05-01</lastmod></sitemap>
+			<sitemap><loc>%[1]s/old.xml</loc><lastmod>2020-01-01</lastmod></sitemap>
+		</sitemapindex>`, ts.URL)
+	})
+
+	mux.HandleFunc("/docs.xml.gz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/gzip")
+		fmt.Fprint(w, string(gzipped(t, testURLSet)))
+	})
+
+	mux.HandleFunc("/old.xml", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<urlset><url><loc>https://golang.org/old/</loc></url></urlset>`)
+	})
+
+	ts = httptest.NewServer(mux)
+	defer ts.Close()
+
+	tests := []struct {
+		name  string
+		since time.Time
+		want  []string
+	}{
+		{
+			name: "everything",
+			want: []string{
+				"https://golang.org/",
+				"https://golang.org/pkg/",
+				"https://golang.org/doc/",
+				"https://golang.org/old/",
+			},
+		},
+		{
+			name:  "since 2024",
+			since: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			want: []string{
+				"https://golang.org/",
+				"https://golang.org/doc/",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewSitemapLoader(NewHTTPFetcher())
+			l.Since = tt.since
+
+			var got []string
+
+			err := l.Load(context.Background(), ts.URL+"/sitemap_index.xml", func(url string) error {
+				got = append(got, url)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Load() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadSitemapStreams(t *testing.T) {
+	pr, pw := io.Pipe()
+	first := make(chan struct{})
+
+	go func() {
+		fmt.Fprint(pw, `<urlset><url><loc>https://a.example/0</loc></url>`)
+
+		// Only write the rest once the first entry has been handed out,
+		// which cannot happen if the reader waits for the whole document.
+		<-first
+
+		for i := 1; i < 10000; i++ {
+			fmt.Fprintf(pw, `<url><loc>https://a.example/%d</loc></url>`, i)
+		}
+
+		fmt.Fprint(pw, `</urlset>`)
+		pw.Close()
+	}()
+
+	n := 0
+
+	err := ReadSitemap(pr, func(e SitemapEntry, index bool) error {
+		if n == 0 {
+			close(first)
+		}
+
+		n++
+		return nil
+	})
+
+	if err != nil || n != 10000 {
+		t.Errorf("ReadSitemap() = %d entries, %v, want 10000, nil", n, err)
+	}
+}
+
+func TestReadSeedList(t *testing.T) {
+	list := "# docs\nhttps://golang.org/\n\n  https://golang.org/pkg/  \n#https://golang.org/skip/\n"
+
+	var got []string
+
+	err := ReadSeedList(strings.NewReader(list), func(url string) error {
+		got = append(got, url)
+		return nil
+	})
+
+	want := []string{"https://golang.org/", "https://golang.org/pkg/"}
+
+	if err != nil || !slices.Equal(got, want) {
+		t.Errorf("ReadSeedList() = %q, %v, want %q, nil", got, err, want)
+	}
+}
+
+func TestCrawlSeeds(t *testing.T) {
+	c := NewCrawler(fetcher)
+	c.MaxDepth = 1
+
+	result, err := c.CrawlSeeds(context.Background(), []string{
+		"https://golang.org/pkg/fmt/",
+		"https://golang.org/pkg/os/",
+		"https://golang.org/pkg/os",
+	})
+	if err != nil {
+		t.Fatalf("CrawlSeeds() error = %v", err)
+	}
+
+	want := []string{"https://golang.org/pkg/fmt/", "https://golang.org/pkg/os/"}
+
+	if got := pageURLs(result); !slices.Equal(got, want) {
+		t.Errorf("CrawlSeeds() pages = %q, want %q", got, want)
+	}
+}
+
+func TestSitemapLoaderFetcher(t *testing.T) {
+	var agents []string
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "User-agent: *\nDisallow: /private/\n")
+	})
+
+	mux.HandleFunc("/sitemap.xml", func(w http.ResponseWriter, r *http.Request) {
+		agents = append(agents, r.UserAgent())
+		w.Header().Set("Content-Type", "application/xml")
+		fmt.Fprint(w, testURLSet)
+	})
+
+	mux.HandleFunc("/private/sitemap.xml", func(w http.ResponseWriter, r *http.Request) {
+		t.Error("fetched a sitemap disallowed by robots.txt")
+	})
+
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	f := NewHTTPFetcher()
+	f.UserAgent = "sitemap-test/1.0"
+
+	l := NewSitemapLoader(f)
+	l.Robots = NewRobotsPolicy(f, f.UserAgent)
+
+	n := 0
+
+	err := l.Load(context.Background(), ts.URL+"/sitemap.xml", func(url string) error {
+		n++
+		return nil
+	})
+	if err != nil || n != 3 {
+		t.Fatalf("Load() = %d seeds, %v, want 3, nil", n, err)
+	}
+
+	if !slices.Equal(agents, []string{"sitemap-test/1.0"}) {
+		t.Errorf("sitemap requested with User-Agent %q, want the fetcher's", agents)
+	}
+
+	err = l.Load(context.Background(), ts.URL+"/private/sitemap.xml", func(url string) error { return nil })
+	if err == nil || !strings.Contains(err.Error(), "robots.txt") {
+		t.Errorf("Load(disallowed) error = %v, want a robots.txt error", err)
+	}
+}
+
+func TestSitemapLoaderStreams(t *testing.T) {
+	first := make(chan struct{})
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		fmt.Fprint(w, `<urlset><url><loc>https://golang.org/</loc></url>`)
+		w.(http.Flusher).Flush()
+
+		// The rest is only sent once the first entry was handed out.
+		select {
+		case <-first:
+		case <-r.Context().Done():
+			return
+		}
+
+		fmt.Fprint(w, `<url><loc>https://golang.org/pkg/</loc></url></urlset>`)
+	}))
+	defer ts.Close()
+
+	l := NewSitemapLoader(NewHTTPFetcher())
+
+	var got []string
+
+	err := l.Load(context.Background(), ts.URL+"/sitemap.xml", func(url string) error {
+		if len(got) == 0 {
+			close(first)
+		}
+
+		got = append(got, url)
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	want := []string{"https://golang.org/", "https://golang.org/pkg/"}
+
+	if !slices.Equal(got, want) {
+		t.Errorf("Load() = %q, want %q", got, want)
+	}
+}
+
+func TestSitemapLoaderMaxSize(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Write(gzipped(t, testURLSet))
+	}))
+	defer ts.Close()
+
+	l := NewSitemapLoader(NewHTTPFetcher())
+	l.MaxSize = int64(len(testURLSet)) - 1
+
+	err := l.Load(context.Background(), ts.URL+"/sitemap.xml.gz", func(url string) error { return nil })
+	if !errors.Is(err, ErrBodyTooLarge) {
+		t.Errorf("Load() error = %v, want %v", err, ErrBodyTooLarge)
+	}
+
+	l.MaxSize = int64(len(testURLSet))
+
+	if err := l.Load(context.Background(), ts.URL+"/sitemap.xml.gz", func(url string) error { return nil }); err != nil {
+		t.Errorf("Load() error = %v with room for the whole sitemap", err)
+	}
+}
+
+func TestCrawlFromStreams(t *testing.T) {
+	fetched := make(chan string, 2)
+
+	c := NewCrawler(fetcher)
+	c.MaxDepth = 1
+	c.OnPage = func(page PageResult, body string) {
+		fetched <- page.URL
+	}
+
+	seeds := make(chan string)
+
+	go func() {
+		defer close(seeds)
+
+		seeds <- "https://golang.org/pkg/fmt/"
+
+		// The first seed is crawled before the second one is even read.
+		<-fetched
+
+		seeds <- "https://golang.org/pkg/os/"
+		seeds <- "https://golang.org/pkg/os"
+	}()
+
+	result, err := c.CrawlFrom(context.Background(), seeds)
+	if err != nil {
+		t.Fatalf("CrawlFrom() error = %v", err)
+	}
+
+	want := []string{"https://golang.org/pkg/fmt/", "https://golang.org/pkg/os/"}
+
+	if got := pageURLs(result); !slices.Equal(got, want) {
+		t.Errorf("CrawlFrom() pages = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,689 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrDigestMismatch is returned by a WARCReader for a record whose block or
+// payload does not match its digest.
+var ErrDigestMismatch = errors.New("warc: digest mismatch")
+
+const (
+	warcVersion = "WARC/1.1"
+
+	// warcNotModified is the profile of revisit records for 304 responses.
+	warcNotModified = "http://netpreserve.org/warc/1.1/revisit/server-not-modified"
+)
+
+// WARCField is a named field in the header of a WARC record.
+type WARCField struct {
+	Name  string
+	Value string
+}
+
+// WARCRecord is one record of a WARC file.
+type WARCRecord struct {
+	// Header holds the fields of the record, such as WARC-Type and
+	// WARC-Target-URI, in the order they are written.
+	Header []WARCField
+
+	Block []byte
+}
+
+// Get returns the value of the first header field named name, ignoring
+// case, or "" if there is none.
+func (r *WARCRecord) Get(name string) string {
+	for _, f := range r.Header {
+		if strings.EqualFold(f.Name, name) {
+			return f.Value
+		}
+	}
+
+	return ""
+}
+
+// Type returns the WARC-Type of the record, such as "response".
+func (r *WARCRecord) Type() string {
+	return r.Get("WARC-Type")
+}
+
+func (r *WARCRecord) add(name, value string) {
+	r.Header = append(r.Header, WARCField{Name: name, Value: value})
+}
+
+// WARCWriter writes WARC 1.1 records. It is safe for concurrent use.
+//
+// Once a write fails, every later write returns the same error, so a
+// broken record is never followed by more records.
+type WARCWriter struct {
+	// Gzip compresses every record as a gzip member of its own, so a
+	// record can be read without decompressing the ones before it.
+	Gzip bool
+
+	// Now returns the WARC-Date of new records.
+	Now func() time.Time
+
+	mu     sync.Mutex
+	w      io.Writer
+	infoID string
+	err    error
+}
+
+// NewWARCWriter returns a WARCWriter that writes gzipped records to w.
+func NewWARCWriter(w io.Writer) *WARCWriter {
+	return &WARCWriter{
+		Gzip: true,
+		Now:  time.Now,
+		w:    w,
+	}
+}
+
+// WriteInfo writes a warcinfo record with fields describing the crawl.
+// Records written after it refer to it.
+func (w *WARCWriter) WriteInfo(fields []WARCField) error {
+	var block bytes.Buffer
+
+	for _, f := range fields {
+		fmt.Fprintf(&block, "%s: %s\r\n", f.Name, f.Value)
+	}
+
+	rec := &WARCRecord{Block: block.Bytes()}
+	rec.add("WARC-Type", "warcinfo")
+	rec.add("Content-Type", "application/warc-fields")
+
+	if err := w.WriteRecord(rec); err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	w.infoID = rec.Get("WARC-Record-ID")
+	w.mu.Unlock()
+
+	return nil
+}
+
+// WriteRecord writes rec, adding the WARC-Record-ID, WARC-Date,
+// WARC-Block-Digest and Content-Length fields it does not have yet.
+func (w *WARCWriter) WriteRecord(rec *WARCRecord) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.err != nil {
+		return w.err
+	}
+
+	if rec.Get("WARC-Record-ID") == "" {
+		id, err := newRecordID()
+		if err != nil {
+			return err
+		}
+
+		rec.add("WARC-Record-ID", id)
+	}
+
+	if rec.Get("WARC-Date") == "" {
+		now := time.Now
+		if w.Now != nil {
+			now = w.Now
+		}
+
+		rec.add("WARC-Date", now().UTC().Format(time.RFC3339))
+	}
+
+	if w.infoID != "" && rec.Type() != "warcinfo" && rec.Get("WARC-Warcinfo-ID") == "" {
+		rec.add("WARC-Warcinfo-ID", w.infoID)
+	}
+
+	if rec.Get("WARC-Block-Digest") == "" {
+		rec.add("WARC-Block-Digest", sha1Digest(rec.Block))
+	}
+
+	var b bytes.Buffer
+
+	b.WriteString(warcVersion + "\r\n")
+
+	for _, f := range rec.Header {
+		if !strings.EqualFold(f.Name, "Content-Length") {
+			fmt.Fprintf(&b, "%s: %s\r\n", f.Name, f.Value)
+		}
+	}
+
+	fmt.Fprintf(&b, "Content-Length: %d\r\n\r\n", len(rec.Block))
+	b.Write(rec.Block)
+	b.WriteString("\r\n\r\n")
+
+	w.err = w.write(b.Bytes())
+
+	return w.err
+}
+
+func (w *WARCWriter) write(data []byte) error {
+	if !w.Gzip {
+		_, err := w.w.Write(data)
+		return err
+	}
+
+	zw := gzip.NewWriter(w.w)
+
+	if _, err := zw.Write(data); err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+// Err returns the error that stopped the writer, if any.
+func (w *WARCWriter) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.err
+}
+
+// newRecordID returns a random UUID URN, the usual form of a WARC-Record-ID.
+func newRecordID() (string, error) {
+	var u [16]byte
+
+	if _, err := rand.Read(u[:]); err != nil {
+		return "", err
+	}
+
+	u[6] = u[6]&0x0f | 0x40
+	u[8] = u[8]&0x3f | 0x80
+
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", u[0:4], u[4:6], u[6:8], u[8:10], u[10:]), nil
+}
+
+func sha1Digest(data []byte) string {
+	sum := sha1.Sum(data)
+	return "sha1:" + base32.StdEncoding.EncodeToString(sum[:])
+}
+
+// checkDigest reports whether data matches digest, a label such as
+// "sha1:BASE32". Digests in an algorithm we do not know are not checked.
+func checkDigest(digest string, data []byte) bool {
+	algorithm, want, ok := strings.Cut(digest, ":")
+	if !ok {
+		return true
+	}
+
+	var h hash.Hash
+
+	switch strings.ToLower(algorithm) {
+	case "sha1":
+		h = sha1.New()
+	case "sha256":
+		h = sha256.New()
+	default:
+		return true
+	}
+
+	h.Write(data)
+	sum := h.Sum(nil)
+
+	return strings.EqualFold(want, base32.StdEncoding.EncodeToString(sum)) || strings.EqualFold(want, hex.EncodeToString(sum))
+}
+
+// WARCReader reads the records of a WARC file, whether it is gzipped or not.
+type WARCReader struct {
+	r *bufio.Reader
+}
+
+// NewWARCReader returns a WARCReader reading from r.
+func NewWARCReader(r io.Reader) (*WARCReader, error) {
+	br := bufio.NewReader(r)
+
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		// gzip.Reader reads the gzip members of every record as one stream.
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+
+		br = bufio.NewReader(zr)
+	}
+
+	return &WARCReader{r: br}, nil
+}
+
+// Next returns the next record, or io.EOF at the end of the file. A
+// record that does not match its digests is returned along with an error
+// wrapping ErrDigestMismatch.
+func (r *WARCReader) Next() (*WARCRecord, error) {
+	line, err := r.line()
+
+	for err == nil && line == "" {
+		line, err = r.line()
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasPrefix(line, "WARC/") {
+		return nil, fmt.Errorf("warc: bad version line %q", line)
+	}
+
+	rec := &WARCRecord{}
+
+	for {
+		line, err := r.line()
+		if err != nil {
+			return nil, noEOF(err)
+		}
+
+		if line == "" {
+			break
+		}
+
+		// A line starting with white space continues the previous field.
+		if (line[0] == ' ' || line[0] == '\t') && len(rec.Header) > 0 {
+			last := &rec.Header[len(rec.Header)-1]
+			last.Value += " " + strings.TrimSpace(line)
+
+			continue
+		}
+
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("warc: bad header line %q", line)
+		}
+
+		rec.add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+
+	length, err := strconv.ParseInt(rec.Get("Content-Length"), 10, 64)
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("warc: bad Content-Length %q", rec.Get("Content-Length"))
+	}
+
+	rec.Block, err = io.ReadAll(io.LimitReader(r.r, length))
+	if err != nil {
+		return nil, noEOF(err)
+	}
+
+	if int64(len(rec.Block)) < length {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	var end [4]byte
+
+	if _, err := io.ReadFull(r.r, end[:]); err != nil {
+		return nil, noEOF(err)
+	}
+
+	if string(end[:]) != "\r\n\r\n" {
+		return nil, fmt.Errorf("warc: record %s does not end with two CRLFs", rec.Get("WARC-Record-ID"))
+	}
+
+	return rec, rec.verify()
+}
+
+// line reads a line without its line ending.
+func (r *WARCReader) line() (string, error) {
+	s, err := r.r.ReadString('\n')
+
+	if err == io.EOF && s != "" {
+		return "", io.ErrUnexpectedEOF
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(s, "\r\n"), nil
+}
+
+// noEOF turns io.EOF in the middle of a record into io.ErrUnexpectedEOF.
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
+
+// verify checks the block digest of r and, for a response, the payload
+// digest of its HTTP body.
+func (r *WARCRecord) verify() error {
+	id := r.Get("WARC-Record-ID")
+
+	if digest := r.Get("WARC-Block-Digest"); digest != "" && !checkDigest(digest, r.Block) {
+		return fmt.Errorf("%w: block of %s", ErrDigestMismatch, id)
+	}
+
+	digest := r.Get("WARC-Payload-Digest")
+	if digest == "" || !r.isHTTPResponse() {
+		return nil
+	}
+
+	_, body, err := readHTTPResponse(r.Block)
+	if err != nil {
+		return fmt.Errorf("warc: record %s: %w", id, err)
+	}
+
+	if !checkDigest(digest, body) {
+		return fmt.Errorf("%w: payload of %s", ErrDigestMismatch, id)
+	}
+
+	return nil
+}
+
+// isHTTPResponse reports whether r archives an HTTP response, rather than,
+// say, a DNS lookup.
+func (r *WARCRecord) isHTTPResponse() bool {
+	return r.Type() == "response" && strings.HasPrefix(r.Get("Content-Type"), "application/http")
+}
+
+func readHTTPResponse(block []byte) (*http.Response, []byte, error) {
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(block)), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return resp, body, nil
+}
+
+// LoadWARC reads a WARC file into a Fixture. See ReadWARCFixture.
+func LoadWARC(path string) (*Fixture, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fx, err := ReadWARCFixture(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return fx, nil
+}
+
+// ReadWARCFixture reads the responses archived in a WARC file into a
+// Fixture, so that a ReplayFetcher can serve them. When a URL was fetched
+// more than once, its last response wins. The links of a page come from
+// the metadata record written with it by a WARCFetcher, or are extracted
+// from the body again for archives written by other tools.
+func ReadWARCFixture(r io.Reader) (*Fixture, error) {
+	wr, err := NewWARCReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	responses := make(map[string]Record)
+	latest := make(map[string]string)
+	outlinks := make(map[string][]string)
+
+	for {
+		rec, err := wr.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		id := rec.Get("WARC-Record-ID")
+
+		switch {
+		case rec.isHTTPResponse():
+			target := rec.Get("WARC-Target-URI")
+
+			resp, body, err := readHTTPResponse(rec.Block)
+			if err != nil {
+				return nil, fmt.Errorf("warc: record %s: %w", id, err)
+			}
+
+			responses[id] = Record{
+				URL:        target,
+				StatusCode: resp.StatusCode,
+				Header:     resp.Header,
+				Body:       string(body),
+			}
+
+			latest[target] = id
+
+		case rec.Type() == "metadata":
+			links := []string{}
+
+			for line := range strings.Lines(string(rec.Block)) {
+				if name, value, ok := strings.Cut(line, ":"); ok && strings.EqualFold(name, "outlink") {
+					links = append(links, strings.TrimSpace(value))
+				}
+			}
+
+			outlinks[rec.Get("WARC-Concurrent-To")] = links
+		}
+	}
+
+	fx := &Fixture{Records: make([]Record, 0, len(latest))}
+
+	for target, id := range latest {
+		rec := responses[id]
+
+		if links, ok := outlinks[id]; ok {
+			rec.Links = links
+		} else if base, err := url.Parse(target); err == nil && isHTML(mediaTypeOf(rec.Header.Get("Content-Type"))) {
+			rec.Links = extractLinks(base, rec.Body)
+		}
+
+		if len(rec.Links) == 0 {
+			rec.Links = nil
+		}
+
+		fx.Records = append(fx.Records, rec)
+	}
+
+	slices.SortFunc(fx.Records, func(a, b Record) int {
+		return cmp.Compare(a.URL, b.URL)
+	})
+
+	return fx, nil
+}
+
+// WARCFetcher is a Fetcher that archives the fetches of the Fetcher it
+// wraps. Every fetch that got an HTTP response is written as a response,
+// a request and a metadata record listing the links of the page. A 304 Not
+// Modified answer to a revalidation is written as a revisit record instead
+// of a response. Fetches that failed before getting a response, such as
+// DNS errors, are not archived.
+//
+// Fetches do not fail when the archive cannot be written: check the
+// WARCWriter's Err once the crawl is over.
+type WARCFetcher struct {
+	Fetcher Fetcher
+	Writer  *WARCWriter
+
+	// UserAgent is the User-Agent of the archived requests.
+	UserAgent string
+}
+
+// NewWARCFetcher returns a WARCFetcher that archives the fetches of
+// fetcher to w.
+func NewWARCFetcher(fetcher Fetcher, w *WARCWriter) *WARCFetcher {
+	return &WARCFetcher{Fetcher: fetcher, Writer: w}
+}
+
+// WithWARC returns a Middleware that archives fetches to w.
+func WithWARC(w *WARCWriter, userAgent string) Middleware {
+	return func(f Fetcher) Fetcher {
+		wf := NewWARCFetcher(f, w)
+		wf.UserAgent = userAgent
+
+		return wf
+	}
+}
+
+func (f *WARCFetcher) Fetch(url string) (string, []string, error) {
+	return bodyAndLinks(f.FetchResponse(context.Background(), url))
+}
+
+func (f *WARCFetcher) FetchResponse(ctx context.Context, url string) (*Response, error) {
+	resp, err := fetchResponse(ctx, f.Fetcher, url)
+	f.archive(url, nil, resp, err)
+
+	return resp, err
+}
+
+func (f *WARCFetcher) Revalidate(ctx context.Context, url string, cached *Response) (*Response, error) {
+	resp, err := revalidate(ctx, f.Fetcher, url, cached)
+	f.archive(url, cached, resp, err)
+
+	return resp, err
+}
+
+// archive writes the records of one fetch. A failed fetch is only archived
+// when its status code explains the failure.
+func (f *WARCFetcher) archive(rawURL string, cached *Response, resp *Response, err error) {
+	if resp == nil || resp.StatusCode == 0 {
+		return
+	}
+
+	if err != nil && statusError(rawURL, resp.StatusCode) == nil {
+		return
+	}
+
+	response := &WARCRecord{}
+
+	if cached != nil && resp.StatusCode == http.StatusNotModified {
+		response.add("WARC-Type", "revisit")
+		response.add("WARC-Target-URI", rawURL)
+		response.add("WARC-Profile", warcNotModified)
+		response.add("WARC-Refers-To-Target-URI", rawURL)
+		response.add("Content-Type", "application/http;msgtype=response")
+		response.Block = httpResponseBlock(resp, false)
+	} else {
+		response.add("WARC-Type", "response")
+		response.add("WARC-Target-URI", rawURL)
+		response.add("Content-Type", "application/http;msgtype=response")
+		response.add("WARC-Payload-Digest", sha1Digest([]byte(resp.Body)))
+		response.Block = httpResponseBlock(resp, true)
+	}
+
+	// Errors are kept by the writer for the caller to check.
+	if f.Writer.WriteRecord(response) != nil {
+		return
+	}
+
+	id := response.Get("WARC-Record-ID")
+
+	if block, err := httpRequestBlock(rawURL, f.UserAgent, cached); err == nil {
+		request := &WARCRecord{Block: block}
+		request.add("WARC-Type", "request")
+		request.add("WARC-Target-URI", rawURL)
+		request.add("WARC-Concurrent-To", id)
+		request.add("Content-Type", "application/http;msgtype=request")
+
+		if f.Writer.WriteRecord(request) != nil {
+			return
+		}
+	}
+
+	if response.Type() != "response" {
+		return
+	}
+
+	var links bytes.Buffer
+
+	for _, link := range resp.Links {
+		fmt.Fprintf(&links, "outlink: %s\r\n", link)
+	}
+
+	metadata := &WARCRecord{Block: links.Bytes()}
+	metadata.add("WARC-Type", "metadata")
+	metadata.add("WARC-Target-URI", rawURL)
+	metadata.add("WARC-Concurrent-To", id)
+	metadata.add("Content-Type", "application/warc-fields")
+
+	_ = f.Writer.WriteRecord(metadata)
+}
+
+// httpRequestBlock rebuilds the GET request for rawURL, as a conditional
+// request when cached is not nil.
+func httpRequestBlock(rawURL string, userAgent string, cached *Response) ([]byte, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make(http.Header)
+
+	if userAgent != "" {
+		header.Set("User-Agent", userAgent)
+	}
+
+	if cached != nil {
+		if etag := cached.Header.Get("ETag"); etag != "" {
+			header.Set("If-None-Match", etag)
+		}
+
+		if lastModified := cached.Header.Get("Last-Modified"); lastModified != "" {
+			header.Set("If-Modified-Since", lastModified)
+		}
+	}
+
+	var b bytes.Buffer
+
+	fmt.Fprintf(&b, "GET %s HTTP/1.1\r\nHost: %s\r\n", u.RequestURI(), u.Host)
+	_ = header.Write(&b)
+	b.WriteString("\r\n")
+
+	return b.Bytes(), nil
+}
+
+// httpResponseBlock rebuilds the HTTP response resp, with its body when
+// withBody is set.
+func httpResponseBlock(resp *Response, withBody bool) []byte {
+	header := resp.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+
+	if withBody {
+		// The HTTP client has already decoded the body.
+		header.Del("Transfer-Encoding")
+		header.Del("Content-Encoding")
+		header.Set("Content-Length", strconv.Itoa(len(resp.Body)))
+	}
+
+	var b bytes.Buffer
+
+	fmt.Fprintf(&b, "HTTP/1.1 %d %s\r\n", resp.StatusCode, http.StatusText(resp.StatusCode))
+	_ = header.Write(&b)
+	b.WriteString("\r\n")
+
+	if withBody {
+		b.WriteString(resp.Body)
+	}
+
+	return b.Bytes()
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readWARC returns every record in data.
+func readWARC(t *testing.T, data []byte) []*WARCRecord {
+	t.Helper()
+
+	r, err := NewWARCReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var records []*WARCRecord
+
+	for {
+		rec, err := r.Next()
+		if err == io.EOF {
+			return records
+		}
+
+		if err != nil {
+			t.Fatalf("Next() error = %v", err)
+		}
+
+		records = append(records, rec)
+	}
+}
+
+func TestWARCRecords(t *testing.T) {
+	ts := newTestSite(t)
+
+	var b bytes.Buffer
+
+	w := NewWARCWriter(&b)
+	w.Now = func() time.Time { return time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC) }
+
+	if err := w.WriteInfo([]WARCField{{Name: "software", Value: "test"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	f := NewWARCFetcher(NewHTTPFetcher(), w)
+	f.UserAgent = "test-agent"
+
+	for _, path := range []string{"/", "/missing", "/docs/?x=1"} {
+		_, _, _ = f.Fetch(ts.URL + path)
+	}
+
+	// Every record is a gzip member of its own.
+	zr, err := gzip.NewReader(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zr.Multistream(false)
+
+	first, _ := io.ReadAll(zr)
+
+	if !strings.HasPrefix(string(first), "WARC/1.1\r\nWARC-Type: warcinfo\r\n") || !strings.HasSuffix(string(first), "software: test\r\n\r\n\r\n") {
+		t.Errorf("first gzip member = %q, want the warcinfo record alone", first)
+	}
+
+	records := readWARC(t, b.Bytes())
+
+	var types []string
+
+	for _, rec := range records {
+		types = append(types, rec.Type()+" "+strings.TrimPrefix(rec.Get("WARC-Target-URI"), ts.URL))
+	}
+
+	want := []string{
+		"warcinfo ",
+		"response /", "request /", "metadata /",
+		"response /missing", "request /missing", "metadata /missing",
+		"response /docs/?x=1", "request /docs/?x=1", "metadata /docs/?x=1",
+	}
+
+	if !slices.Equal(types, want) {
+		t.Fatalf("records = %q, want %q", types, want)
+	}
+
+	info, response, request, metadata := records[0], records[1], records[2], records[3]
+
+	for _, rec := range records[1:] {
+		if rec.Get("WARC-Warcinfo-ID") != info.Get("WARC-Record-ID") || rec.Get("WARC-Date") != "2026-01-02T03:04:05Z" {
+			t.Errorf("%s record header = %v", rec.Type(), rec.Header)
+		}
+	}
+
+	if request.Get("WARC-Concurrent-To") != response.Get("WARC-Record-ID") || metadata.Get("WARC-Concurrent-To") != response.Get("WARC-Record-ID") {
+		t.Errorf("request and metadata do not refer to the response")
+	}
+
+	if got := string(request.Block); !strings.HasPrefix(got, "GET / HTTP/1.1\r\nHost: "+strings.TrimPrefix(ts.URL, "http://")+"\r\nUser-Agent: test-agent\r\n") {
+		t.Errorf("request block = %q", got)
+	}
+
+	if !strings.HasPrefix(string(response.Block), "HTTP/1.1 200 OK\r\n") || !strings.Contains(string(response.Block), "<title>Home</title>") {
+		t.Errorf("response block = %q", response.Block)
+	}
+
+	if !strings.HasPrefix(response.Get("WARC-Payload-Digest"), "sha1:") || !strings.HasPrefix(response.Get("WARC-Block-Digest"), "sha1:") {
+		t.Errorf("response digests = %q, %q", response.Get("WARC-Payload-Digest"), response.Get("WARC-Block-Digest"))
+	}
+
+	if got := string(metadata.Block); !strings.HasPrefix(got, "outlink: "+ts.URL+"/style.css\r\n") {
+		t.Errorf("metadata block = %q, want the outlinks", got)
+	}
+
+	if !strings.HasPrefix(string(records[4].Block), "HTTP/1.1 404 Not Found\r\n") {
+		t.Errorf("response block of /missing = %q", records[4].Block)
+	}
+}
+
+func TestWARCDigestMismatch(t *testing.T) {
+	var b bytes.Buffer
+
+	w := NewWARCWriter(&b)
+	w.Gzip = false
+
+	rec := &WARCRecord{Block: []byte("HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nhello")}
+	rec.add("WARC-Type", "response")
+	rec.add("WARC-Target-URI", "https://example.com/")
+	rec.add("Content-Type", "application/http;msgtype=response")
+	rec.add("WARC-Payload-Digest", sha1Digest([]byte("hello")))
+
+	if err := w.WriteRecord(rec); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := readWARC(t, b.Bytes()); len(got) != 1 || string(got[0].Block) != string(rec.Block) {
+		t.Fatalf("records = %v, want the one written", got)
+	}
+
+	tests := []struct {
+		name string
+		edit func(string) string
+	}{
+		{
+			name: "block",
+			edit: func(s string) string {
+				return strings.Replace(s, "hello", "jello", 1)
+			},
+		},
+		{
+			// Without a block digest, only the payload digest can catch it.
+			name: "payload",
+			edit: func(s string) string {
+				s = strings.Replace(s, "WARC-Block-Digest:", "X-Old-Digest:", 1)
+				return strings.Replace(s, "hello", "jello", 1)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewWARCReader(strings.NewReader(tt.edit(b.String())))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := r.Next(); !errors.Is(err, ErrDigestMismatch) || !strings.Contains(err.Error(), tt.name) {
+				t.Errorf("Next() error = %v, want a %s digest mismatch", err, tt.name)
+			}
+		})
+	}
+}
+
+func TestWARCReaderErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"version", "HTTP/1.1 200 OK\r\n\r\n"},
+		{"header", "WARC/1.1\r\nno colon\r\n\r\n"},
+		{"length", "WARC/1.1\r\nContent-Length: many\r\n\r\n"},
+		{"truncated", "WARC/1.1\r\nContent-Length: 10\r\n\r\nshort"},
+		{"end", "WARC/1.1\r\nContent-Length: 2\r\n\r\nokXXXX"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewWARCReader(strings.NewReader(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := r.Next(); err == nil || err == io.EOF {
+				t.Errorf("Next() error = %v, want an error", err)
+			}
+		})
+	}
+}
+
+func TestWARCReplayMatchesFakeFetcher(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "crawl.warc.gz")
+
+	var b bytes.Buffer
+
+	w := NewWARCWriter(&b)
+
+	want, err := Crawl(context.Background(), "https://golang.org/", 4, NewWARCFetcher(fetcher, w))
+	if err != nil {
+		t.Fatalf("Crawl() error = %v", err)
+	}
+
+	if err := writeFileAtomic(path, b.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+
+	fx, err := LoadWARC(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Crawl(context.Background(), "https://golang.org/", 4, NewReplayFetcher(fx, 1))
+	if err != nil {
+		t.Fatalf("Crawl() error = %v", err)
+	}
+
+	if !slices.Equal(pageURLs(got), pageURLs(want)) {
+		t.Fatalf("replayed pages = %q, want %q", pageURLs(got), pageURLs(want))
+	}
+
+	for _, w := range want.Pages {
+		g, _ := got.Page(w.URL)
+
+		if g.Status != w.Status || g.Title != w.Title || !slices.Equal(g.Links, w.Links) {
+			t.Errorf("Page(%q) = %s %q %q, want %s %q %q",
+				w.URL, g.Status, g.Title, g.Links, w.Status, w.Title, w.Links)
+		}
+	}
+}
+
+func TestWARCReplayHTTP(t *testing.T) {
+	ts := newTestSite(t)
+
+	var b bytes.Buffer
+
+	// Revalidating through the archive writes a revisit record, which must
+	// not hide the response archived before it.
+	cache := NewCacheFetcher(NewWARCFetcher(NewHTTPFetcher(), NewWARCWriter(&b)))
+
+	etagSite := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<title>Tagged</title><a href="/">Home</a>`)
+	})
+
+	tagged := httptest.NewServer(etagSite)
+	defer tagged.Close()
+
+	urls := []string{ts.URL + "/", ts.URL + "/missing", ts.URL + "/broken", ts.URL + "/image.png", tagged.URL + "/"}
+
+	for _, url := range urls {
+		_, _, _ = cache.Fetch(url)
+	}
+
+	_, _, _ = cache.Fetch(tagged.URL + "/")
+
+	if stats := cache.Stats(); stats.Revalidated != 1 {
+		t.Fatalf("cache stats = %+v, want one revalidation", stats)
+	}
+
+	records := readWARC(t, b.Bytes())
+
+	if revisit := records[len(records)-2]; revisit.Type() != "revisit" || revisit.Get("WARC-Profile") != warcNotModified {
+		t.Errorf("second to last record = %s %q, want a not modified revisit", revisit.Type(), revisit.Get("WARC-Profile"))
+	}
+
+	ts.Close()
+	tagged.Close()
+
+	fx, err := ReadWARCFixture(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replay := NewReplayFetcher(fx, 1)
+
+	resp, err := replay.FetchResponse(context.Background(), urls[0])
+	if err != nil {
+		t.Fatalf("FetchResponse(/) error = %v", err)
+	}
+
+	if resp.Header.Get("Content-Type") != "text/html; charset=utf-8" || pageTitle(resp.Body) != "Home" || len(resp.Links) != 3 {
+		t.Errorf("FetchResponse(/) = %q, title %q, links %q", resp.Header.Get("Content-Type"), pageTitle(resp.Body), resp.Links)
+	}
+
+	if _, _, err := replay.Fetch(urls[1]); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Fetch(/missing) error = %v, want ErrNotFound", err)
+	}
+
+	var statusErr *StatusError
+
+	if _, _, err := replay.Fetch(urls[2]); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusInternalServerError {
+		t.Errorf("Fetch(/broken) error = %v, want status 500", err)
+	}
+
+	// The content type error happened before the body was read, so there
+	// is no response to archive.
+	if _, _, err := replay.Fetch(urls[3]); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Fetch(/image.png) error = %v, want ErrNotFound", err)
+	}
+
+	if body, links, err := replay.Fetch(urls[4]); err != nil || pageTitle(body) != "Tagged" || len(links) != 1 {
+		t.Errorf("Fetch(tagged) = %q, %q, %v, want the archived response", body, links, err)
+	}
+}
+
+func TestWARCLinksWithoutMetadata(t *testing.T) {
+	var b bytes.Buffer
+
+	w := NewWARCWriter(&b)
+
+	rec := &WARCRecord{Block: []byte("HTTP/1.1 200 OK\r\nContent-Type: text/html\r\n\r\n<a href=\"b\">B</a><a href=\"/c\">C</a>")}
+	rec.add("WARC-Type", "response")
+	rec.add("WARC-Target-URI", "https://example.com/a/")
+	rec.add("Content-Type", "application/http; msgtype=response")
+
+	if err := w.WriteRecord(rec); err != nil {
+		t.Fatal(err)
+	}
+
+	fx, err := ReadWARCFixture(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"https://example.com/a/b", "https://example.com/c"}
+
+	if len(fx.Records) != 1 || !slices.Equal(fx.Records[0].Links, want) {
+		t.Errorf("ReadWARCFixture() = %+v, want links %q", fx.Records, want)
+	}
+}